@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"codeberg.org/n30w/jasima/pkg/book"
+)
+
+// writeBook writes the book of a generation of an exported generations file,
+// or of a history file, to standard output in `format`. `args` are the file
+// and, optionally, the generation. It defaults to the last generation of the
+// file.
+func writeBook(args []string, format string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("book requires a file and at most a generation")
+	}
+
+	f, ok := book.Formats[format]
+	if !ok {
+		return fmt.Errorf(
+			"unknown format %q, expected one of %s",
+			format,
+			strings.Join(slices.Sorted(maps.Keys(book.Formats)), ", "),
+		)
+	}
+
+	gens, first, err := readGenerations(args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(gens) == 0 {
+		return fmt.Errorf("%s has no generations", args[0])
+	}
+
+	last := first + len(gens) - 1
+
+	n := last
+	if len(args) == 2 {
+		n, err = strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid generation %q", args[1])
+		}
+	}
+
+	if n < first || n > last {
+		return fmt.Errorf("%s has generations %d to %d, not %d", args[0], first, last, n)
+	}
+
+	title := strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+
+	return f.Write(os.Stdout, book.New(title, gens[:n-first+1], first))
+}
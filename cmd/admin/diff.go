@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"codeberg.org/n30w/jasima/pkg/memory"
+)
+
+// historyLine is a line of a server's history file.
+type historyLine struct {
+	Number int `json:"generation"`
+
+	memory.Generation
+}
+
+// diff compares two generations of an exported generations file, or of a
+// history file. `args` are the file and, optionally, the generations to
+// compare from and to. They default to the last two generations of the file.
+func diff(args []string) error {
+	if len(args) < 1 || len(args) > 3 {
+		return fmt.Errorf("diff requires a file and at most two generations")
+	}
+
+	gens, first, err := readGenerations(args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(gens) == 0 {
+		return fmt.Errorf("%s has no generations", args[0])
+	}
+
+	last := first + len(gens) - 1
+
+	to := last
+	if len(args) == 3 {
+		to, err = strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid generation %q", args[2])
+		}
+	}
+
+	from := to - 1
+	if len(args) >= 2 {
+		from, err = strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid generation %q", args[1])
+		}
+	}
+
+	for _, n := range []int{from, to} {
+		if n < first || n > last {
+			return fmt.Errorf("%s has generations %d to %d, not %d", args[0], first, last, n)
+		}
+	}
+
+	fmt.Print(memory.DiffGenerations(gens[from-first], gens[to-first]))
+
+	return nil
+}
+
+// readGenerations reads the generations of the file at `path`, and the number
+// of its first generation. Exported generations files are a JSON array that
+// starts at generation 0, and history files have a generation per line.
+func readGenerations(path string) ([]memory.Generation, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer f.Close()
+
+	if filepath.Ext(path) != ".jsonl" {
+		var gens []memory.Generation
+
+		err = json.NewDecoder(f).Decode(&gens)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		return gens, 0, nil
+	}
+
+	var (
+		gens  []memory.Generation
+		first int
+		sc    = bufio.NewScanner(f)
+	)
+
+	// Generations are far longer than a scanner's default line.
+
+	sc.Buffer(nil, 64*1024*1024)
+
+	for i := 0; sc.Scan(); i++ {
+		var l historyLine
+
+		err = json.Unmarshal(sc.Bytes(), &l)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read line %d of %s: %w", i+1, path, err)
+		}
+
+		if i == 0 {
+			first = l.Number
+		}
+
+		gens = append(gens, l.Generation)
+	}
+
+	if err = sc.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return gens, first, nil
+}
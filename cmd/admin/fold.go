@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"codeberg.org/n30w/jasima/pkg/memory"
+)
+
+// fold reads a server's journal back into the chat and generations files the
+// server exports, so that a run that never exported can still be read. `args`
+// are the journal and, optionally, the directory to write the files to. It
+// defaults to the current directory. Only the generations of `lineage` are
+// folded.
+func fold(args []string, lineage string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("fold requires a journal and at most a directory")
+	}
+
+	if lineage == "" {
+		lineage = "main"
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	// A run killed mid-write leaves a torn last line, which is folded
+	// without.
+
+	msgs, gens, first, err := memory.FoldJournal(f, lineage)
+	switch {
+	case errors.Is(err, memory.ErrJournalTorn):
+		fmt.Fprintf(os.Stderr, "warning: %s: %v\n", args[0], err)
+	case err != nil:
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	if len(msgs) == 0 && len(gens) == 0 {
+		return fmt.Errorf("%s has nothing to fold for lineage %s", args[0], lineage)
+	}
+
+	dir := "."
+	if len(args) == 2 {
+		dir = args[1]
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	// Files are named after the run, the way the server names its exports.
+
+	run := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(args[0]), ".jsonl"), "journal_")
+	if lineage != "main" {
+		run += "_" + lineage
+	}
+
+	if msgs == nil {
+		msgs = []memory.Message{}
+	}
+
+	if gens == nil {
+		gens = []memory.Generation{}
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{fmt.Sprintf("chat_%s.json", run), msgs},
+		{fmt.Sprintf("generations_%s.json", run), gens},
+	}
+
+	for _, file := range files {
+		d, err := json.MarshalIndent(file.data, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		p := filepath.Join(dir, file.name)
+
+		err = os.WriteFile(p, d, 0o644)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(p)
+	}
+
+	fmt.Printf(
+		"%d messages, generations %d to %d\n",
+		len(msgs),
+		first,
+		first+len(gens)-1,
+	)
+
+	return nil
+}
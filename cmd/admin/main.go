@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/network"
+)
+
+const (
+	DefaultAdminAddr  = "http://localhost:7071"
+	DefaultAdminToken = ""
+	DefaultTimeout    = 10 * time.Second
+)
+
+const usage = `Usage: admin [flags] <command> [arguments]
+
+Commands:
+  clients                              list connected agents
+  status                               show the current job and generation
+  disconnect <name>                    disconnect an agent
+  inject <layer> <content>             inject a message into a layer
+  command <name> <command> [content]   send a command to an agent
+  export                               export chats and generations now
+  pause [job|exchange]                 pause before the next job or exchange
+  resume                               resume a paused run
+  step [job|exchange]                  run one more job or exchange, then pause
+  skip-layer                           skip the rest of the current layer
+  abort                                abort the generation being evolved
+  pinned                               list the words pinned for logograms
+  pin <word>...                        pin the words for logograms
+  unpin                                unpin every word
+  lineages                             list the lineages being evolved
+  fork <id> <generation> [generations] fork a lineage from a generation
+  diff <file> [from] [to]              compare two generations of an exported file
+  book <file> [generation]             write the book of a generation of an exported file
+  fold <journal> [dir]                 fold a journal into chat and generations files
+  replay                               show the run being replayed
+  replay pause|resume                  pause or resume the replay
+  replay seek <position|generation>    move the replay to a time or a generation
+  replay speed <factor>                change how fast the run is replayed
+  replay loop <on|off>                 replay the run again once it ends
+
+Flags:
+`
+
+func main() {
+	var (
+		flagAddr = flag.String(
+			"addr",
+			DefaultAdminAddr,
+			"address of the server's admin API",
+		)
+		flagToken = flag.String(
+			"token",
+			DefaultAdminToken,
+			"admin token, defaults to $JASIMA_ADMIN_TOKEN",
+		)
+		flagSender = flag.String(
+			"sender",
+			"",
+			"sender of an injected message, the server or MODERATOR, defaults to the server",
+		)
+		flagLineage = flag.String(
+			"lineage",
+			"",
+			"lineage to act on or fork from, defaults to the main lineage",
+		)
+		flagPipeline = flag.String(
+			"pipeline",
+			"",
+			"pipeline file on the server for a forked lineage",
+		)
+		flagLayers = flag.String(
+			"layers",
+			"",
+			"layers file on the server for a forked lineage",
+		)
+		flagFormat = flag.String(
+			"format",
+			"html",
+			"format of a book: csv, html, lift, markdown or tei",
+		)
+	)
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *flagToken == "" {
+		*flagToken = os.Getenv("JASIMA_ADMIN_TOKEN")
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	c := &adminClient{
+		hc:      &http.Client{},
+		addr:    strings.TrimSuffix(*flagAddr, "/"),
+		token:   *flagToken,
+		lineage: *flagLineage,
+	}
+
+	fork := network.AdminForkRequest{
+		From:     *flagLineage,
+		Pipeline: *flagPipeline,
+		Layers:   *flagLayers,
+	}
+
+	err := run(ctx, c, args, *flagSender, *flagFormat, fork)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "admin: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(
+	ctx context.Context,
+	c *adminClient,
+	args []string,
+	sender, format string,
+	fork network.AdminForkRequest,
+) error {
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "clients":
+		var clients []network.ClientInfo
+
+		err := c.do(ctx, http.MethodGet, "/admin/clients", nil, &clients)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tLINEAGE\tLAYER\tMODEL\tLATCHED\tPENDING\tMEMORY\tLAST SEEN\tCAPABILITIES")
+
+		for _, v := range clients {
+			lineage := v.Lineage
+			if lineage == "" {
+				lineage = "main"
+			}
+
+			fmt.Fprintf(
+				tw,
+				"%s\t%s\t%s\t%s\t%t\t%d\t%d\t%s ago\t%v\n",
+				v.Name,
+				lineage,
+				v.Layer,
+				v.Model,
+				v.State.Latched,
+				v.Pending,
+				v.State.MemorySize,
+				time.Since(v.LastSeen).Truncate(time.Second),
+				v.Capabilities,
+			)
+		}
+
+		return tw.Flush()
+
+	case "status":
+		var st network.AdminStatus
+
+		err := c.do(ctx, http.MethodGet, "/admin/status", nil, &st)
+		if err != nil {
+			return err
+		}
+
+		job := st.Job
+		if job == "" {
+			job = "idle"
+		} else {
+			job = fmt.Sprintf("%s (%s)", job, time.Since(st.JobStarted).Truncate(time.Second))
+		}
+
+		fmt.Printf("job:         %s\n", job)
+		fmt.Printf("generation:  %s\n", progress(st.Generation, st.MaxGenerations))
+		fmt.Printf("clients:     %d\n", st.Clients)
+		printRunState(st.Run)
+
+		return nil
+
+	case "disconnect":
+		if len(args) != 1 {
+			return fmt.Errorf("disconnect requires an agent name")
+		}
+
+		return c.do(
+			ctx,
+			http.MethodPost,
+			"/admin/clients/"+url.PathEscape(args[0])+"/disconnect",
+			nil,
+			nil,
+		)
+
+	case "inject":
+		if len(args) != 2 {
+			return fmt.Errorf("inject requires a layer and content")
+		}
+
+		// Custom layers are only known to the server by name, so they
+		// may also be given by id.
+
+		layer, err := chat.ParseLayer(args[0])
+		if id, convErr := strconv.Atoi(args[0]); err != nil && convErr == nil {
+			layer, err = chat.SetLayer(int32(id)), nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		req := network.AdminInjectRequest{
+			Layer:   layer,
+			Sender:  chat.Name(sender),
+			Content: args[1],
+		}
+
+		return c.do(ctx, http.MethodPost, "/admin/inject", req, nil)
+
+	case "command":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("command requires an agent name and a command")
+		}
+
+		req := network.AdminCommandRequest{
+			Receiver: chat.Name(args[0]),
+			Command:  args[1],
+		}
+
+		if len(args) == 3 {
+			req.Content = args[2]
+		}
+
+		return c.do(ctx, http.MethodPost, "/admin/command", req, nil)
+
+	case "export":
+		var res network.AdminExportResponse
+
+		err := c.do(ctx, http.MethodPost, "/admin/export", nil, &res)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range res.Files {
+			fmt.Println(f)
+		}
+
+		return nil
+
+	case "pause", "step":
+		if len(args) > 1 {
+			return fmt.Errorf("%s takes at most a unit", cmd)
+		}
+
+		path := "/admin/control/" + cmd
+		if len(args) == 1 {
+			path += "?unit=" + url.QueryEscape(args[0])
+		}
+
+		return control(ctx, c, path)
+
+	case "resume":
+		return control(ctx, c, "/admin/control/resume")
+
+	case "skip-layer":
+		return control(ctx, c, "/admin/control/skip-layer")
+
+	case "abort":
+		return control(ctx, c, "/admin/control/abort-generation")
+
+	case "pinned", "pin", "unpin":
+		var (
+			req    = network.AdminPinnedWords{Words: args}
+			res    network.AdminPinnedWords
+			method = http.MethodPut
+		)
+
+		switch {
+		case cmd == "pinned":
+			method = http.MethodGet
+		case cmd == "pin" && len(args) == 0:
+			return fmt.Errorf("pin requires at least one word")
+		case cmd == "unpin" && len(args) > 0:
+			return fmt.Errorf("unpin takes no arguments")
+		}
+
+		var body any
+		if method == http.MethodPut {
+			body = req
+		}
+
+		err := c.do(ctx, method, "/admin/words/pinned", body, &res)
+		if err != nil {
+			return err
+		}
+
+		for _, w := range res.Words {
+			fmt.Println(w)
+		}
+
+		return nil
+
+	case "lineages":
+		var lineages []network.LineageInfo
+
+		err := c.do(ctx, http.MethodGet, "/admin/lineages", nil, &lineages)
+		if err != nil {
+			return err
+		}
+
+		printLineages(lineages)
+
+		return nil
+
+	case "fork":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("fork requires a lineage id and a generation")
+		}
+
+		var err error
+
+		fork.ID = args[0]
+
+		fork.Generation, err = strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid generation %q", args[1])
+		}
+
+		if len(args) == 3 {
+			fork.Generations, err = strconv.Atoi(args[2])
+			if err != nil {
+				return fmt.Errorf("invalid number of generations %q", args[2])
+			}
+		}
+
+		var l network.LineageInfo
+
+		err = c.do(ctx, http.MethodPost, "/admin/lineages", fork, &l)
+		if err != nil {
+			return err
+		}
+
+		printLineages([]network.LineageInfo{l})
+
+		return nil
+
+	case "diff":
+		return diff(args)
+
+	case "book":
+		return writeBook(args, format)
+
+	case "fold":
+		return fold(args, c.lineage)
+
+	case "replay":
+		return replay(ctx, c, args)
+
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// control sends a run control request and prints the resulting run state.
+func control(ctx context.Context, c *adminClient, path string) error {
+	var st network.RunState
+
+	err := c.do(ctx, http.MethodPost, path, nil, &st)
+	if err != nil {
+		return err
+	}
+
+	printRunState(st)
+
+	return nil
+}
+
+func printLineages(lineages []network.LineageInfo) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPARENT\tFORKED AT\tGENERATION\tJOB\tCLIENTS")
+
+	for _, l := range lineages {
+		parent, forkedAt := "-", "-"
+		if l.Parent != "" {
+			parent, forkedAt = l.Parent, strconv.Itoa(l.ForkedAt)
+		}
+
+		job := l.Job
+		if job == "" {
+			job = "idle"
+		}
+
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\t%s\t%d\n",
+			l.ID,
+			parent,
+			forkedAt,
+			progress(l.Generation, l.MaxGenerations),
+			job,
+			l.Clients,
+		)
+	}
+
+	tw.Flush()
+}
+
+// progress is how many of `maxGenerations` generations have evolved. A
+// server that evolves forever has no maximum.
+func progress(generation, maxGenerations int) string {
+	if maxGenerations == 0 {
+		return fmt.Sprintf("%d/-", generation)
+	}
+
+	return fmt.Sprintf("%d/%d", generation, maxGenerations)
+}
+
+func printRunState(st network.RunState) {
+	state := "running"
+	if st.Paused {
+		state = fmt.Sprintf("paused at %s, %d steps left", st.Unit, st.Steps)
+	}
+
+	fmt.Printf("run:         %s\n", state)
+
+	if st.Layer != "" {
+		fmt.Printf("layer:       %s\n", st.Layer)
+	}
+}
+
+type adminClient struct {
+	hc    *http.Client
+	addr  string
+	token string
+
+	// lineage is the lineage that requests act on. The server acts on the
+	// main lineage when it is empty.
+	lineage string
+}
+
+// do sends a request with `body` encoded as JSON, and decodes the response
+// into `v` when `v` is not nil.
+func (c *adminClient) do(
+	ctx context.Context,
+	method, path string,
+	body any,
+	v any,
+) error {
+	var r io.Reader
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+
+		r = bytes.NewReader(b)
+	}
+
+	if c.lineage != "" {
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+
+		path += sep + "lineage=" + url.QueryEscape(c.lineage)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.addr+path, r)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		var e network.AdminError
+
+		err = json.NewDecoder(res.Body).Decode(&e)
+		if err != nil || e.Error == "" {
+			return fmt.Errorf("server responded with %s", res.Status)
+		}
+
+		return fmt.Errorf("server responded with %s: %s", res.Status, e.Error)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(res.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
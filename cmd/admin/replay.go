@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/network"
+)
+
+// replay shows or steers a server that replays a recorded run. `args` are
+// empty to show the replay, or an action and its argument.
+func replay(ctx context.Context, c *adminClient, args []string) error {
+	var (
+		method = http.MethodPost
+		path   = "/admin/replay"
+	)
+
+	switch {
+	case len(args) == 0:
+		method = http.MethodGet
+	case len(args) == 1 && (args[0] == "pause" || args[0] == "resume"):
+		path += "/" + args[0]
+	case len(args) == 2 && args[0] == "seek":
+		// Whole numbers are generations, anything else a position.
+
+		key := "position"
+		if _, err := strconv.Atoi(args[1]); err == nil {
+			key = "generation"
+		}
+
+		path += "/seek?" + key + "=" + url.QueryEscape(args[1])
+	case len(args) == 2 && args[0] == "speed":
+		path += "/speed?speed=" + url.QueryEscape(args[1])
+	case len(args) == 2 && args[0] == "loop":
+		loop, err := parseSwitch(args[1])
+		if err != nil {
+			return err
+		}
+
+		path += "/loop?loop=" + strconv.FormatBool(loop)
+	default:
+		return fmt.Errorf("replay takes pause, resume, seek <position|generation>, speed <factor> or loop <on|off>")
+	}
+
+	var st network.ReplayState
+
+	err := c.do(ctx, method, path, nil, &st)
+	if err != nil {
+		return err
+	}
+
+	printReplayState(st)
+
+	return nil
+}
+
+// parseSwitch parses "on" and "off", and anything strconv.ParseBool parses.
+func parseSwitch(s string) (bool, error) {
+	switch s {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("invalid switch %q, expected on or off", s)
+	}
+
+	return b, nil
+}
+
+func printReplayState(st network.ReplayState) {
+	state := "playing"
+	if st.Paused {
+		state = "paused"
+	}
+
+	loop := "off"
+	if st.Loop {
+		loop = "on"
+	}
+
+	fmt.Printf("run:         %s\n", st.Run)
+	fmt.Printf("replay:      %s at %gx, loop %s\n", state, st.Speed, loop)
+	fmt.Printf(
+		"position:    %s of %s\n",
+		st.Position.Round(time.Second),
+		st.Length.Round(time.Second),
+	)
+	fmt.Printf("generation:  %d of %d\n", st.Generation, st.Generations)
+}
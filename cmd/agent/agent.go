@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"time"
 
@@ -68,6 +69,11 @@ func newClient(
 		peerNames = append(peerNames, chat.Name(peer))
 	}
 
+	capabilities := make([]agent.Capability, 0)
+	for _, c := range userConf.Capabilities {
+		capabilities = append(capabilities, agent.Capability(c))
+	}
+
 	userConf.Model.Instructions = userConf.Model.
 		Instructions + "Your name in this conversation is: " + userConf.Name
 
@@ -75,12 +81,24 @@ func newClient(
 		Name:          chat.Name(userConf.Name),
 		Peers:         peerNames,
 		Layer:         chat.SetLayer(userConf.Layer),
+		Capabilities:  capabilities,
+		Lineage:       userConf.Lineage,
 		ModelConfig:   userConf.Model,
 		NetworkConfig: userConf.Network,
 	}
 
+	netOpts, err := chatClientOptions(userConf.Network)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to configure client security")
+	}
+
 	chatInbound := make(chan *chat.Message)
-	mc, err := network.NewChatClientService(ctx, userConf.Network.Router, chatInbound)
+	mc, err := network.NewChatClientService(
+		ctx,
+		userConf.Network.Router,
+		chatInbound,
+		netOpts...,
+	)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create client chat service")
 	}
@@ -194,6 +212,26 @@ func newClient(
 	}, nil
 }
 
+// supportedCommands are the server commands the client responds to in
+// `action`. They are declared to the server at registration.
+var supportedCommands = []agent.Command{
+	agent.AppendInstructions,
+	agent.SetInstructions,
+	agent.ResetInstructions,
+	agent.SendInitialMessage,
+	agent.RequestJsonDictionaryUpdate,
+	agent.RequestLogogramIteration,
+	agent.RequestLogogramCritique,
+	agent.RequestDictionaryWordDetection,
+	agent.RequestNextSpeaker,
+	agent.RequestConvergence,
+	agent.RequestSpecificationUpdate,
+	agent.RequestFitness,
+	agent.Latch,
+	agent.Unlatch,
+	agent.ClearMemory,
+}
+
 // action defines actions that the agent may take when receiving a message.
 // ctx represents the current message context. prevCtxCancel is the cancel
 // function for the context that preceded the current message context. ctxId is
@@ -253,6 +291,22 @@ func (c *client) action(
 
 		go typedRequest[memory.ResponseDictionaryWordsDetection](ctx, msg, c)
 
+	case agent.RequestNextSpeaker:
+
+		go typedRequest[memory.ResponseNextSpeaker](ctx, msg, c)
+
+	case agent.RequestConvergence:
+
+		go typedRequest[memory.ResponseConvergence](ctx, msg, c)
+
+	case agent.RequestSpecificationUpdate:
+
+		go typedRequest[memory.SpecificationUpdate](ctx, msg, c)
+
+	case agent.RequestFitness:
+
+		go typedRequest[memory.ResponseFitness](ctx, msg, c)
+
 	case agent.SendInitialMessage:
 
 		if c.latch {
@@ -292,9 +346,53 @@ func (c *client) action(
 		c.latch = false
 
 	default:
+		// A latched agent listens to the conversation without replying.
+		// The message is already in memory, so it has the context once
+		// it is unlatched.
+
+		if c.latch {
+			c.logger.Debug("Latched, not replying")
+			break
+		}
+
 		go c.DispatchToLLM(ctx)
 	}
 
+	if msg.Command.RequiresAck() {
+		err = c.acknowledge(ctx, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// acknowledge reports the client's state back to the sender of a command
+// once the command has been carried out.
+func (c *client) acknowledge(ctx context.Context, msg *memory.Message) error {
+	a, err := c.stm.Retrieve(ctx, c.Name, 0)
+	if err != nil {
+		return errors.Wrap(err, "stm retrieval failure")
+	}
+
+	st := chat.AgentState{
+		Command:         msg.Command,
+		Latched:         c.latch,
+		InstructionHash: hashInstructions(c.llm.Instructions()),
+		MemorySize:      len(a),
+	}
+
+	b, err := json.Marshal(st)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal agent state")
+	}
+
+	ack := c.NewMessageTo(msg.Sender, chat.Content(b))
+	ack.Command = agent.Acknowledge
+
+	c.channels.responses <- ack
+
 	return nil
 }
 
@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -159,4 +160,25 @@ func (c *client) Run(ctx context.Context) {
 		c.channels.errs <- err
 		return
 	}
+
+	go c.Heartbeat(ctx)
+}
+
+// Heartbeat tells the server that the client is alive every
+// `DefaultHeartbeatInterval`, even while it waits on its LLM.
+func (c *client) Heartbeat(ctx context.Context) {
+	t := time.NewTicker(DefaultHeartbeatInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			hb := c.NewMessageTo(c.Peers[0], "")
+			hb.Command = agent.Heartbeat
+
+			c.channels.responses <- hb
+		}
+	}
 }
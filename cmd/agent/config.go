@@ -1,6 +1,9 @@
 package main
 
 import (
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
 	"codeberg.org/n30w/jasima/pkg/chat"
 	"codeberg.org/n30w/jasima/pkg/llms"
 )
@@ -13,11 +16,17 @@
 	DefaultServerAddress    = "localhost:50051"
 	DefaultApiUrl           = ""
 	DefaultPeers            = ""
+	DefaultCapabilities     = ""
+	DefaultLineage          = ""
 	DefaultTemperatureFloat = 1.5
 	DefaultModel            = -1
 	DefaultLayer            = -1
 	DefaultDebugToggle      = false
 
+	// DefaultHeartbeatInterval is how often the client tells the server it
+	// is alive.
+	DefaultHeartbeatInterval = 10 * time.Second
+
 	DefaultOllamaUseStreaming = false
 	DefaultOllamaClientMode   = 0
 )
@@ -25,20 +34,40 @@
 type networkConfig struct {
 	Router   string
 	Database string
+
+	// TlsCA is the path to the CA that signed the server's certificate.
+	// Setting it connects to the server over TLS.
+	TlsCA string
+
+	// TlsCert and TlsKey are the paths to the agent's certificate and key,
+	// used when the server requires mutual TLS.
+	TlsCert string
+	TlsKey  string
+
+	// TlsServerName overrides the name used to verify the server's
+	// certificate.
+	TlsServerName string
+
+	// Token authenticates the agent with the server.
+	Token string
 }
 
 type userConfig struct {
-	Name    string
-	Peers   []string
-	Layer   int32
-	Model   llms.ModelConfig
-	Network networkConfig
+	Name         string
+	Peers        []string
+	Layer        int32
+	Capabilities []string
+	Lineage      string
+	Model        llms.ModelConfig
+	Network      networkConfig
 }
 
 type config struct {
 	Name          chat.Name
 	Peers         []chat.Name
 	Layer         chat.Layer
+	Capabilities  []agent.Capability
+	Lineage       string
 	ModelConfig   llms.ModelConfig
 	NetworkConfig networkConfig
 }
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"codeberg.org/n30w/jasima/pkg/chat"
 	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
 )
 
 func (c *client) newMessage(text chat.Content) memory.Message {
@@ -23,6 +28,13 @@ func (c *client) NewMessageFrom(
 
 	m.Role = memory.UserRole
 	m.Sender = sender
+
+	// A moderator steers the conversation rather than takes part in it.
+
+	if sender == chat.ModeratorName {
+		m.Role = memory.ModeratorRole
+	}
+
 	m.Receiver = c.Name
 	m.Layer = c.Layer
 
@@ -44,7 +56,7 @@ func (c *client) NewMessageTo(
 }
 
 func (c *client) sendMessage(msg memory.Message) error {
-	m := chat.NewPbMessage(c.Name, c.Peers[0], msg.Text, c.Layer)
+	m := chat.NewPbMessage(c.Name, msg.Receiver, msg.Text, c.Layer, msg.Command)
 
 	err := c.mc.Send(m)
 	if err != nil {
@@ -54,13 +66,37 @@ func (c *client) sendMessage(msg memory.Message) error {
 	return nil
 }
 
-// initConnection runs to establish an initial connection to the server.
-func (c *client) initConnection() error {
-	content := chat.Content(c.llm.String())
+// registration builds what the client declares about itself to the server.
+func (c *client) registration() chat.Registration {
+	return chat.Registration{
+		Name:            c.Name,
+		Layer:           c.Layer,
+		Provider:        int32(c.ModelConfig.Provider),
+		Model:           c.llm.String(),
+		Temperature:     c.ModelConfig.Temperature,
+		Seed:            c.ModelConfig.Seed,
+		InstructionHash: hashInstructions(c.llm.Instructions()),
+		Commands:        supportedCommands,
+		Schemas:         c.ModelConfig.Provider.Schemas(),
+		Capabilities:    c.Capabilities,
+		Lineage:         c.Lineage,
+		Peers:           c.Peers,
+		ProtocolVersion: chat.ProtocolVersion,
+	}
+}
 
-	msg := c.NewMessageTo(c.Peers[0], content)
+// initConnection runs to establish an initial connection to the server. The
+// first message sent to the server is the client's registration.
+func (c *client) initConnection() error {
+	msg, err := chat.NewRegistrationMessage(c.registration(), c.Peers[0])
+	if err != nil {
+		return errors.Wrap(err, "failed to build registration")
+	}
 
-	c.channels.responses <- msg
+	err = c.mc.Send(msg)
+	if err != nil {
+		return errors.Wrap(err, "failed to register with server")
+	}
 
 	c.logger.Debugf(
 		"Established connection to the server @ %s",
@@ -69,3 +105,36 @@ func (c *client) initConnection() error {
 
 	return nil
 }
+
+// chatClientOptions builds the security options of the connection to the
+// server from the `[network]` table.
+func chatClientOptions(cfg networkConfig) ([]network.ClientOption, error) {
+	opts := make([]network.ClientOption, 0)
+
+	if cfg.TlsCA != "" || cfg.TlsCert != "" {
+		tlsCfg, err := network.NewClientTLSConfig(
+			cfg.TlsCA,
+			cfg.TlsCert,
+			cfg.TlsKey,
+			cfg.TlsServerName,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, network.WithClientTLS(tlsCfg))
+	}
+
+	if cfg.Token != "" {
+		opts = append(opts, network.WithToken(cfg.Token))
+	}
+
+	return opts, nil
+}
+
+// hashInstructions hashes instructions so that they can be compared without
+// sending them over the wire.
+func hashInstructions(instructions string) string {
+	h := sha256.Sum256([]byte(instructions))
+	return hex.EncodeToString(h[:])
+}
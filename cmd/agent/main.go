@@ -6,6 +6,7 @@
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/BurntSushi/toml"
@@ -28,6 +29,16 @@ func main() {
 			DefaultPeers,
 			"comma separated list of agent's peers",
 		)
+		flagCapabilities = flag.String(
+			"capabilities",
+			DefaultCapabilities,
+			"comma separated list of agent's capabilities",
+		)
+		flagLineage = flag.String(
+			"lineage",
+			DefaultLineage,
+			"lineage the agent joins, empty joins the main lineage",
+		)
 		flagServer = flag.String(
 			"server",
 			DefaultServerAddress,
@@ -106,6 +117,14 @@ func main() {
 		userConf.Peers[0] = *flagPeers
 	}
 
+	if *flagCapabilities != DefaultCapabilities {
+		userConf.Capabilities = strings.Split(*flagCapabilities, ",")
+	}
+
+	if *flagLineage != DefaultLineage {
+		userConf.Lineage = *flagLineage
+	}
+
 	if *flagServer != DefaultServerAddress {
 		userConf.Network.Router = *flagServer
 	}
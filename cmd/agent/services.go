@@ -33,6 +33,9 @@ type llmService interface {
 	// AppendInstructions appends instructions to the initial instructions of
 	// the model.
 	AppendInstructions(s string)
+
+	// Instructions returns the current instructions of the model.
+	Instructions() string
 }
 
 // memoryServices defines different memory repositories the agent may use to
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+)
+
+// AdminEvents serves the admin API. Every route requires the configured admin
+// token. Routes about the run act on the main lineage, or on the lineage named
+// by the `lineage` query parameter.
+func (s *ConlangServer) AdminEvents(ctx context.Context) {
+	var (
+		guard = func(h http.Handler) http.Handler {
+			return network.RequireToken(s.config.admin.token, h)
+		}
+
+		inspect = func(mux *http.ServeMux) {
+			mux.Handle(
+				"GET /admin/clients",
+				guard(http.HandlerFunc(s.handleClients)),
+			)
+			mux.Handle(
+				"GET /admin/status",
+				guard(s.lineageHandler((*ConlangServer).handleStatus)),
+			)
+			mux.Handle(
+				"GET /admin/lineages",
+				guard(http.HandlerFunc(s.handleLineages)),
+			)
+		}
+
+		steer = func(mux *http.ServeMux) {
+			mux.Handle(
+				"POST /admin/clients/{name}/disconnect",
+				guard(http.HandlerFunc(s.handleDisconnect)),
+			)
+			mux.Handle(
+				"POST /admin/inject",
+				guard(s.lineageHandler((*ConlangServer).handleInject)),
+			)
+			mux.Handle(
+				"POST /admin/command",
+				guard(http.HandlerFunc(s.handleCommand)),
+			)
+			mux.Handle(
+				"POST /admin/export",
+				guard(s.lineageHandler((*ConlangServer).handleExport)),
+			)
+			mux.Handle(
+				"GET /admin/words/pinned",
+				guard(s.lineageHandler((*ConlangServer).handlePinnedWords)),
+			)
+			mux.Handle(
+				"PUT /admin/words/pinned",
+				guard(s.lineageHandler((*ConlangServer).handlePinWords)),
+			)
+		}
+
+		control = func(mux *http.ServeMux) {
+			mux.Handle(
+				"POST /admin/lineages",
+				guard(http.HandlerFunc(s.handleFork)),
+			)
+			mux.Handle(
+				"GET /admin/control",
+				guard(s.lineageHandler((*ConlangServer).handleRunState)),
+			)
+			mux.Handle(
+				"POST /admin/control/pause",
+				guard(s.lineageHandler((*ConlangServer).handlePause)),
+			)
+			mux.Handle(
+				"POST /admin/control/resume",
+				guard(s.lineageHandler((*ConlangServer).handleResume)),
+			)
+			mux.Handle(
+				"POST /admin/control/step",
+				guard(s.lineageHandler((*ConlangServer).handleStep)),
+			)
+			mux.Handle(
+				"POST /admin/control/skip-layer",
+				guard(s.lineageHandler((*ConlangServer).handleSkipLayer)),
+			)
+			mux.Handle(
+				"POST /admin/control/abort-generation",
+				guard(s.lineageHandler((*ConlangServer).handleAbortGeneration)),
+			)
+		}
+
+		replay = func(mux *http.ServeMux) {
+			mux.Handle(
+				"GET /admin/replay",
+				guard(http.HandlerFunc(s.handleReplayState)),
+			)
+			mux.Handle(
+				"POST /admin/replay/pause",
+				guard(http.HandlerFunc(s.handleReplayPause)),
+			)
+			mux.Handle(
+				"POST /admin/replay/resume",
+				guard(http.HandlerFunc(s.handleReplayResume)),
+			)
+			mux.Handle(
+				"POST /admin/replay/seek",
+				guard(http.HandlerFunc(s.handleReplaySeek)),
+			)
+			mux.Handle(
+				"POST /admin/replay/speed",
+				guard(http.HandlerFunc(s.handleReplaySpeed)),
+			)
+			mux.Handle(
+				"POST /admin/replay/loop",
+				guard(http.HandlerFunc(s.handleReplayLoop)),
+			)
+		}
+	)
+
+	if s.config.admin.token == "" {
+		s.logger.Warn(
+			"The admin API is unauthenticated, anyone who reaches it can steer the run. Set admin.token to require a token",
+			"port", s.config.admin.port,
+		)
+	}
+
+	adminCtx, adminCancel := context.WithCancel(ctx)
+	defer adminCancel()
+
+	// A replay is steered by its own controls, since there are no agents or
+	// jobs to steer.
+
+	if s.replay != nil {
+		s.admin.ListenAndServe(adminCtx, inspect, replay)
+		return
+	}
+
+	s.admin.ListenAndServe(adminCtx, inspect, steer, control)
+}
+
+func (s *ConlangServer) handleClients(w http.ResponseWriter, _ *http.Request) {
+	clients := s.gs.Clients()
+
+	infos := make([]network.ClientInfo, 0, len(clients))
+	for _, c := range clients {
+		infos = append(infos, c.Info())
+	}
+
+	network.WriteJson(w, http.StatusOK, infos)
+}
+
+func (s *ConlangServer) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	st := s.run.snapshot()
+	st.MaxGenerations = s.config.procedures.maxGenerations
+	st.Clients = len(s.clients())
+
+	network.WriteJson(w, http.StatusOK, st)
+}
+
+func (s *ConlangServer) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	name := chat.Name(r.PathValue("name"))
+
+	err := s.gs.Disconnect(name)
+	if err != nil {
+		network.WriteJson(w, http.StatusNotFound, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	s.logger.Warn("Operator disconnected client", "client", name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *ConlangServer) handleInject(w http.ResponseWriter, r *http.Request) {
+	var req network.AdminInjectRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	if !req.Layer.Known() || req.Layer == chat.SystemLayer {
+		network.WriteJson(
+			w,
+			http.StatusBadRequest,
+			network.AdminError{Error: "unknown layer"},
+		)
+		return
+	}
+
+	// Injected messages may not pass for an agent's, so they come from
+	// the server or the moderator.
+
+	switch req.Sender {
+	case "":
+		req.Sender = s.name
+	case s.name, chat.ModeratorName:
+	default:
+		network.WriteJson(
+			w,
+			http.StatusBadRequest,
+			network.AdminError{Error: fmt.Sprintf(
+				"sender must be %s or %s",
+				s.name,
+				chat.ModeratorName,
+			)},
+		)
+		return
+	}
+
+	// Injected messages take the path of moderator messages, so that the
+	// procedure iterating on the layer hands them to its participants,
+	// records them in the transcript and shows them on the frontend.
+
+	msg := memory.NewChatMessage(req.Sender.String(), "", req.Content, int32(req.Layer))
+
+	if req.Sender == chat.ModeratorName {
+		msg.Role = memory.ModeratorRole
+	}
+
+	code, err := s.queueModeration(*msg)
+	if err != nil {
+		network.WriteJson(w, code, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	s.logger.Warn(
+		"Operator injected message",
+		"layer", req.Layer,
+		"sender", req.Sender,
+		"lineage", s.lineage,
+	)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *ConlangServer) handleCommand(w http.ResponseWriter, r *http.Request) {
+	var req network.AdminCommandRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	cmd, err := agent.ParseCommand(req.Command)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	// Only clients send the commands of the protocol itself.
+
+	switch cmd {
+	case agent.Register, agent.Acknowledge, agent.Heartbeat:
+		network.WriteJson(
+			w,
+			http.StatusBadRequest,
+			network.AdminError{Error: fmt.Sprintf("%s is sent by clients, not operators", cmd)},
+		)
+		return
+	}
+
+	c, err := s.gs.GetClientByName(req.Receiver)
+	if err != nil {
+		network.WriteJson(w, http.StatusNotFound, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	err = s.swc(r.Context(), s.cmd(cmd, req.Content)(c))
+	if err != nil {
+		network.WriteJson(w, http.StatusServiceUnavailable, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	s.logger.Warn("Operator issued command", "command", cmd, "client", c.Name)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *ConlangServer) handleExport(w http.ResponseWriter, _ *http.Request) {
+	files, err := s.export()
+	if err != nil {
+		network.WriteJson(w, http.StatusInternalServerError, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	network.WriteJson(w, http.StatusOK, network.AdminExportResponse{Files: files})
+}
+
+func (s *ConlangServer) handlePinnedWords(w http.ResponseWriter, _ *http.Request) {
+	network.WriteJson(w, http.StatusOK, network.AdminPinnedWords{Words: s.pinned.get()})
+}
+
+func (s *ConlangServer) handlePinWords(w http.ResponseWriter, r *http.Request) {
+	var req network.AdminPinnedWords
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	s.pinned.set(req.Words)
+
+	s.logger.Warn("Operator pinned words", "words", req.Words)
+
+	network.WriteJson(w, http.StatusOK, network.AdminPinnedWords{Words: s.pinned.get()})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/pkg/errors"
+)
+
+// checkpointVersion is the version of the checkpoint format.
+const checkpointVersion = 1
+
+// checkpoint is the state of a run after a job completes. A run resumed from
+// a checkpoint continues at the generation after the last one that was
+// evolved.
+type checkpoint struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Job is the name of the last job that completed.
+	Job string `json:"job"`
+
+	// Generation is the number of generations evolved so far.
+	Generation int `json:"generation"`
+
+	MaxGenerations int `json:"maxGenerations"`
+
+	// Generations are the generations evolved so far that were kept in
+	// memory, starting with the initial generation.
+	Generations []memory.Generation `json:"generations"`
+
+	// Flushed is the number of generations that were flushed to the run's
+	// history file before the first of `Generations`.
+	Flushed int `json:"flushed,omitempty"`
+
+	// Dictionary is the server's dictionary, which includes logograms
+	// iterated on in a generation that has not been evolved yet.
+	Dictionary memory.DictionaryGeneration `json:"dictionary"`
+
+	// Agents are the connected agents and the state they last acknowledged.
+	// Agents are given their instructions anew on every layer, so this is
+	// kept for reference rather than restored.
+	Agents []network.ClientInfo `json:"agents"`
+
+	// Messages are the contents of the server's message memory.
+	Messages []memory.Message `json:"messages"`
+}
+
+// saveCheckpoint writes the state of the run to the run's checkpoint file,
+// replacing the previous checkpoint. `job` is the name of the job that just
+// completed.
+func (s *ConlangServer) saveCheckpoint(job string) error {
+	if s.config.files.checkpoints == "" {
+		return nil
+	}
+
+	gens, err := s.generations.ToSlice()
+	if err != nil {
+		return errors.Wrap(err, "failed to checkpoint generations")
+	}
+
+	msgs, err := s.memory.All()
+	if err != nil {
+		s.logger.Debugf("checkpointing without messages: %v", err)
+	}
+
+	agents := make([]network.ClientInfo, 0)
+	for _, c := range s.gs.Clients() {
+		agents = append(agents, c.Info())
+	}
+
+	cp := checkpoint{
+		Version:        checkpointVersion,
+		CreatedAt:      time.Now(),
+		Job:            job,
+		Generation:     s.run.currentGeneration(),
+		MaxGenerations: s.config.procedures.maxGenerations,
+		Generations:    gens,
+		Flushed:        s.flushed,
+		Dictionary:     s.dictionary,
+		Agents:         agents,
+		Messages:       msgs,
+	}
+
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal checkpoint")
+	}
+
+	err = os.MkdirAll(s.config.files.checkpoints, 0o755)
+	if err != nil {
+		return errors.Wrap(err, "failed to create checkpoint directory")
+	}
+
+	p := filepath.Join(
+		s.config.files.checkpoints,
+		fmt.Sprintf("checkpoint_%s.json", s.runID),
+	)
+
+	// Write to a temporary file first, so that a crash while writing does
+	// not destroy the previous checkpoint.
+
+	tmp := p + ".tmp"
+
+	err = os.WriteFile(tmp, b, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write checkpoint")
+	}
+
+	err = os.Rename(tmp, p)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace checkpoint")
+	}
+
+	s.logger.Debugf("Saved checkpoint to %s after %s", p, job)
+
+	return nil
+}
+
+// loadCheckpoint reads a checkpoint from `p`. It also accepts the
+// `generations_*.json` files written by `export-data`, in which case only
+// the generations are restored.
+func loadCheckpoint(p string) (*checkpoint, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read checkpoint %s", p)
+	}
+
+	cp := &checkpoint{}
+
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		err = json.Unmarshal(b, &cp.Generations)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed generations file %s", p)
+		}
+	} else {
+		err = json.Unmarshal(b, cp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed checkpoint %s", p)
+		}
+
+		if cp.Version != checkpointVersion {
+			return nil, errors.Errorf(
+				"checkpoint %s has version %d, expected %d",
+				p,
+				cp.Version,
+				checkpointVersion,
+			)
+		}
+	}
+
+	if len(cp.Generations) == 0 {
+		return nil, errors.Errorf("checkpoint %s has no generations", p)
+	}
+
+	// The first generation is the initial one, so every other generation
+	// has been evolved.
+
+	cp.Generation = cp.Flushed + len(cp.Generations) - 1
+
+	if cp.Dictionary == nil {
+		cp.Dictionary = cp.Generations[len(cp.Generations)-1].Dictionary.Copy()
+	}
+
+	return cp, nil
+}
+
+// restoreMessages saves the messages of a checkpoint to memory.
+func restoreMessages(
+	ctx context.Context,
+	m MemoryService,
+	msgs []memory.Message,
+) error {
+	for _, msg := range msgs {
+		err := m.Save(ctx, msg)
+		if err != nil {
+			return errors.Wrap(err, "failed to restore message")
+		}
+	}
+
+	return nil
+}
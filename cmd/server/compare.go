@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/pkg/errors"
+)
+
+// handleGenerationDiff compares two generations kept in memory, named by the
+// `from` and `to` query parameters. `to` defaults to the latest generation and
+// `from` to the generation before `to`.
+func (s *ConlangServer) handleGenerationDiff(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	gens, err := s.generations.ToSlice()
+	if err != nil {
+		network.WriteJson(w, http.StatusInternalServerError, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	latest := s.flushed + len(gens) - 1
+
+	to, err := generationParam(r, "to", latest)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	from, err := generationParam(r, "from", to-1)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	// Only the generations kept in memory can be compared.
+
+	for _, n := range []int{from, to} {
+		if n < s.flushed || n > latest {
+			network.WriteJson(
+				w,
+				http.StatusNotFound,
+				network.AdminError{Error: errors.Errorf(
+					"generations %d to %d are kept, not %d",
+					s.flushed,
+					latest,
+					n,
+				).Error()},
+			)
+			return
+		}
+	}
+
+	network.WriteJson(
+		w,
+		http.StatusOK,
+		memory.DiffGenerations(gens[from-s.flushed], gens[to-s.flushed]),
+	)
+}
+
+// generationParam reads the generation number of query parameter `key`, or
+// returns `fallback` when there is none.
+func generationParam(r *http.Request, key string, fallback int) (int, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s generation", key)
+	}
+
+	return n, nil
+}
@@ -1,10 +1,16 @@
 package main
 
+import "time"
+
 const (
 	DefaultSpecResourcePath           = "./resources/specifications"
 	DefaultDictionaryJsonPath         = "./resources/specifications/dictionary.json"
 	DefaultSvgResourcePath            = "./resources/logography"
-	DefaultLogToFilePath              = "./outputs/logs/server_log_%s.log"
+	DefaultOutputPath                 = "./outputs"
+	DefaultConfigPath                 = ""
+	DefaultPrintConfig                = false
+	DefaultGrpcAddress                = "localhost:50051"
+	DefaultWebPort                    = "7070"
 	DefaultDebugToggle                = false
 	DefaultBroadcastTestData          = false
 	DefaultMaxExchanges               = 25
@@ -13,6 +19,42 @@
 	DefaultLogToFileToggle            = false
 	DefaultExportData                 = false
 	DefaultServerName                 = "SERVER"
+	DefaultBarrierTimeout             = 30 * time.Second
+	DefaultTLSCert                    = ""
+	DefaultTLSKey                     = ""
+	DefaultTLSClientCA                = ""
+	DefaultAuthTokensPath             = ""
+	DefaultAdminPort                  = "7071"
+	DefaultAdminToken                 = ""
+	DefaultPipelinePath               = ""
+	DefaultWaitForClients             = 11
+	DefaultWaitDuration               = 10 * time.Second
+	DefaultLogogramWordCount          = 3
+	DefaultCheckpointPath             = "./outputs/checkpoints"
+	DefaultResumePath                 = ""
+	DefaultLayersPath                 = ""
+	DefaultReplyTimeout               = 5 * time.Minute
+	DefaultReplyRetries               = 1
+	DefaultModeratorMaxLength         = 280
+	DefaultModeratorRate              = 3
+	DefaultRetainGenerations          = 0
+	DefaultExportEvery                = 0
+	DefaultExportInterval             = time.Duration(0)
+	DefaultJournal                    = true
+	DefaultJournalSync                = "interval"
+	DefaultJournalSyncInterval        = time.Second
+	DefaultReplayPath                 = ""
+	DefaultReplayRun                  = ""
+	DefaultReplaySpeed                = 1.0
+	DefaultReplayLoop                 = false
+
+	// DefaultRollingWindow is how many generations a run that evolves
+	// forever keeps in memory, unless told otherwise.
+	DefaultRollingWindow = 100
+
+	// DefaultHeartbeatTimeout is how long an agent may go without sending
+	// anything, heartbeats included, before the watchdog stops nudging it.
+	DefaultHeartbeatTimeout = 45 * time.Second
 )
 
 type procedureConfig struct {
@@ -32,20 +74,150 @@ type procedureConfig struct {
 	// exportGenerationData determines if a batch of jobs will export their
 	// resulting data.
 	exportData bool
+
+	// replyTimeout is how long the server waits for an agent to reply
+	// before the watchdog steps in.
+	replyTimeout time.Duration
+
+	// replyRetries is how many times a silent agent is nudged before the
+	// watchdog falls back to another agent.
+	replyRetries int
+
+	// retainGenerations is how many of the most recent generations are kept
+	// in memory. Older generations are flushed to the run's history file.
+	// When set to 0, every generation is kept.
+	retainGenerations int
+
+	// exportEvery and exportInterval export the run every so many
+	// generations, and every so often, as generations complete. Either is
+	// turned off when set to 0.
+	exportEvery    int
+	exportInterval time.Duration
+
+	// waitForClients and waitDuration are used by the steps of a pipeline
+	// that do not set their own `clients` and `duration`.
+	waitForClients int
+	waitDuration   time.Duration
 }
 
 type filePathConfig struct {
 	specifications string
 	logography     string
 	dictionary     string
+
+	// outputs is the directory chats, generations and logs are saved to.
+	outputs string
+
+	// checkpoints is the directory checkpoints are saved to. Checkpoints
+	// are disabled when empty.
+	checkpoints string
+}
+
+// securityConfig configures transport security and authentication of the
+// gRPC server. Empty values disable the respective feature.
+type securityConfig struct {
+	// tlsCert and tlsKey are the paths to the server's certificate and key.
+	tlsCert string
+	tlsKey  string
+
+	// tlsClientCA is the path to the CA that signs client certificates.
+	// Setting it enables mutual TLS.
+	tlsClientCA string
+
+	// authTokens is the path to a TOML file mapping agent names to the
+	// tokens they must authenticate with.
+	authTokens string
+}
+
+// networkConfig configures where the server listens.
+type networkConfig struct {
+	// grpcAddress is the address agents connect to.
+	grpcAddress string
+
+	// webPort is the port of the web events.
+	webPort string
+}
+
+// adminConfig configures the admin API that operators use to inspect and
+// steer a running server.
+type adminConfig struct {
+	port string
+
+	// token is required as a bearer token on every admin request. The
+	// admin API is unauthenticated when empty, which the server warns
+	// about when it starts, and is then only safe to serve on localhost.
+	token string
+}
+
+// moderationConfig limits the messages that people moderating a layer
+// conversation may inject into it.
+type moderationConfig struct {
+	// maxLength is the most characters a moderator message may have.
+	maxLength int
+
+	// rate is how many messages each address may send a minute. Moderator
+	// messages are turned away when it is 0.
+	rate int
+}
+
+// journalConfig configures the journal a run's events are appended to as
+// they happen.
+type journalConfig struct {
+	enabled bool
+
+	// sync is when journal events are written to disk: "never" leaves it to
+	// the operating system, "interval" writes at most every `syncInterval`,
+	// and "always" writes every event.
+	sync         string
+	syncInterval time.Duration
+}
+
+// replayConfig configures the replay of a recorded run.
+type replayConfig struct {
+	// path is the outputs directory of the recorded run. The server evolves
+	// a language rather than replaying one when it is empty.
+	path string
+
+	// run is the run of `path` to replay, its latest when empty.
+	run string
+
+	// speed scales the time between events of the recording. A speed of 2
+	// plays the recording twice as fast as it happened.
+	speed float64
+
+	// loop plays the recording again from the start once it ends.
+	loop bool
 }
 
 type config struct {
 	name              string
 	debugEnabled      bool
 	broadcastTestData bool
+	network           networkConfig
 	files             filePathConfig
 	procedures        procedureConfig
+	security          securityConfig
+	admin             adminConfig
+	moderation        moderationConfig
+	journal           journalConfig
+	replay            replayConfig
+
+	// pipeline is the job graph of the evolution.
+	pipeline *pipeline
+
+	// layers are the layers the pipeline can evolve.
+	layers layerSet
+
+	// resume is the path to a checkpoint or exported generations file to
+	// resume from.
+	resume string
+
+	// roster holds the agents the server expects.
+	roster roster
+
+	// settings are what the configuration was built from. They are recorded
+	// in the manifest of every export.
+	settings settings
 }
 
 type dictExtractMethod int
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/network"
+)
+
+var (
+	// errLayerSkipped is returned by the exchange gate when an operator
+	// skips the rest of the layer being iterated on.
+	errLayerSkipped = errors.New("layer skipped by operator")
+
+	// errGenerationAborted is returned by the job and exchange gates when an
+	// operator aborts the generation being evolved.
+	errGenerationAborted = errors.New("generation aborted by operator")
+)
+
+// controlUnit is what the job queue pauses and steps at.
+type controlUnit string
+
+const (
+	// unitJob pauses before the next job starts.
+	unitJob controlUnit = "job"
+
+	// unitExchange pauses before the next exchange between agents. Jobs
+	// without exchanges run as usual.
+	unitExchange controlUnit = "exchange"
+)
+
+// runControl tracks what the server is doing and lets operators pause,
+// resume, step, skip and abort the job queue. Jobs honor it at gates: before
+// every job, and before every exchange of a layer or logogram.
+type runControl struct {
+	mu sync.Mutex
+
+	job        string
+	jobStage   stage
+	jobStarted time.Time
+	generation int
+
+	// layer describes what is being iterated on. It is empty outside of a
+	// layer.
+	layer string
+
+	paused bool
+	unit   controlUnit
+
+	// steps are the number of gates that may be passed while paused.
+	steps int
+
+	skipLayer       bool
+	abortGeneration bool
+
+	// changed is closed and replaced every time the control changes, to
+	// wake up gates.
+	changed chan struct{}
+
+	// onChange is called with the new run state after every change.
+	onChange func(network.RunState)
+}
+
+func newRunControl(generation int, onChange func(network.RunState)) *runControl {
+	return &runControl{
+		generation: generation,
+		unit:       unitJob,
+		changed:    make(chan struct{}),
+		onChange:   onChange,
+	}
+}
+
+// update applies `f` to the control while locked, then wakes up gates and
+// reports the new run state.
+func (r *runControl) update(f func()) {
+	r.mu.Lock()
+	f()
+	close(r.changed)
+	r.changed = make(chan struct{})
+	st := r.state()
+	r.mu.Unlock()
+
+	if r.onChange != nil {
+		r.onChange(st)
+	}
+}
+
+// state must be called with the lock held.
+func (r *runControl) state() network.RunState {
+	return network.RunState{
+		Paused:     r.paused,
+		Unit:       string(r.unit),
+		Steps:      r.steps,
+		Job:        r.job,
+		Generation: r.generation,
+		Layer:      r.layer,
+	}
+}
+
+// State returns the current run state.
+func (r *runControl) State() network.RunState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.state()
+}
+
+// Changed returns a channel that is closed the next time the control
+// changes.
+func (r *runControl) Changed() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.changed
+}
+
+func (r *runControl) startJob(name string, sg stage) {
+	r.update(func() {
+		r.job = name
+		r.jobStage = sg
+		r.jobStarted = time.Now()
+	})
+}
+
+func (r *runControl) endJob() {
+	r.update(func() {
+		r.job = ""
+		r.jobStarted = time.Time{}
+	})
+}
+
+func (r *runControl) generationDone() {
+	r.update(func() {
+		r.generation++
+	})
+}
+
+func (r *runControl) snapshot() network.AdminStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return network.AdminStatus{
+		Job:        r.job,
+		JobStarted: r.jobStarted,
+		Generation: r.generation,
+		Run:        r.state(),
+	}
+}
+
+// currentGeneration returns the index of the generation being evolved.
+func (r *runControl) currentGeneration() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.generation
+}
+
+// enterLayer marks the start of a layer or logogram iteration. Skip requests
+// only apply to the layer they were made in.
+func (r *runControl) enterLayer(name string) {
+	r.update(func() {
+		r.layer = name
+		r.skipLayer = false
+	})
+}
+
+func (r *runControl) leaveLayer() {
+	r.update(func() {
+		r.layer = ""
+		r.skipLayer = false
+	})
+}
+
+// Pause pauses the job queue at the next gate of `unit`.
+func (r *runControl) Pause(unit controlUnit) {
+	r.update(func() {
+		r.paused = true
+		r.unit = unit
+		r.steps = 0
+	})
+}
+
+// Resume lets every gate pass.
+func (r *runControl) Resume() {
+	r.update(func() {
+		r.paused = false
+		r.steps = 0
+	})
+}
+
+// Step pauses the job queue at `unit` and lets one more gate of `unit` pass.
+func (r *runControl) Step(unit controlUnit) {
+	r.update(func() {
+		if !r.paused || r.unit != unit {
+			r.steps = 0
+		}
+
+		r.paused = true
+		r.unit = unit
+		r.steps++
+	})
+}
+
+// SkipLayer ends the layer or logogram being iterated on at its next
+// exchange.
+func (r *runControl) SkipLayer() error {
+	var err error
+
+	r.update(func() {
+		if r.layer == "" {
+			err = errors.New("no layer is being iterated on")
+			return
+		}
+
+		r.skipLayer = true
+	})
+
+	return err
+}
+
+// AbortGeneration discards the generation being evolved at the next gate,
+// and evolves it anew.
+func (r *runControl) AbortGeneration() error {
+	var err error
+
+	r.update(func() {
+		if r.jobStage != stageEvolve {
+			err = errors.New("no generation is being evolved")
+			return
+		}
+
+		r.abortGeneration = true
+	})
+
+	return err
+}
+
+// clearAbort acknowledges an abort once the generation has been discarded.
+func (r *runControl) clearAbort() {
+	r.update(func() {
+		r.abortGeneration = false
+		r.skipLayer = false
+	})
+}
+
+// awaitJob is the gate before a job of stage `sg` runs.
+func (r *runControl) awaitJob(ctx context.Context, sg stage) error {
+	return r.await(ctx, func() (bool, error) {
+		if r.abortGeneration {
+			if sg == stageEvolve {
+				return false, errGenerationAborted
+			}
+
+			// Every generation has been evolved, so there is nothing left
+			// to abort.
+
+			r.abortGeneration = false
+		}
+
+		return r.pass(unitJob), nil
+	})
+}
+
+// awaitExchange is the gate before an exchange is forwarded to the next
+// agent.
+func (r *runControl) awaitExchange(ctx context.Context) error {
+	return r.await(ctx, func() (bool, error) {
+		err := r.interruption()
+		if err != nil {
+			return false, err
+		}
+
+		return r.pass(unitExchange), nil
+	})
+}
+
+// Interrupted reports whether an operator skipped the layer or aborted the
+// generation, without waiting.
+func (r *runControl) Interrupted() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.interruption()
+}
+
+// interruption must be called with the lock held.
+func (r *runControl) interruption() error {
+	switch {
+	case r.abortGeneration:
+		return errGenerationAborted
+	case r.skipLayer:
+		r.skipLayer = false
+		return errLayerSkipped
+	default:
+		return nil
+	}
+}
+
+// pass reports whether a gate of `unit` may be passed, taking a step if
+// needed. It must be called with the lock held.
+func (r *runControl) pass(unit controlUnit) bool {
+	if !r.paused || r.unit != unit {
+		return true
+	}
+
+	if r.steps > 0 {
+		r.steps--
+		return true
+	}
+
+	return false
+}
+
+// await blocks until `check` lets the gate pass or returns an error. `check`
+// is called with the lock held.
+func (r *runControl) await(
+	ctx context.Context,
+	check func() (bool, error),
+) error {
+	for {
+		r.mu.Lock()
+		ok, err := check()
+		changed := r.changed
+		st := r.state()
+		r.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			// Taking a step changes the state.
+			if r.onChange != nil && st.Paused {
+				r.onChange(st)
+			}
+
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func parseControlUnit(r *http.Request) (controlUnit, error) {
+	unit := controlUnit(r.URL.Query().Get("unit"))
+
+	switch unit {
+	case "":
+		return unitJob, nil
+	case unitJob, unitExchange:
+		return unit, nil
+	default:
+		return "", errors.New(`unit must be "job" or "exchange"`)
+	}
+}
+
+func (s *ConlangServer) handleRunState(w http.ResponseWriter, _ *http.Request) {
+	network.WriteJson(w, http.StatusOK, s.run.State())
+}
+
+func (s *ConlangServer) handlePause(w http.ResponseWriter, r *http.Request) {
+	unit, err := parseControlUnit(r)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	s.run.Pause(unit)
+
+	s.logger.Warn("Operator paused the job queue", "unit", unit)
+
+	network.WriteJson(w, http.StatusOK, s.run.State())
+}
+
+func (s *ConlangServer) handleResume(w http.ResponseWriter, _ *http.Request) {
+	s.run.Resume()
+
+	s.logger.Warn("Operator resumed the job queue")
+
+	network.WriteJson(w, http.StatusOK, s.run.State())
+}
+
+func (s *ConlangServer) handleStep(w http.ResponseWriter, r *http.Request) {
+	unit, err := parseControlUnit(r)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	s.run.Step(unit)
+
+	s.logger.Warn("Operator stepped the job queue", "unit", unit)
+
+	network.WriteJson(w, http.StatusOK, s.run.State())
+}
+
+func (s *ConlangServer) handleSkipLayer(w http.ResponseWriter, _ *http.Request) {
+	err := s.run.SkipLayer()
+	if err != nil {
+		network.WriteJson(w, http.StatusConflict, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	s.logger.Warn("Operator skipped the rest of the layer")
+
+	network.WriteJson(w, http.StatusOK, s.run.State())
+}
+
+func (s *ConlangServer) handleAbortGeneration(w http.ResponseWriter, _ *http.Request) {
+	err := s.run.AbortGeneration()
+	if err != nil {
+		network.WriteJson(w, http.StatusConflict, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	s.logger.Warn("Operator aborted the generation")
+
+	network.WriteJson(w, http.StatusOK, s.run.State())
+}
+
+// broadcastRunState shows the run state on displays.
+func (s *ConlangServer) broadcastRunState(st network.RunState) {
+	err := s.ws.InitialData.RecentRunState.Enqueue(st)
+	if err != nil {
+		s.logger.Errorf("failed to save run state to InitialData: %v", err)
+	}
+
+	s.ws.Broadcasters.RunState.Broadcast(st)
+}
+
+// discardGeneration cleans up after an aborted generation, so that nothing
+// it left behind leaks into the next one. The next generation evolves from
+// the last generation that completed.
+func (s *ConlangServer) discardGeneration() {
+	for {
+		select {
+		case <-s.dictUpdatesChan:
+		case <-s.procedureChan:
+		case <-s.moderation:
+		default:
+			gens, err := s.generations.ToSlice()
+			if err == nil && len(gens) > 0 {
+				s.dictionary = gens[len(gens)-1].Dictionary.Copy()
+			}
+
+			s.watchNotes.clear()
+			s.candidates = nil
+
+			s.run.clearAbort()
+
+			s.logger.Warnf(
+				"Generation %d aborted, discarding its changes",
+				s.run.currentGeneration(),
+			)
+
+			return
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunControl(t *testing.T) {
+	// A gate that is still closed once the context ends blocks.
+
+	errBlocked := context.DeadlineExceeded
+
+	type gate struct {
+		await func(ctx context.Context, r *runControl) error
+		want  error
+	}
+
+	var (
+		job = func(want error) gate {
+			return gate{
+				await: func(ctx context.Context, r *runControl) error {
+					return r.awaitJob(ctx, stageEvolve)
+				},
+				want: want,
+			}
+		}
+		finalize = func(want error) gate {
+			return gate{
+				await: func(ctx context.Context, r *runControl) error {
+					return r.awaitJob(ctx, stageFinalize)
+				},
+				want: want,
+			}
+		}
+		exchange = func(want error) gate {
+			return gate{
+				await: func(ctx context.Context, r *runControl) error {
+					return r.awaitExchange(ctx)
+				},
+				want: want,
+			}
+		}
+	)
+
+	tests := []struct {
+		name    string
+		setup   func(r *runControl) error
+		wantErr bool
+		gates   []gate
+	}{
+		{
+			name:  "running",
+			setup: func(r *runControl) error { return nil },
+			gates: []gate{job(nil), exchange(nil), job(nil)},
+		},
+		{
+			name: "paused at jobs",
+			setup: func(r *runControl) error {
+				r.Pause(unitJob)
+				return nil
+			},
+			gates: []gate{exchange(nil), job(errBlocked)},
+		},
+		{
+			name: "paused at exchanges",
+			setup: func(r *runControl) error {
+				r.Pause(unitExchange)
+				return nil
+			},
+			gates: []gate{job(nil), exchange(errBlocked)},
+		},
+		{
+			name: "resumed",
+			setup: func(r *runControl) error {
+				r.Pause(unitJob)
+				r.Resume()
+				return nil
+			},
+			gates: []gate{job(nil), job(nil)},
+		},
+		{
+			name: "stepped twice",
+			setup: func(r *runControl) error {
+				r.Step(unitJob)
+				r.Step(unitJob)
+				return nil
+			},
+			gates: []gate{job(nil), exchange(nil), job(nil), job(errBlocked)},
+		},
+		{
+			name: "stepped at another unit",
+			setup: func(r *runControl) error {
+				r.Step(unitJob)
+				r.Step(unitExchange)
+				return nil
+			},
+			gates: []gate{job(nil), exchange(nil), exchange(errBlocked)},
+		},
+		{
+			name: "layer skipped",
+			setup: func(r *runControl) error {
+				r.enterLayer("phonetics")
+				return r.SkipLayer()
+			},
+			gates: []gate{job(nil), exchange(errLayerSkipped), exchange(nil)},
+		},
+		{
+			name: "skip left with its layer",
+			setup: func(r *runControl) error {
+				r.enterLayer("phonetics")
+				err := r.SkipLayer()
+				r.leaveLayer()
+				return err
+			},
+			gates: []gate{exchange(nil)},
+		},
+		{
+			name:    "skip outside of a layer",
+			setup:   func(r *runControl) error { return r.SkipLayer() },
+			wantErr: true,
+			gates:   []gate{exchange(nil)},
+		},
+		{
+			name: "generation aborted",
+			setup: func(r *runControl) error {
+				r.startJob("iterate-specifications", stageEvolve)
+				r.Pause(unitExchange)
+				return r.AbortGeneration()
+			},
+			gates: []gate{
+				exchange(errGenerationAborted),
+				job(errGenerationAborted),
+				exchange(errGenerationAborted),
+			},
+		},
+		{
+			name: "abort cleared",
+			setup: func(r *runControl) error {
+				r.startJob("iterate-specifications", stageEvolve)
+				err := r.AbortGeneration()
+				r.clearAbort()
+				return err
+			},
+			gates: []gate{job(nil), exchange(nil)},
+		},
+		{
+			name: "abort outside of the evolve stage",
+			setup: func(r *runControl) error {
+				r.startJob("export-data", stageFinalize)
+				return r.AbortGeneration()
+			},
+			wantErr: true,
+			gates:   []gate{job(nil)},
+		},
+		{
+			name: "abort with nothing left to evolve",
+			setup: func(r *runControl) error {
+				r.startJob("update-generations", stageEvolve)
+				return r.AbortGeneration()
+			},
+			gates: []gate{finalize(nil), exchange(nil)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRunControl(0, nil)
+
+			err := tt.setup(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setup error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for i, g := range tt.gates {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				err := g.await(ctx, r)
+				cancel()
+
+				if !errors.Is(err, g.want) {
+					t.Errorf("gate %d error = %v, want %v", i, err, g.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFitnessFunctions score candidate generations, by name and weight,
+// when a pipeline evolves candidates without saying how to score them.
+var DefaultFitnessFunctions = map[string]float64{
+	"stability":      1,
+	"expressiveness": 1,
+	"consistency":    1,
+}
+
+const (
+	DefaultSelection      = "best"
+	DefaultTournamentSize = 2
+)
+
+// fitnessConfig is how the candidates of each generation are scored and
+// selected, as it is written in a pipeline file.
+type fitnessConfig struct {
+	// Candidates is the number of candidate generations evolved from each
+	// parent. It defaults to 1, which accepts every generation as evolved.
+	Candidates int `toml:"candidates"`
+
+	// Functions are the fitness functions that score each candidate, and
+	// their weights.
+	Functions map[string]float64 `toml:"functions"`
+
+	// Selection is the strategy that selects the candidate that becomes
+	// the generation.
+	Selection string `toml:"selection"`
+
+	// TournamentSize is the number of candidates that compete in a
+	// "tournament" selection.
+	TournamentSize int `toml:"tournamentSize"`
+}
+
+// fitness is a validated fitness configuration, with defaults applied.
+type fitness struct {
+	candidates     int
+	functions      map[string]float64
+	selection      string
+	tournamentSize int
+}
+
+func (c fitnessConfig) validate() (fitness, error) {
+	f := fitness{
+		candidates:     c.Candidates,
+		functions:      c.Functions,
+		selection:      c.Selection,
+		tournamentSize: c.TournamentSize,
+	}
+
+	if f.candidates < 0 {
+		return f, fmt.Errorf("candidates must be positive, got %d", c.Candidates)
+	} else if f.candidates == 0 {
+		f.candidates = 1
+	}
+
+	for name, weight := range f.functions {
+		if _, ok := fitnessFunctions[name]; !ok {
+			return f, fmt.Errorf(
+				"unknown fitness function %q, expected one of %s",
+				name,
+				strings.Join(fitnessFunctionNames(), ", "),
+			)
+		}
+
+		if weight <= 0 {
+			return f, fmt.Errorf("weight of %s must be positive, got %g", name, weight)
+		}
+	}
+
+	if len(f.functions) == 0 && f.candidates > 1 {
+		f.functions = DefaultFitnessFunctions
+	}
+
+	if f.selection == "" {
+		f.selection = DefaultSelection
+	}
+
+	if _, ok := selectionStrategies[f.selection]; !ok {
+		return f, fmt.Errorf(
+			"unknown selection %q, expected one of %s",
+			f.selection,
+			strings.Join(slices.Sorted(maps.Keys(selectionStrategies)), ", "),
+		)
+	}
+
+	if f.tournamentSize != 0 && f.selection != "tournament" {
+		return f, errors.New("tournamentSize requires the tournament selection")
+	}
+
+	if f.tournamentSize < 0 || f.tournamentSize > f.candidates {
+		return f, fmt.Errorf(
+			"tournamentSize must be between 1 and candidates, got %d",
+			f.tournamentSize,
+		)
+	} else if f.tournamentSize == 0 {
+		f.tournamentSize = min(DefaultTournamentSize, f.candidates)
+	}
+
+	return f, nil
+}
+
+// fitnessFunction scores `candidate`, which was evolved from `parent`, between
+// 0 and 1. It may also say why it scored the candidate as it did.
+type fitnessFunction func(
+	s *ConlangServer,
+	ctx context.Context,
+	parent, candidate memory.Generation,
+) (float64, string, error)
+
+// fitnessFunctions holds every function that can score a candidate
+// generation, by name.
+var fitnessFunctions = map[string]fitnessFunction{
+	// judge asks the agent with the judge capability to rate the
+	// candidate's specifications and dictionary.
+	"judge": judgeFitness,
+
+	// stability is the share of the parent's dictionary entries that the
+	// candidate kept as they were.
+	"stability": func(_ *ConlangServer, _ context.Context, parent, candidate memory.Generation) (float64, string, error) {
+		if len(parent.Dictionary) == 0 {
+			return 1, "", nil
+		}
+
+		kept := 0
+		for word, entry := range parent.Dictionary {
+			if c, ok := candidate.Dictionary[word]; ok && c.Definition == entry.Definition {
+				kept++
+			}
+		}
+
+		return float64(kept) / float64(len(parent.Dictionary)), "", nil
+	},
+
+	// expressiveness is the share of the candidate's dictionary that its
+	// conversations made use of.
+	"expressiveness": func(_ *ConlangServer, _ context.Context, _, candidate memory.Generation) (float64, string, error) {
+		if len(candidate.Dictionary) == 0 {
+			return 0, "", nil
+		}
+
+		var sb strings.Builder
+		for _, t := range candidate.Transcript {
+			sb.WriteString(t.String())
+		}
+
+		used := countWords(candidate.Dictionary, sb.String())
+
+		return float64(len(used)) / float64(len(candidate.Dictionary)), "", nil
+	},
+
+	// consistency is the share of the candidate's dictionary that its
+	// specifications make use of, so that both describe the same language.
+	"consistency": func(_ *ConlangServer, _ context.Context, _, candidate memory.Generation) (float64, string, error) {
+		if len(candidate.Dictionary) == 0 {
+			return 0, "", nil
+		}
+
+		var sb strings.Builder
+		for _, spec := range candidate.Specifications {
+			sb.WriteString(spec.String())
+		}
+
+		used := countWords(candidate.Dictionary, sb.String())
+
+		return float64(len(used)) / float64(len(candidate.Dictionary)), "", nil
+	},
+}
+
+func judgeFitness(
+	s *ConlangServer,
+	ctx context.Context,
+	_, candidate memory.Generation,
+) (float64, string, error) {
+	var (
+		res memory.ResponseFitness
+		sb  strings.Builder
+	)
+
+	sb.WriteString("Rate this version of the language.\n")
+
+	for _, layer := range slices.Sorted(maps.Keys(candidate.Specifications)) {
+		sb.WriteString(fmt.Sprintf("Here is the specification for %s:\n", layer))
+		sb.WriteString(candidate.Specifications[layer].String())
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("Here is the complete dictionary:\n")
+	sb.WriteString(candidate.Dictionary.String())
+
+	reply, judge, err := s.ask(ctx, systemRequest{
+		role: agent.CapabilityJudge,
+		prepare: func(ctx context.Context, c *network.ChatClient) error {
+			return s.swc(ctx, s.cmd(agent.ClearMemory)(c))
+		},
+		request: s.cmd(agent.RequestFitness, sb.String()),
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = s.resetAgent(ctx, judge)
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = json.Unmarshal([]byte(reply.Text), &res)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "failed to unmarshal fitness")
+	}
+
+	score := min(max(res.Score, 1), 10)
+
+	return float64(score-1) / 9, res.Reason, nil
+}
+
+func fitnessFunctionNames() []string {
+	return slices.Sorted(maps.Keys(fitnessFunctions))
+}
+
+// selectionStrategies select the candidate that becomes the generation, by
+// name. They are given the score of every candidate, and return the index of
+// the one they select.
+var selectionStrategies = map[string]func(scores []float64, f fitness) int{
+	// best selects the candidate with the highest score, or the first of
+	// them on a tie.
+	"best": func(scores []float64, _ fitness) int {
+		return slices.Index(scores, slices.Max(scores))
+	},
+
+	// tournament draws `tournamentSize` candidates at random, and selects
+	// the one with the highest score among them. Weaker candidates win now
+	// and then, which keeps the language from settling too early.
+	"tournament": func(scores []float64, f fitness) int {
+		drawn := rand.Perm(len(scores))[:min(f.tournamentSize, len(scores))]
+		slices.Sort(drawn)
+
+		selected := drawn[0]
+		for _, i := range drawn[1:] {
+			if scores[i] > scores[selected] {
+				selected = i
+			}
+		}
+
+		return selected
+	},
+}
+
+// candidate returns the index of the candidate generation being evolved.
+func (s *ConlangServer) candidate() int {
+	return len(s.candidates)
+}
+
+// selectGeneration adds `g` to the candidates of the generation being
+// evolved. Once every candidate is evolved, it scores them and returns the
+// one that is selected to become the generation. It returns nil while
+// candidates are left to evolve.
+func (s *ConlangServer) selectGeneration(
+	ctx context.Context,
+	g memory.Generation,
+) (*memory.Generation, error) {
+	f := s.config.pipeline.fitness
+
+	s.candidates = append(s.candidates, g)
+
+	if len(s.candidates) < f.candidates {
+		s.logger.Infof("Evolved candidate %d of %d", len(s.candidates), f.candidates)
+		return nil, nil
+	}
+
+	pool := s.candidates
+	s.candidates = nil
+
+	if len(f.functions) == 0 {
+		return &pool[0], nil
+	}
+
+	gens, err := s.generations.ToSlice()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to score candidates")
+	}
+
+	var (
+		parent = gens[len(gens)-1]
+		scores = make([]float64, len(pool))
+		fit    = &memory.Fitness{
+			Selection:  f.selection,
+			Candidates: make([]memory.CandidateFitness, len(pool)),
+		}
+	)
+
+	for i, c := range pool {
+		fit.Candidates[i], err = s.score(ctx, parent, c)
+		if err != nil {
+			return nil, err
+		}
+
+		scores[i] = fit.Candidates[i].Score
+	}
+
+	fit.Selected = selectionStrategies[f.selection](scores, f)
+
+	selected := pool[fit.Selected]
+	selected.Fitness = fit
+
+	s.logger.Info(
+		"Selected candidate",
+		"candidate", fit.Selected+1,
+		"of", len(pool),
+		"score", fmt.Sprintf("%.3f", scores[fit.Selected]),
+		"selection", f.selection,
+	)
+
+	return &selected, nil
+}
+
+// score scores `candidate` with every fitness function of the pipeline. A
+// function that fails, such as a judge that never replies, scores 0.
+func (s *ConlangServer) score(
+	ctx context.Context,
+	parent, candidate memory.Generation,
+) (memory.CandidateFitness, error) {
+	var (
+		f              = s.config.pipeline.fitness
+		cf             = memory.CandidateFitness{Scores: make(map[string]float64)}
+		total, weights float64
+	)
+
+	for _, name := range slices.Sorted(maps.Keys(f.functions)) {
+		score, reason, err := fitnessFunctions[name](s, ctx, parent, candidate)
+		if ctx.Err() != nil {
+			return cf, ctx.Err()
+		}
+
+		if err != nil {
+			s.logger.Warnf("Fitness function %s failed, scoring 0: %v", name, err)
+		}
+
+		if reason != "" {
+			cf.Reason = reason
+		}
+
+		cf.Scores[name] = score
+
+		total += score * f.functions[name]
+		weights += f.functions[name]
+	}
+
+	cf.Score = total / weights
+
+	return cf, nil
+}
+
+// rotate returns `clients` starting from the one at `k`, so that each
+// candidate generation pairs up agents differently.
+func rotate(clients []*network.ChatClient, k int) []*network.ChatClient {
+	if len(clients) == 0 {
+		return clients
+	}
+
+	k %= len(clients)
+
+	return slices.Concat(clients[k:], clients[:k])
+}
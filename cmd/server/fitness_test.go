@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSelectionStrategies(t *testing.T) {
+	tests := []struct {
+		name           string
+		selection      string
+		tournamentSize int
+		scores         []float64
+
+		// want are the candidates that may be selected. Tournaments draw
+		// at random, so they may select any of several.
+		want []int
+	}{
+		{
+			name:      "best",
+			selection: "best",
+			scores:    []float64{0.2, 0.9, 0.5},
+			want:      []int{1},
+		},
+		{
+			name:      "best of a tie",
+			selection: "best",
+			scores:    []float64{0.2, 0.9, 0.9},
+			want:      []int{1},
+		},
+		{
+			name:      "single candidate",
+			selection: "tournament",
+			scores:    []float64{0.4},
+			want:      []int{0},
+		},
+		{
+			name:           "tournament of every candidate",
+			selection:      "tournament",
+			tournamentSize: 3,
+			scores:         []float64{0.2, 0.9, 0.9},
+			want:           []int{1},
+		},
+		{
+			name:           "tournament of two",
+			selection:      "tournament",
+			tournamentSize: 2,
+			scores:         []float64{0.1, 0.5, 0.9},
+			want:           []int{1, 2},
+		},
+		{
+			name:           "tournament of one",
+			selection:      "tournament",
+			tournamentSize: 1,
+			scores:         []float64{0.1, 0.5, 0.9},
+			want:           []int{0, 1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := fitnessConfig{
+				Candidates:     len(tt.scores),
+				Selection:      tt.selection,
+				TournamentSize: tt.tournamentSize,
+			}.validate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for range 50 {
+				got := selectionStrategies[tt.selection](tt.scores, f)
+				if !slices.Contains(tt.want, got) {
+					t.Fatalf("selected candidate %d of %v, want one of %v", got, tt.scores, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -68,40 +68,23 @@ func loadLogographySvgsFromFile(dirPath string) (
 	return svgs, nil
 }
 
-func loadSpecificationsFromFile(p string) (
+// loadSpecificationsFromFile reads the specification of every layer in
+// `layers` from the directory `p`.
+func loadSpecificationsFromFile(p string, layers layerSet) (
 	memory.SpecificationGeneration,
 	error,
 ) {
 	ls := make(memory.SpecificationGeneration)
 
-	b, err := os.ReadFile(filepath.Join(p, "dictionary.md"))
-	if err != nil {
-		return nil, err
-	}
-
-	ls[chat.DictionaryLayer] = chat.Content(b)
-
-	b, err = os.ReadFile(filepath.Join(p, "grammar.md"))
-	if err != nil {
-		return nil, err
-	}
-
-	ls[chat.GrammarLayer] = chat.Content(b)
-
-	b, err = os.ReadFile(filepath.Join(p, "logography.md"))
-	if err != nil {
-		return nil, err
-	}
-
-	ls[chat.LogographyLayer] = chat.Content(b)
+	for _, def := range layers {
+		b, err := os.ReadFile(filepath.Join(p, def.spec))
+		if err != nil {
+			return nil, err
+		}
 
-	b, err = os.ReadFile(filepath.Join(p, "phonetics.md"))
-	if err != nil {
-		return nil, err
+		ls[def.layer] = chat.Content(b)
 	}
 
-	ls[chat.PhoneticsLayer] = chat.Content(b)
-
 	ls[chat.SystemLayer] = ""
 
 	return ls, nil
@@ -129,6 +112,38 @@ func loadDictionaryFromFile(p string) (memory.DictionaryGeneration, error) {
 	return dict, nil
 }
 
+// grpcServerOptions builds the gRPC server's security options from the
+// configuration.
+func grpcServerOptions(cfg securityConfig) ([]network.ServerOption, error) {
+	opts := make([]network.ServerOption, 0)
+
+	if cfg.tlsCert != "" || cfg.tlsKey != "" {
+		tlsCfg, err := network.NewServerTLSConfig(
+			cfg.tlsCert,
+			cfg.tlsKey,
+			cfg.tlsClientCA,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, network.WithTLS(tlsCfg))
+	} else if cfg.tlsClientCA != "" {
+		return nil, errors.New("mutual TLS requires a server certificate and key")
+	}
+
+	if cfg.authTokens != "" {
+		tokens, err := network.LoadAuthTokens(cfg.authTokens)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, network.WithAuthTokens(tokens))
+	}
+
+	return opts, nil
+}
+
 func loadJsonFile[T any](p string) ([]T, error) {
 	var a []T
 
@@ -299,83 +314,123 @@ func (s *ConlangServer) findUsedWordsAgent(
 		emptyDictionary memory.ResponseDictionaryWordsDetection
 	)
 
-	sysAgentDictExtractor, err := s.gs.GetClientByName("SYSTEM_AGENT_C")
-	if err != nil {
-		return emptyDictionary, errors.Wrap(
-			err,
-			"failed to retrieve client by name",
-		)
-	}
-
 	var sb strings.Builder
 
 	sb.WriteString(dict.String())
 
-	err = s.swc(ctx, s.cmd(agent.Latch)(sysAgentDictExtractor))
-	if err != nil {
-		return emptyDictionary, err
-	}
+	words, sysAgentDictExtractor, err := s.ask(ctx, systemRequest{
+		role: agent.CapabilityWordDetector,
+		prepare: func(ctx context.Context, c *network.ChatClient) error {
+			err := s.swc(ctx, s.cmd(agent.Latch)(c))
+			if err != nil {
+				return err
+			}
+
+			err = s.swc(ctx, s.cmd(agent.AppendInstructions, sb.String())(c))
+			if err != nil {
+				return err
+			}
 
-	err = s.swc(ctx, s.cmd(agent.AppendInstructions, sb.String())(sysAgentDictExtractor))
+			return s.swc(ctx, s.cmd(agent.Unlatch)(c))
+		},
+		request: s.cmd(agent.RequestDictionaryWordDetection, text),
+	})
 	if err != nil {
 		return emptyDictionary, err
 	}
 
-	err = s.swc(ctx, s.cmd(agent.Unlatch)(sysAgentDictExtractor))
+	err = json.Unmarshal([]byte(words.Text), &dictionaryWords)
 	if err != nil {
-		return emptyDictionary, err
+		return emptyDictionary, errors.Wrap(
+			err,
+			"failed to unmarshal dictionary words",
+		)
 	}
 
-	err = s.swc(ctx, s.cmd(agent.RequestDictionaryWordDetection, text)(sysAgentDictExtractor))
+	err = s.resetAgent(ctx, sysAgentDictExtractor)
 	if err != nil {
 		return emptyDictionary, err
 	}
 
-	select {
-	case <-ctx.Done():
-		return emptyDictionary, ctx.Err()
-	case words := <-s.gs.Channel.ToServer:
-		err = json.Unmarshal([]byte(words.Text), &dictionaryWords)
-		if err != nil {
-			return emptyDictionary, errors.Wrap(
-				err,
-				"failed to unmarshal dictionary words",
-			)
-		}
-
-		s.resetAgent(ctx, sysAgentDictExtractor)
-
-		return dictionaryWords, nil
-	}
+	return dictionaryWords, nil
 }
 
 // resetAgents resets agents to their initial state. First it latches them,
-// then it clears their memory, then it resets their instructions.
-func (s *ConlangServer) resetAgents(ctx context.Context, clients []*network.ChatClient) {
+// then it clears their memory, then it resets their instructions. It returns
+// once every agent has acknowledged its reset. Memory is not checked to be
+// empty, since a reply that was in flight may still land after the clear.
+func (s *ConlangServer) resetAgents(
+	ctx context.Context,
+	clients []*network.ChatClient,
+) error {
 	for _, client := range clients {
-		s.resetAgent(ctx, client)
+		err := s.sendReset(ctx, client)
+		if err != nil {
+			return err
+		}
 	}
+
+	return s.settle(ctx, clients, network.Latched)
+}
+
+func (s *ConlangServer) resetAgent(ctx context.Context, c *network.ChatClient) error {
+	return s.resetAgents(ctx, []*network.ChatClient{c})
 }
 
-func (s *ConlangServer) resetAgent(ctx context.Context, c *network.ChatClient) {
+func (s *ConlangServer) sendReset(ctx context.Context, c *network.ChatClient) error {
 	var err error
 
 	err = s.swc(ctx, s.cmd(agent.Latch)(c))
 	if err != nil {
-		return
+		return err
 	}
 
 	err = s.swc(ctx, s.cmd(agent.ClearMemory)(c))
 	if err != nil {
-		return
+		return err
 	}
 
 	err = s.swc(ctx, s.cmd(agent.ResetInstructions)(c))
 	if err != nil {
-		return
+		return err
+	}
+
+	return nil
+}
+
+// settle waits until every client has acknowledged the commands dispatched to
+// it and is in a state matching `cond`. It gives up after
+// `DefaultBarrierTimeout`.
+func (s *ConlangServer) settle(
+	ctx context.Context,
+	clients []*network.ChatClient,
+	cond network.StateCondition,
+) error {
+	barrierCtx, cancel := context.WithTimeout(ctx, DefaultBarrierTimeout)
+	defer cancel()
+
+	err := s.gs.Barrier(barrierCtx, clients, cond)
+	if err != nil {
+		return errors.Wrapf(err, "agents %v failed to settle", clients)
 	}
+
+	return nil
 }
 
+// swc sends a message to the clients channel. If the message is a command
+// that requires an acknowledgement, the receiving client is told to expect
+// it before the message is sent, and to forget it if it could not be sent.
 func (s *ConlangServer) swc(ctx context.Context, msg *chat.Message) error {
-	return utils.SendWithContext(ctx, s.gs.Channel.ToClients, msg)
+	c, err := s.gs.GetClientByName(chat.Name(msg.Receiver))
+	expected := err == nil
+	if expected {
+		c.Expect(agent.Command(msg.Command))
+	}
+
+	err = utils.SendWithContext(ctx, s.gs.Channel.ToClients, msg)
+	if err != nil && expected {
+		c.Forget(agent.Command(msg.Command))
+	}
+
+	return err
 }
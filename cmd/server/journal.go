@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/memory"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// syncNever leaves writing journal events to disk to the operating
+	// system. Events survive the server crashing, not the machine.
+	syncNever = "never"
+
+	// syncInterval writes journal events to disk at most every
+	// `journal.syncInterval`, when the next event is appended.
+	syncInterval = "interval"
+
+	// syncAlways writes each journal event to disk as it is appended.
+	syncAlways = "always"
+)
+
+// journal appends the events of a run to a JSONL file as they happen. Every
+// lineage of a run shares its journal. A nil journal records nothing.
+type journal struct {
+	mu       sync.Mutex
+	f        *os.File
+	sync     string
+	interval time.Duration
+	synced   time.Time
+	logger   *log.Logger
+}
+
+// openJournal opens the journal of run `runID` under the outputs directory.
+// It returns nil when the journal is disabled, and when the server replays a
+// run, since a replay records nothing new.
+func openJournal(cfg *config, runID string, l *log.Logger) (*journal, error) {
+	if !cfg.journal.enabled || cfg.replay.path != "" {
+		return nil, nil
+	}
+
+	dir := filepath.Join(cfg.files.outputs, "journal")
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create journal directory")
+	}
+
+	p := filepath.Join(dir, fmt.Sprintf("journal_%s.jsonl", runID))
+
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open journal")
+	}
+
+	l.Infof("Journaling the run to %s", p)
+
+	return &journal{
+		f:        f,
+		sync:     cfg.journal.sync,
+		interval: cfg.journal.syncInterval,
+		synced:   time.Now(),
+		logger:   l,
+	}, nil
+}
+
+// record appends an event of `kind` to the journal. A journal that fails to
+// record an event warns about it, and the run goes on.
+func (j *journal) record(
+	kind memory.JournalKind,
+	lineage string,
+	generation int,
+	data any,
+) {
+	if j == nil {
+		return
+	}
+
+	err := j.append(kind, lineage, generation, data)
+	if err != nil {
+		j.logger.Warnf("failed to journal %s: %v", kind, err)
+	}
+}
+
+func (j *journal) append(
+	kind memory.JournalKind,
+	lineage string,
+	generation int,
+	data any,
+) error {
+	d, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(memory.JournalEvent{
+		Time:       time.Now(),
+		Kind:       kind,
+		Lineage:    lineage,
+		Generation: generation,
+		Data:       d,
+	})
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, err = j.f.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+
+	if j.sync == syncAlways ||
+		j.sync == syncInterval && time.Since(j.synced) >= j.interval {
+		j.synced = time.Now()
+
+		return j.f.Sync()
+	}
+
+	return nil
+}
+
+// close writes what is left of the journal to disk and closes it.
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	err := j.f.Sync()
+	if err != nil {
+		return errors.Wrap(err, "failed to sync journal")
+	}
+
+	return j.f.Close()
+}
+
+// journaledMemory journals every message that is saved to its memory.
+type journaledMemory struct {
+	MemoryService
+	journal *journal
+}
+
+func (m journaledMemory) Save(ctx context.Context, msg memory.Message) error {
+	err := m.MemoryService.Save(ctx, msg)
+	if err != nil {
+		return err
+	}
+
+	kind := memory.JournalMessage
+	if msg.Command != agent.NoCommand {
+		kind = memory.JournalCommand
+	}
+
+	m.journal.record(kind, "", 0, msg)
+
+	return nil
+}
+
+// journalGenerations journals the generations a lineage starts with. The
+// first of `gens` is generation `first`.
+func (s *ConlangServer) journalGenerations(gens []memory.Generation, first int) {
+	for i, g := range gens {
+		s.journal.record(memory.JournalGeneration, s.lineage, first+i, g)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// layerConfig is a layer as it is written in a layers file.
+type layerConfig struct {
+	Name string `toml:"name"`
+
+	// Id is the value agents on the layer set as their `layer`. Built-in
+	// layers have fixed ids and may omit it. Custom layers must set it to
+	// at least `chat.MinCustomLayer`.
+	Id int32 `toml:"id"`
+
+	// Spec is the layer's specification file, relative to the
+	// specifications directory. It defaults to `<name>.md`.
+	Spec string `toml:"spec"`
+
+	// DependsOn are the layers whose specifications agents on the layer
+	// are given. Dependencies must be listed before the layer.
+	DependsOn []string `toml:"dependsOn"`
+
+	// Instructions are appended to the instructions of agents on the layer.
+	Instructions string `toml:"instructions"`
+
+	// Hook is run after the layer's specification is written.
+	Hook string `toml:"hook"`
+
+	// Turns is the turn policy of the layer's conversation. It defaults to
+	// `DefaultTurnPolicy`.
+	Turns string `toml:"turns"`
+
+	// End is how the layer's conversation ends. It defaults to
+	// `DefaultEndMode`.
+	End string `toml:"end"`
+
+	// MinExchanges is how many exchanges run before the conversation may
+	// end on consensus.
+	MinExchanges int `toml:"minExchanges"`
+
+	// JudgeEvery is how many exchanges pass between the moderator's
+	// judgements when the conversation ends on the moderator. It defaults
+	// to `DefaultJudgeEvery`.
+	JudgeEvery int `toml:"judgeEvery"`
+
+	// TimeLimit ends the conversation once it has run this long, such as
+	// "15m".
+	TimeLimit string `toml:"timeLimit"`
+}
+
+// layersConfig is the layout of a layers file.
+type layersConfig struct {
+	Layers []layerConfig `toml:"layer"`
+}
+
+// layerDefinition is a validated layer.
+type layerDefinition struct {
+	layer chat.Layer
+	spec  string
+
+	// dependsOn are the layer's direct dependencies.
+	dependsOn    []chat.Layer
+	instructions string
+	hook         string
+	turns        string
+	termination  termination
+}
+
+// layerSet holds the layers a server evolves, in the order they were defined.
+// Every layer comes after its dependencies.
+type layerSet []layerDefinition
+
+// layerHook runs after the specification of `layer` is written to `g`.
+type layerHook func(
+	s *ConlangServer,
+	ctx context.Context,
+	layer chat.Layer,
+	g memory.Generation,
+)
+
+// layerHooks holds every hook a layer can run, by name.
+var layerHooks = map[string]layerHook{
+	"update-dictionary": func(
+		s *ConlangServer,
+		ctx context.Context,
+		layer chat.Layer,
+		g memory.Generation,
+	) {
+		s.iterateUpdateDictionary(ctx, layer, g)
+	},
+}
+
+// defaultLayersConfig are the layers that are evolved when no layers file is
+// given.
+func defaultLayersConfig() layersConfig {
+	return layersConfig{
+		Layers: []layerConfig{
+			{Name: "phonetics"},
+			{Name: "grammar", DependsOn: []string{"phonetics"}},
+			{
+				Name:      "dictionary",
+				DependsOn: []string{"grammar"},
+				Instructions: "Do not discuss the structure of the" +
+					" dictionary. Rather, " +
+					"discuss the words and enhancements that may need to be made to" +
+					" them.",
+				Hook: "update-dictionary",
+			},
+			{Name: "logography", DependsOn: []string{"dictionary"}},
+		},
+	}
+}
+
+// loadLayers reads and validates a layers file, and registers its custom
+// layers. An empty path returns the default layers.
+func loadLayers(p string) (layerSet, error) {
+	if p == "" {
+		return defaultLayersConfig().validate()
+	}
+
+	var cfg layersConfig
+
+	md, err := toml.DecodeFile(p, &cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load layers file %s", p)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, errors.Errorf(
+			"layers file %s has unknown keys: %v",
+			p,
+			undecoded,
+		)
+	}
+
+	ls, err := cfg.validate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid layers file %s", p)
+	}
+
+	return ls, nil
+}
+
+func (c layersConfig) validate() (layerSet, error) {
+	if len(c.Layers) == 0 {
+		return nil, errors.New("no layers are defined")
+	}
+
+	ls := make(layerSet, 0, len(c.Layers))
+
+	for i, lc := range c.Layers {
+		def, err := lc.validate(ls)
+		if err != nil {
+			return nil, errors.Wrapf(err, "layer[%d]", i)
+		}
+
+		ls = append(ls, def)
+	}
+
+	// The hook runs while its layer is evolved, and the dictionary updates
+	// of a generation are applied at once by `iterate-dictionary`, which
+	// only has room for those of one layer.
+
+	if hooked := ls.withHook("update-dictionary"); len(hooked) > 1 {
+		return nil, errors.Errorf(
+			"layers %v all run the update-dictionary hook, at most one may",
+			hooked,
+		)
+	}
+
+	return ls, nil
+}
+
+// validate checks a layer against the layers defined before it.
+func (c layerConfig) validate(defined layerSet) (layerDefinition, error) {
+	def := layerDefinition{
+		spec:         c.Spec,
+		instructions: c.Instructions,
+		hook:         c.Hook,
+		turns:        c.Turns,
+		termination: termination{
+			mode:         c.End,
+			minExchanges: c.MinExchanges,
+			judgeEvery:   c.JudgeEvery,
+		},
+	}
+
+	if c.Name == "" {
+		return def, errors.New("layer requires a name")
+	}
+
+	l, err := chat.ParseLayer(c.Name)
+
+	switch {
+	case err == nil && !l.Custom():
+		if c.Id != 0 && chat.Layer(c.Id) != l {
+			return def, fmt.Errorf(
+				"layer %s is built in with id %d, got %d",
+				c.Name,
+				l,
+				c.Id,
+			)
+		}
+
+		if l == chat.SystemLayer || l == chat.ChattingLayer {
+			return def, fmt.Errorf("layer %s has no specification", l)
+		}
+	default:
+		l = chat.Layer(c.Id)
+
+		err = chat.RegisterLayer(l, c.Name)
+		if err != nil {
+			return def, err
+		}
+	}
+
+	def.layer = l
+
+	if defined.get(l) != nil {
+		return def, fmt.Errorf("layer %s is defined more than once", l)
+	}
+
+	if def.spec == "" {
+		def.spec = c.Name + ".md"
+	}
+
+	for _, name := range c.DependsOn {
+		dep, err := chat.ParseLayer(name)
+		if err != nil || defined.get(dep) == nil {
+			return def, fmt.Errorf(
+				"layer %s depends on %s, which must be defined before it",
+				l,
+				name,
+			)
+		}
+
+		def.dependsOn = append(def.dependsOn, dep)
+	}
+
+	if _, ok := layerHooks[def.hook]; def.hook != "" && !ok {
+		return def, fmt.Errorf(
+			"unknown hook %q, expected one of %s",
+			def.hook,
+			strings.Join(hookNames(), ", "),
+		)
+	}
+
+	if def.turns == "" {
+		def.turns = DefaultTurnPolicy
+	}
+
+	if _, ok := turnPolicies[def.turns]; !ok {
+		return def, fmt.Errorf(
+			"unknown turn policy %q, expected one of %s",
+			def.turns,
+			strings.Join(turnPolicyNames(), ", "),
+		)
+	}
+
+	if def.termination.mode == "" {
+		def.termination.mode = DefaultEndMode
+	}
+
+	if def.termination.mode == endOnModerator && def.termination.judgeEvery == 0 {
+		def.termination.judgeEvery = DefaultJudgeEvery
+	}
+
+	if c.TimeLimit != "" {
+		d, err := time.ParseDuration(c.TimeLimit)
+		if err != nil {
+			return def, errors.Wrap(err, "invalid timeLimit")
+		}
+
+		def.termination.timeLimit = d
+	}
+
+	err = def.termination.validate()
+	if err != nil {
+		return def, err
+	}
+
+	return def, nil
+}
+
+func hookNames() []string {
+	names := make([]string, 0, len(layerHooks))
+	for k := range layerHooks {
+		names = append(names, k)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// get returns the definition of `l`, or nil when `l` is not in the set.
+func (ls layerSet) get(l chat.Layer) *layerDefinition {
+	for i := range ls {
+		if ls[i].layer == l {
+			return &ls[i]
+		}
+	}
+
+	return nil
+}
+
+// layers returns every layer of the set, in order.
+func (ls layerSet) layers() []chat.Layer {
+	layers := make([]chat.Layer, 0, len(ls))
+	for _, def := range ls {
+		layers = append(layers, def.layer)
+	}
+
+	return layers
+}
+
+// context returns `l` followed by every layer it depends on, directly or
+// not. Closer dependencies come first.
+func (ls layerSet) context(l chat.Layer) []chat.Layer {
+	var (
+		visited = []chat.Layer{l}
+		queue   = []chat.Layer{l}
+	)
+
+	for len(queue) > 0 {
+		def := ls.get(queue[0])
+		queue = queue[1:]
+
+		if def == nil {
+			continue
+		}
+
+		for _, dep := range def.dependsOn {
+			if !slices.Contains(visited, dep) {
+				visited = append(visited, dep)
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	return visited
+}
+
+// withHook returns the layers that run `hook`.
+func (ls layerSet) withHook(hook string) []chat.Layer {
+	var layers []chat.Layer
+
+	for _, def := range ls {
+		if def.hook == hook {
+			layers = append(layers, def.layer)
+		}
+	}
+
+	return layers
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLayersConfig_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		layers  []layerConfig
+		wantErr bool
+	}{
+		{
+			name:   "default layers",
+			layers: defaultLayersConfig().Layers,
+		},
+		{
+			name:    "no layers",
+			wantErr: true,
+		},
+		{
+			name: "dependency defined later",
+			layers: []layerConfig{
+				{Name: "grammar", DependsOn: []string{"phonetics"}},
+				{Name: "phonetics"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown hook",
+			layers: []layerConfig{
+				{Name: "phonetics", Hook: "update-grammar"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "two dictionary hooks",
+			layers: []layerConfig{
+				{Name: "grammar", Hook: "update-dictionary"},
+				{Name: "dictionary", Hook: "update-dictionary"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := layersConfig{Layers: tt.layers}.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLayerConfig_validate_termination(t *testing.T) {
+	tests := []struct {
+		name    string
+		layer   layerConfig
+		want    termination
+		wantErr bool
+	}{
+		{
+			name:  "default end mode",
+			layer: layerConfig{Name: "phonetics"},
+			want:  termination{mode: DefaultEndMode},
+		},
+		{
+			name:  "default judgeEvery",
+			layer: layerConfig{Name: "phonetics", End: endOnModerator, MinExchanges: 2},
+			want:  termination{mode: endOnModerator, minExchanges: 2, judgeEvery: DefaultJudgeEvery},
+		},
+		{
+			name:  "judgeEvery",
+			layer: layerConfig{Name: "phonetics", End: endOnModerator, JudgeEvery: 1},
+			want:  termination{mode: endOnModerator, judgeEvery: 1},
+		},
+		{
+			name:  "consensus",
+			layer: layerConfig{Name: "phonetics", End: endOnConsensus, MinExchanges: 2},
+			want:  termination{mode: endOnConsensus, minExchanges: 2},
+		},
+		{
+			name:    "judgeEvery without a moderator",
+			layer:   layerConfig{Name: "phonetics", End: endOnConsensus, JudgeEvery: 2},
+			wantErr: true,
+		},
+		{
+			name:    "negative judgeEvery",
+			layer:   layerConfig{Name: "phonetics", End: endOnModerator, JudgeEvery: -1},
+			wantErr: true,
+		},
+		{
+			name:    "minExchanges when ending on exchanges",
+			layer:   layerConfig{Name: "phonetics", MinExchanges: 2},
+			wantErr: true,
+		},
+		{
+			name:    "unknown end mode",
+			layer:   layerConfig{Name: "phonetics", End: "silence"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, err := tt.layer.validate(nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && def.termination != tt.want {
+				t.Errorf("validate() termination = %+v, want %+v", def.termination, tt.want)
+			}
+		})
+	}
+}
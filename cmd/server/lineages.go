@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+	"codeberg.org/n30w/jasima/pkg/utils"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultLineage is the ID of the lineage a server starts evolving. Agents
+// that do not declare a lineage take part in it.
+const DefaultLineage = "main"
+
+var lineageID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// lineages are the lineages of the evolution that run side by side under one
+// server, by ID. Each lineage is a `ConlangServer` with its own generations,
+// job queue, run control and web events. Lineages share the gRPC server, the
+// admin API and the message memory of the main lineage.
+type lineages struct {
+	mu   sync.Mutex
+	byID map[string]*ConlangServer
+
+	// ctx is that of the main lineage's run, so that forks stop with it.
+	ctx context.Context
+}
+
+func newLineages() *lineages {
+	return &lineages{byID: make(map[string]*ConlangServer)}
+}
+
+func (l *lineages) add(s *ConlangServer) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.byID[s.lineage]; ok {
+		return errors.Errorf("lineage %s already exists", s.lineage)
+	}
+
+	l.byID[s.lineage] = s
+
+	return nil
+}
+
+func (l *lineages) get(id string) (*ConlangServer, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.byID[id]
+
+	return s, ok
+}
+
+// all returns every lineage, ordered by ID.
+func (l *lineages) all() []*ConlangServer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	all := make([]*ConlangServer, 0, len(l.byID))
+	for _, s := range l.byID {
+		all = append(all, s)
+	}
+
+	slices.SortFunc(all, func(a, b *ConlangServer) int {
+		return strings.Compare(a.lineage, b.lineage)
+	})
+
+	return all
+}
+
+// of returns the lineage that client `name` takes part in. It returns nil
+// when the client is not connected, or its lineage has not been forked.
+func (l *lineages) of(gs *network.ChatServer, name chat.Name) *ConlangServer {
+	c, err := gs.GetClientByName(name)
+	if err != nil {
+		return nil
+	}
+
+	s, _ := l.get(lineageOf(c))
+
+	return s
+}
+
+// lineageOf returns the lineage client `c` takes part in.
+func lineageOf(c *network.ChatClient) string {
+	if id := c.Registration().Lineage; id != "" {
+		return id
+	}
+
+	return DefaultLineage
+}
+
+// inLineage returns the clients of `clients` that take part in the server's
+// lineage.
+func (s *ConlangServer) inLineage(clients []*network.ChatClient) []*network.ChatClient {
+	return slices.DeleteFunc(clients, func(c *network.ChatClient) bool {
+		return lineageOf(c) != s.lineage
+	})
+}
+
+// clients returns the connected agents of the server's lineage.
+func (s *ConlangServer) clients() []*network.ChatClient {
+	return s.inLineage(s.gs.Clients())
+}
+
+// clientsByLayer returns the clients of the server's lineage that speak on
+// layer `l`.
+func (s *ConlangServer) clientsByLayer(l chat.Layer) []*network.ChatClient {
+	return s.config.roster.withRole(roleSpeaker, s.inLineage(s.gs.GetClientsByLayer(l)))
+}
+
+// clientsByCapability returns the clients of the server's lineage that fulfill
+// role `c`.
+func (s *ConlangServer) clientsByCapability(c agent.Capability) []*network.ChatClient {
+	return s.config.roster.withRole(c, s.inLineage(s.gs.GetClientsByCapability(c)))
+}
+
+// fork creates a lineage that evolves on from a generation of another
+// lineage, and starts evolving it.
+func (s *ConlangServer) fork(req network.AdminForkRequest) (*ConlangServer, error) {
+	if !lineageID.MatchString(req.ID) {
+		return nil, errors.Errorf(
+			"lineage %q must be lowercase letters, digits and dashes", req.ID,
+		)
+	}
+
+	if req.From == "" {
+		req.From = DefaultLineage
+	}
+
+	from, ok := s.lineages.get(req.From)
+	if !ok {
+		return nil, errors.Errorf("lineage %s does not exist", req.From)
+	}
+
+	gens, err := from.generations.ToSlice()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read generations")
+	}
+
+	// Only the generations kept in memory can be forked from.
+
+	at := req.Generation
+	if at < from.flushed || at >= from.flushed+len(gens) {
+		return nil, errors.Errorf(
+			"lineage %s keeps generations %d to %d, not %d",
+			req.From,
+			from.flushed,
+			from.flushed+len(gens)-1,
+			at,
+		)
+	}
+
+	gens = gens[:at-from.flushed+1]
+
+	cfg := *from.config
+	cfg.resume = ""
+
+	if req.Layers != "" {
+		if req.Pipeline == "" {
+			return nil, errors.New("a lineage with its own layers needs its own pipeline")
+		}
+
+		cfg.layers, err = loadLayers(req.Layers)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.settings.Layers = req.Layers
+	}
+
+	if req.Pipeline != "" {
+		cfg.pipeline, err = loadPipeline(req.Pipeline, cfg.layers)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.settings.Pipeline = req.Pipeline
+	}
+
+	// A fork of a lineage that evolves forever evolves forever too, unless
+	// it is given a number of generations.
+
+	n := req.Generations
+	if n <= 0 {
+		n = from.config.procedures.maxGenerations
+	}
+
+	cfg.procedures.maxGenerations = 0
+	if n > 0 {
+		cfg.procedures.maxGenerations = at + n
+	}
+
+	generations, dropped, err := newGenerationWindow(cfg.procedures, gens)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to enqueue forked generations")
+	}
+
+	gens = gens[dropped:]
+
+	ws, err := network.NewWebFeeds(s.logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create web events")
+	}
+
+	err = ws.InitialData.RecentSpecifications.Enqueue(gens[len(gens)-1].Specifications)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to enqueue specifications")
+	}
+
+	err = ws.InitialData.RecentGenerations.Enqueue(gens...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to enqueue forked generations")
+	}
+
+	f := &ConlangServer{
+		name:            s.name,
+		logger:          s.logger.With("lineage", req.ID),
+		memory:          s.memory,
+		gs:              s.gs,
+		config:          &cfg,
+		procedureChan:   make(chan memory.Message, 100),
+		moderation:      make(chan memory.Message, 10),
+		dictUpdatesChan: make(chan memory.ResponseDictionaryEntries, 1),
+		jobsChan:        make(chan utils.Queue[[]job], 100),
+		dictionary:      gens[len(gens)-1].Dictionary.Copy(),
+		generations:     generations,
+		flushed:         from.flushed + dropped,
+		ws:              ws,
+		admin:           s.admin,
+		replies:         s.replies,
+		errs:            make(chan error),
+		runID:           s.runID + "_" + req.ID,
+		cmd:             s.cmd,
+		lineage:         req.ID,
+		parent:          req.From,
+		forkedAt:        at,
+		lineages:        s.lineages,
+		record:          newRunRecord(),
+		journal:         s.journal,
+	}
+
+	f.run = newRunControl(at, f.broadcastRunState)
+
+	err = ws.InitialData.RecentRunState.Enqueue(f.run.State())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to enqueue run state")
+	}
+
+	err = s.lineages.add(f)
+	if err != nil {
+		return nil, err
+	}
+
+	f.journalGenerations(gens, f.flushed)
+
+	s.logger.Info(
+		"Forked lineage",
+		"lineage", f.lineage,
+		"from", req.From,
+		"generation", at,
+		"generations", n,
+	)
+
+	// A failing fork stops evolving, and leaves the other lineages be.
+
+	go func() {
+		for err := range f.errs {
+			f.logger.Errorf("lineage stopped: %v", err)
+		}
+	}()
+
+	go f.evolve(s.lineages.ctx)
+
+	return f, nil
+}
+
+// info describes the server's lineage to an operator.
+func (s *ConlangServer) info() network.LineageInfo {
+	st := s.run.snapshot()
+
+	return network.LineageInfo{
+		ID:             s.lineage,
+		Parent:         s.parent,
+		ForkedAt:       s.forkedAt,
+		Generation:     st.Generation,
+		MaxGenerations: s.config.procedures.maxGenerations,
+		Job:            st.Job,
+		Clients:        len(s.clients()),
+	}
+}
+
+// lineageHandler serves `h` on the lineage named by the request's `lineage`
+// query parameter, or on the main lineage when there is none.
+func (s *ConlangServer) lineageHandler(
+	h func(*ConlangServer, http.ResponseWriter, *http.Request),
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := s
+
+		if id := r.URL.Query().Get("lineage"); id != "" {
+			var ok bool
+
+			l, ok = s.lineages.get(id)
+			if !ok {
+				network.WriteJson(
+					w,
+					http.StatusNotFound,
+					network.AdminError{Error: "unknown lineage " + id},
+				)
+				return
+			}
+		}
+
+		h(l, w, r)
+	})
+}
+
+func (s *ConlangServer) handleLineages(w http.ResponseWriter, _ *http.Request) {
+	all := s.lineages.all()
+
+	infos := make([]network.LineageInfo, 0, len(all))
+	for _, l := range all {
+		infos = append(infos, l.info())
+	}
+
+	network.WriteJson(w, http.StatusOK, infos)
+}
+
+func (s *ConlangServer) handleFork(w http.ResponseWriter, r *http.Request) {
+	var req network.AdminForkRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	f, err := s.fork(req)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	network.WriteJson(w, http.StatusCreated, f.info())
+}
+
+// handleLineageFeed serves the web events of a lineage under
+// `/lineages/{id}/`.
+func (s *ConlangServer) handleLineageFeed(w http.ResponseWriter, r *http.Request) {
+	l, ok := s.lineages.get(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	feed, ok := l.feeds()["/"+r.PathValue("feed")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	feed(w, r)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/pkg/errors"
+)
+
+// logogramPair is a generator and an adversary that iterate on the logogram
+// of one word at a time.
+type logogramPair struct {
+	generator *network.ChatClient
+	adversary *network.ChatClient
+}
+
+// logogramPairs pairs every logogram generator with an adversary, both in
+// name order. Each candidate generation starts pairing from a different
+// adversary. Agents left without a partner are not used.
+func (s *ConlangServer) logogramPairs() ([]logogramPair, error) {
+	var (
+		generators  = s.clientsByCapability(agent.CapabilityLogogramGenerator)
+		adversaries = rotate(
+			s.clientsByCapability(agent.CapabilityLogogramAdversary),
+			s.candidate(),
+		)
+		n = min(len(generators), len(adversaries))
+	)
+
+	if n == 0 {
+		return nil, errors.Errorf(
+			"logograms require a %s and a %s, found %d and %d",
+			agent.CapabilityLogogramGenerator,
+			agent.CapabilityLogogramAdversary,
+			len(generators),
+			len(adversaries),
+		)
+	}
+
+	if len(generators) != len(adversaries) {
+		s.logger.Warnf(
+			"Found %d logogram generators and %d adversaries, using %d pairs",
+			len(generators),
+			len(adversaries),
+			n,
+		)
+	}
+
+	pairs := make([]logogramPair, n)
+	for i := range pairs {
+		pairs[i] = logogramPair{generator: generators[i], adversary: adversaries[i]}
+	}
+
+	return pairs, nil
+}
+
+// iterateWords iterates on the logograms of `words` with every pair at once,
+// each pair taking the next word once it is done with one. It returns the
+// SVGs in the order of `words`, with an empty SVG for words that were not
+// iterated on. Skipping the logograms stops every pair, and keeps the words
+// that were done.
+func (s *ConlangServer) iterateWords(
+	ctx context.Context,
+	pairs []logogramPair,
+	words []string,
+	iterate func(
+		ctx context.Context,
+		word string,
+		pair logogramPair,
+		progress *sync.Mutex,
+	) (string, error),
+) ([]string, error) {
+	poolCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		progress sync.Mutex
+		queue    = make(chan int)
+		svgs     = make([]string, len(words))
+		errs     = make([]error, len(pairs))
+	)
+
+	for p, pair := range pairs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				svg, err := iterate(poolCtx, words[i], pair, &progress)
+
+				// A skipped word keeps what it had.
+
+				if err == nil || errors.Is(err, errLayerSkipped) {
+					svgs[i] = svg
+				}
+
+				if err != nil {
+					errs[p] = err
+					cancel()
+
+					return
+				}
+			}
+		}()
+	}
+
+queue:
+	for i, word := range words {
+		if word == "" {
+			continue
+		}
+
+		select {
+		case <-poolCtx.Done():
+			break queue
+		case queue <- i:
+		}
+	}
+
+	close(queue)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return svgs, ctx.Err()
+	}
+
+	if poolCtx.Err() == nil {
+		return svgs, nil
+	}
+
+	// Pairs that were stopped by another pair were cut off mid-word, and
+	// are put back.
+
+	for _, pair := range pairs {
+		err := s.resetAgents(
+			ctx,
+			[]*network.ChatClient{pair.generator, pair.adversary},
+		)
+		if err != nil {
+			return svgs, err
+		}
+	}
+
+	// Pairs that were stopped by another pair report the cancellation,
+	// which is not the cause.
+
+	for _, err := range errs {
+		switch {
+		case err == nil, errors.Is(err, context.Canceled):
+		case errors.Is(err, errLayerSkipped):
+			s.logger.Warnf("Skipped the rest of the logograms")
+		default:
+			return svgs, err
+		}
+	}
+
+	return svgs, nil
+}
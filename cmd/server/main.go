@@ -6,6 +6,7 @@
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
@@ -18,91 +19,225 @@
 
 func main() {
 	var (
-		flagDebug = flag.Bool(
-			"debug",
-			DefaultDebugToggle,
-			"debug mode, extra logging",
+		flagConfig = flag.String(
+			"config",
+			DefaultConfigPath,
+			"path to TOML file configuring the server, overridden by JASIMA_* variables and flags",
 		)
-		flagLogToFile = flag.Bool(
-			"logToFile",
-			DefaultLogToFileToggle,
-			"also logs output to file",
-		)
-		flagSpecificationPath = flag.String(
-			"specPath",
-			DefaultSpecResourcePath,
-			"path to directory containing specifications",
-		)
-		flagDictionaryJsonPath = flag.String(
-			"dictPath",
-			DefaultDictionaryJsonPath,
-			"path to initial json dictionary",
-		)
-		flagExchanges = flag.Int(
-			"exchanges",
-			DefaultMaxExchanges,
-			"total exchanges between agents per layer",
-		)
-		flagDictExtractMethod = flag.Int(
-			"dictionaryExtractMethod",
-			DefaultDictionaryExtractionMethod,
-			"dictionary extraction method",
-		)
-		flagGenerations = flag.Int(
-			"generations",
-			DefaultMaxGenerations,
-			"maximum number of generations in evolution",
-		)
-		flagSvgPath = flag.String(
-			"svgPath",
-			DefaultSvgResourcePath,
-			"path to svg files of the Toki Pona logography",
-		)
-		flagServerName = flag.String(
-			"name",
-			DefaultServerName,
-			"server name",
-		)
-		flagBroadcastTestData = flag.Bool(
-			"broadcastTestData",
-			DefaultBroadcastTestData,
-			"broadcast test data for web events",
-		)
-		flagExportData = flag.Bool(
-			"exportData",
-			DefaultExportData,
-			"export data after a job queue is complete",
+		flagPrintConfig = flag.Bool(
+			"printConfig",
+			DefaultPrintConfig,
+			"print the resolved configuration and exit",
 		)
 	)
 
+	// Every other flag is read by `loadSettings`, so that it only takes
+	// precedence over the configuration file and the environment when set.
+
+	flag.Bool(
+		"debug",
+		DefaultDebugToggle,
+		"debug mode, extra logging",
+	)
+	flag.Bool(
+		"logToFile",
+		DefaultLogToFileToggle,
+		"also logs output to file",
+	)
+	flag.String(
+		"specPath",
+		DefaultSpecResourcePath,
+		"path to directory containing specifications",
+	)
+	flag.String(
+		"dictPath",
+		DefaultDictionaryJsonPath,
+		"path to initial json dictionary",
+	)
+	flag.Int(
+		"exchanges",
+		DefaultMaxExchanges,
+		"total exchanges between agents per layer",
+	)
+	flag.Int(
+		"dictionaryExtractMethod",
+		DefaultDictionaryExtractionMethod,
+		"dictionary extraction method",
+	)
+	flag.Int(
+		"generations",
+		DefaultMaxGenerations,
+		"maximum number of generations in evolution, 0 evolves forever",
+	)
+	flag.String(
+		"svgPath",
+		DefaultSvgResourcePath,
+		"path to svg files of the Toki Pona logography",
+	)
+	flag.String(
+		"name",
+		DefaultServerName,
+		"server name",
+	)
+	flag.Bool(
+		"broadcastTestData",
+		DefaultBroadcastTestData,
+		"broadcast test data for web events",
+	)
+	flag.Bool(
+		"exportData",
+		DefaultExportData,
+		"export data after a job queue is complete",
+	)
+	flag.String(
+		"tlsCert",
+		DefaultTLSCert,
+		"path to the gRPC server's TLS certificate",
+	)
+	flag.String(
+		"tlsKey",
+		DefaultTLSKey,
+		"path to the gRPC server's TLS key",
+	)
+	flag.String(
+		"tlsClientCA",
+		DefaultTLSClientCA,
+		"path to the CA of agent certificates, enables mutual TLS",
+	)
+	flag.String(
+		"authTokens",
+		DefaultAuthTokensPath,
+		"path to TOML file of agent names to auth tokens",
+	)
+	flag.String(
+		"adminPort",
+		DefaultAdminPort,
+		"port of the admin API",
+	)
+	flag.String(
+		"adminToken",
+		DefaultAdminToken,
+		"bearer token required by the admin API",
+	)
+	flag.String(
+		"pipeline",
+		DefaultPipelinePath,
+		"path to TOML file describing the evolution pipeline",
+	)
+	flag.String(
+		"checkpointDir",
+		DefaultCheckpointPath,
+		"directory to save a checkpoint to after each job, empty disables",
+	)
+	flag.String(
+		"layers",
+		DefaultLayersPath,
+		"path to TOML file defining the layers to evolve",
+	)
+	flag.String(
+		"resume",
+		DefaultResumePath,
+		"path to a checkpoint or generations json file to resume from",
+	)
+	flag.Duration(
+		"replyTimeout",
+		DefaultReplyTimeout,
+		"how long to wait for an agent to reply before nudging it",
+	)
+	flag.Int(
+		"replyRetries",
+		DefaultReplyRetries,
+		"nudges sent to a silent agent before falling back to another",
+	)
+	flag.Int(
+		"moderatorMaxLength",
+		DefaultModeratorMaxLength,
+		"most characters a moderator message may have",
+	)
+	flag.Int(
+		"moderatorRate",
+		DefaultModeratorRate,
+		"moderator messages each address may send a minute, 0 turns them away",
+	)
+	flag.Int(
+		"retainGenerations",
+		DefaultRetainGenerations,
+		"recent generations kept in memory, older ones are flushed to disk",
+	)
+	flag.Int(
+		"exportEvery",
+		DefaultExportEvery,
+		"export data every so many generations, 0 turns it off",
+	)
+	flag.Duration(
+		"exportInterval",
+		DefaultExportInterval,
+		"export data once this long has passed, 0 turns it off",
+	)
+	flag.Bool(
+		"journal",
+		DefaultJournal,
+		"append the events of the run to a journal as they happen",
+	)
+	flag.String(
+		"journalSync",
+		DefaultJournalSync,
+		"when journal events are written to disk: never, interval or always",
+	)
+	flag.Duration(
+		"journalSyncInterval",
+		DefaultJournalSyncInterval,
+		"how often journal events are written to disk with the interval policy",
+	)
+	flag.String(
+		"replay",
+		DefaultReplayPath,
+		"outputs directory of a recorded run to replay rather than evolve",
+	)
+	flag.String(
+		"replayRun",
+		DefaultReplayRun,
+		"run of the replayed directory to replay, defaults to its latest",
+	)
+	flag.Float64(
+		"replaySpeed",
+		DefaultReplaySpeed,
+		"how many times faster than it happened a run is replayed",
+	)
+	flag.Bool(
+		"replayLoop",
+		DefaultReplayLoop,
+		"replay the run again from the start once it ends",
+	)
+
 	flag.Parse()
 
-	logOptions := log.Options{
+	logger := log.NewWithOptions(os.Stderr, log.Options{
 		ReportTimestamp: true,
+	})
+
+	st, err := loadSettings(*flagConfig)
+	if err != nil {
+		logger.Fatal(err)
 	}
 
-	if *flagDebug {
-		logOptions.Level = log.DebugLevel
-		logOptions.ReportCaller = true
+	if st.Debug {
+		logger.SetLevel(log.DebugLevel)
+		logger.SetReportCaller(true)
 	}
 
-	logger := log.NewWithOptions(os.Stderr, logOptions)
-
-	cfg := &config{
-		name:              *flagServerName,
-		debugEnabled:      *flagDebug,
-		broadcastTestData: *flagBroadcastTestData,
-		files: filePathConfig{
-			specifications: *flagSpecificationPath,
-			logography:     *flagSvgPath,
-			dictionary:     *flagDictionaryJsonPath,
-		},
-		procedures: procedureConfig{
-			maxExchanges:                   *flagExchanges,
-			maxGenerations:                 *flagGenerations,
-			dictionaryWordExtractionMethod: dictExtractMethod(*flagDictExtractMethod),
-			exportData:                     *flagExportData,
-		},
+	cfg, err := st.config()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if *flagPrintConfig {
+		err = st.print(os.Stdout)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		return
 	}
 
 	logger.Info(
@@ -110,9 +245,11 @@ func main() {
 		"debug",
 		cfg.debugEnabled,
 		"logToFile",
-		*flagLogToFile,
+		st.LogToFile,
 		"specs",
 		cfg.files.specifications,
+		"outputs",
+		cfg.files.outputs,
 		"exchanges",
 		cfg.procedures.maxExchanges,
 		"generations",
@@ -125,6 +262,42 @@ func main() {
 		cfg.procedures.exportData,
 		"dictionaryExtractionMethod",
 		cfg.procedures.dictionaryWordExtractionMethod,
+		"tls",
+		cfg.security.tlsCert != "",
+		"mtls",
+		cfg.security.tlsClientCA != "",
+		"auth",
+		cfg.security.authTokens != "",
+		"grpcAddress",
+		cfg.network.grpcAddress,
+		"webPort",
+		cfg.network.webPort,
+		"adminPort",
+		cfg.admin.port,
+		"pipeline",
+		st.Pipeline,
+		"resume",
+		cfg.resume,
+		"replyTimeout",
+		cfg.procedures.replyTimeout,
+		"replyRetries",
+		cfg.procedures.replyRetries,
+		"moderatorMaxLength",
+		cfg.moderation.maxLength,
+		"moderatorRate",
+		cfg.moderation.rate,
+		"retainGenerations",
+		cfg.procedures.retainGenerations,
+		"exportEvery",
+		cfg.procedures.exportEvery,
+		"exportInterval",
+		cfg.procedures.exportInterval,
+		"journal",
+		cfg.journal.enabled,
+		"journalSync",
+		cfg.journal.sync,
+		"replay",
+		cfg.replay.path,
 	)
 
 	ctx, stop := signal.NotifyContext(
@@ -144,10 +317,11 @@ func main() {
 		wg   = &sync.WaitGroup{}
 	)
 
-	if *flagLogToFile {
-		logFilePath := fmt.Sprintf(
-			DefaultLogToFilePath,
-			time.Now().Format(time.RFC3339),
+	if st.LogToFile {
+		logFilePath := filepath.Join(
+			cfg.files.outputs,
+			"logs",
+			fmt.Sprintf("server_log_%s.log", time.Now().Format(time.RFC3339)),
 		)
 		f := utils.LogOutput(logger, logFilePath, errs)
 		defer f()
@@ -192,6 +366,8 @@ func main() {
 
 	wg.Wait()
 
+	cs.conclude(err)
+
 	cs.Teardown()
 
 	close(errs)
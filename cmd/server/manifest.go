@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/network"
+	"codeberg.org/n30w/jasima/pkg/utils"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// maxRecordedErrors is how many of the most recent errors of a run its
+// manifest keeps.
+const maxRecordedErrors = 100
+
+// manifest describes how an exported run was produced, so that runs can be
+// reproduced and compared.
+type manifest struct {
+	RunID    string    `json:"runId"`
+	Server   chat.Name `json:"server"`
+	Lineage  string    `json:"lineage"`
+	Parent   string    `json:"parent,omitempty"`
+	ForkedAt int       `json:"forkedAt,omitempty"`
+
+	// Revision is the revision of the source the server was built from,
+	// and Modified whether it had uncommitted changes.
+	Revision  string `json:"revision"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+
+	Started time.Time `json:"started"`
+
+	// Ended and ExitReason are only set in the manifest written when the
+	// server shuts down.
+	Ended      time.Time `json:"ended,omitzero"`
+	ExitReason string    `json:"exitReason,omitempty"`
+
+	Generation     int `json:"generation"`
+	MaxGenerations int `json:"maxGenerations"`
+
+	// Config and Pipeline are the server's configuration and pipeline, as
+	// files the run can be reproduced with. The admin token is left out.
+	Config   string `json:"config"`
+	Pipeline string `json:"pipeline"`
+
+	// Agents are the agents that took part in the run, as they registered,
+	// in name order. Their seeds are the seeds of the run.
+	Agents []chat.Registration `json:"agents"`
+
+	// Jobs are how long each job of the pipeline took, in the order they
+	// first ran.
+	Jobs []jobTiming `json:"jobs"`
+
+	Errors []runError `json:"errors"`
+}
+
+// jobTiming is how long the runs of a job took.
+type jobTiming struct {
+	Job   string `json:"job"`
+	Stage stage  `json:"stage"`
+	Runs  int    `json:"runs"`
+	Total string `json:"total"`
+	Min   string `json:"min"`
+	Max   string `json:"max"`
+	Last  string `json:"last"`
+}
+
+// jobDurations are the durations of the runs of a job. Only the extremes
+// and the total are kept, so that runs that evolve forever do not grow their
+// manifest without end.
+type jobDurations struct {
+	job                    string
+	stage                  stage
+	runs                   int
+	total, low, high, last time.Duration
+}
+
+// runError is an error the run encountered.
+type runError struct {
+	Time       time.Time `json:"time"`
+	Generation int       `json:"generation"`
+	Job        string    `json:"job,omitempty"`
+	Error      string    `json:"error"`
+
+	// Fatal errors stopped the run.
+	Fatal bool `json:"fatal,omitempty"`
+}
+
+// runRecord is what a lineage records as it runs, for its manifest.
+type runRecord struct {
+	mu      sync.Mutex
+	started time.Time
+	agents  map[chat.Name]chat.Registration
+	jobs    []*jobDurations
+	errors  utils.Queue[runError]
+
+	// failed is the error that stopped the run, if any.
+	failed error
+}
+
+func newRunRecord() *runRecord {
+	errs, _ := utils.NewDynamicFixedQueue[runError](maxRecordedErrors)
+
+	return &runRecord{
+		started: time.Now(),
+		agents:  make(map[chat.Name]chat.Registration),
+		errors:  errs,
+	}
+}
+
+// job records that job `j` ran for `elapsed`.
+func (r *runRecord) job(j job, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.jobs, func(d *jobDurations) bool {
+		return d.job == j.Name() && d.stage == j.Stage()
+	})
+
+	if i < 0 {
+		r.jobs = append(r.jobs, &jobDurations{
+			job:   j.Name(),
+			stage: j.Stage(),
+			low:   elapsed,
+			high:  elapsed,
+		})
+		i = len(r.jobs) - 1
+	}
+
+	d := r.jobs[i]
+
+	d.runs++
+	d.total += elapsed
+	d.low = min(d.low, elapsed)
+	d.high = max(d.high, elapsed)
+	d.last = elapsed
+}
+
+// seen records the registrations of `clients`. An agent that registers
+// again is recorded as it last registered.
+func (r *runRecord) seen(clients []*network.ChatClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range clients {
+		r.agents[c.Name] = c.Registration()
+	}
+}
+
+// error records an error that job `j` ran into during generation
+// `generation`. `j` is empty when no job ran into it.
+func (r *runRecord) error(generation int, j string, err error) {
+	_ = r.errors.Enqueue(runError{
+		Time:       time.Now(),
+		Generation: generation,
+		Job:        j,
+		Error:      err.Error(),
+	})
+}
+
+// fail records the error that stopped the run.
+func (r *runRecord) fail(generation int, j string, err error) {
+	r.mu.Lock()
+	r.failed = err
+	r.mu.Unlock()
+
+	_ = r.errors.Enqueue(runError{
+		Time:       time.Now(),
+		Generation: generation,
+		Job:        j,
+		Error:      err.Error(),
+		Fatal:      true,
+	})
+}
+
+// manifest describes the server's run so far.
+func (s *ConlangServer) manifest() (manifest, error) {
+	m := manifest{
+		RunID:          s.runID,
+		Server:         s.name,
+		Lineage:        s.lineage,
+		Parent:         s.parent,
+		ForkedAt:       s.forkedAt,
+		Started:        s.record.started,
+		Generation:     s.run.currentGeneration(),
+		MaxGenerations: s.config.procedures.maxGenerations,
+		Revision:       "unknown",
+		Agents:         make([]chat.Registration, 0),
+		Jobs:           make([]jobTiming, 0),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		m.GoVersion = info.GoVersion
+
+		for _, kv := range info.Settings {
+			switch kv.Key {
+			case "vcs.revision":
+				m.Revision = kv.Value
+			case "vcs.modified":
+				m.Modified = kv.Value == "true"
+			}
+		}
+	}
+
+	var sb strings.Builder
+
+	err := s.config.settings.print(&sb)
+	if err != nil {
+		return m, errors.Wrap(err, "failed to encode configuration")
+	}
+
+	m.Config = sb.String()
+	sb.Reset()
+
+	err = toml.NewEncoder(&sb).Encode(s.config.pipeline.source)
+	if err != nil {
+		return m, errors.Wrap(err, "failed to encode pipeline")
+	}
+
+	m.Pipeline = sb.String()
+
+	m.Errors, err = s.record.errors.ToSlice()
+	if err != nil {
+		return m, errors.Wrap(err, "failed to read errors")
+	}
+
+	s.record.mu.Lock()
+	defer s.record.mu.Unlock()
+
+	for _, name := range slices.Sorted(maps.Keys(s.record.agents)) {
+		m.Agents = append(m.Agents, s.record.agents[name])
+	}
+
+	for _, d := range s.record.jobs {
+		m.Jobs = append(m.Jobs, jobTiming{
+			Job:   d.job,
+			Stage: d.stage,
+			Runs:  d.runs,
+			Total: d.total.String(),
+			Min:   d.low.String(),
+			Max:   d.high.String(),
+			Last:  d.last.String(),
+		})
+	}
+
+	return m, nil
+}
+
+// saveManifest writes manifest `m` to the generations directory, named by
+// `suffix` like the files it describes.
+func (s *ConlangServer) saveManifest(m manifest, suffix string) (string, error) {
+	dir := filepath.Join(s.config.files.outputs, "generations")
+
+	// A run that stops before its first export has nowhere to go yet.
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create generations directory")
+	}
+
+	p := filepath.Join(dir, fmt.Sprintf("manifest_%s.json", suffix))
+
+	err = saveToJson(m, p)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to save manifest")
+	}
+
+	s.logger.Infof("Saved run manifest to %s", p)
+
+	return p, nil
+}
+
+// conclude writes the final manifest of every lineage when the server shuts
+// down. `err` is the error the server stopped with, if any.
+func (s *ConlangServer) conclude(err error) {
+	// A replay evolves nothing, so it has no run to conclude.
+
+	if s.replay != nil {
+		return
+	}
+
+	for _, l := range s.lineages.all() {
+		if !l.config.procedures.exportData {
+			continue
+		}
+
+		l.record.mu.Lock()
+		failed := l.record.failed
+		l.record.mu.Unlock()
+
+		m, merr := l.manifest()
+		if merr != nil {
+			l.logger.Warnf("failed to describe run: %v", merr)
+			continue
+		}
+
+		m.Ended = time.Now()
+
+		switch {
+		case failed != nil:
+			m.ExitReason = fmt.Sprintf("failed: %v", failed)
+		case m.MaxGenerations > 0 && m.Generation >= m.MaxGenerations:
+			m.ExitReason = "completed"
+		case err != nil:
+			m.ExitReason = fmt.Sprintf("server failed: %v", err)
+		default:
+			m.ExitReason = "interrupted"
+		}
+
+		_, merr = l.saveManifest(m, l.exportSuffix(m.Ended))
+		if merr != nil {
+			l.logger.Warnf("failed to save final manifest: %v", merr)
+		}
+	}
+}
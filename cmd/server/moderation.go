@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/pkg/errors"
+)
+
+// handleModerator accepts a message from a person moderating the conversation
+// on a layer, such as an exhibition visitor. The message is injected into the
+// conversation once the procedure iterating on the layer takes it.
+func (s *ConlangServer) handleModerator(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if s.config.moderation.rate == 0 {
+		network.WriteJson(
+			w,
+			http.StatusForbidden,
+			network.AdminError{Error: "moderator messages are turned off"},
+		)
+		return
+	}
+
+	var req network.ModeratorMessage
+
+	// A body far larger than the longest message is not worth decoding.
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(8*s.config.moderation.maxLength+1024))
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	req.Content = strings.TrimSpace(req.Content)
+
+	switch n := utf8.RuneCountInString(req.Content); {
+	case n == 0:
+		network.WriteJson(
+			w,
+			http.StatusBadRequest,
+			network.AdminError{Error: "message is empty"},
+		)
+		return
+	case n > s.config.moderation.maxLength:
+		network.WriteJson(
+			w,
+			http.StatusRequestEntityTooLarge,
+			network.AdminError{Error: fmt.Sprintf(
+				"message is longer than %d characters",
+				s.config.moderation.maxLength,
+			)},
+		)
+		return
+	}
+
+	if !req.Layer.Known() || req.Layer == chat.SystemLayer {
+		network.WriteJson(
+			w,
+			http.StatusBadRequest,
+			network.AdminError{Error: "unknown layer"},
+		)
+		return
+	}
+
+	msg := memory.NewChatMessage(
+		chat.ModeratorName.String(),
+		"",
+		req.Content,
+		int32(req.Layer),
+	)
+
+	msg.Role = memory.ModeratorRole
+
+	code, err := s.queueModeration(*msg)
+	if err != nil {
+		network.WriteJson(w, code, network.AdminError{Error: err.Error()})
+		return
+	}
+
+	s.logger.Info("Moderator message accepted", "layer", req.Layer, "lineage", s.lineage)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// queueModeration queues `m` until the procedure iterating on its layer
+// injects it into the conversation. It returns the status to respond with
+// when the message cannot be queued.
+func (s *ConlangServer) queueModeration(m memory.Message) (int, error) {
+	if s.run.State().Layer != m.Layer.String() {
+		return http.StatusConflict, errors.Errorf("%s is not being discussed", m.Layer)
+	}
+
+	select {
+	case s.moderation <- m:
+		return http.StatusAccepted, nil
+	default:
+		return http.StatusServiceUnavailable, errors.New("too many moderator messages are waiting")
+	}
+}
+
+// moderate injects moderator message `m` into the conversation between
+// `participants`. It is saved and shown like any other message, but does not
+// count as an exchange, nor does it change whose turn it is. Participants
+// that may speak reply to it.
+func (s *ConlangServer) moderate(
+	ctx context.Context,
+	m memory.Message,
+	participants []*network.ChatClient,
+) error {
+	err := s.memory.Save(ctx, m)
+	if err != nil {
+		return errors.Wrap(err, "failed to save moderator message")
+	}
+
+	err = s.ws.InitialData.RecentMessages.Enqueue(m)
+	if err != nil {
+		s.logger.Errorf("failed to save message to InitialData: %v", err)
+	}
+
+	s.ws.Broadcasters.Messages.Broadcast(m)
+
+	for _, c := range participants {
+		fm := m
+		fm.Receiver = c.Name
+
+		err = s.gs.Broadcast(&fm)
+		if err != nil {
+			return errors.Wrap(err, "failed to forward moderator message")
+		}
+	}
+
+	return nil
+}
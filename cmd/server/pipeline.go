@@ -0,0 +1,576 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// stage is a named group of procedures in a pipeline.
+type stage string
+
+const (
+	// stageInitialize runs once, before any generation is evolved.
+	stageInitialize stage = "initialize"
+
+	// stageEvolve runs once for every generation.
+	stageEvolve stage = "evolve"
+
+	// stageFinalize runs once, after every generation has evolved.
+	stageFinalize stage = "finalize"
+)
+
+// stepConfig is a procedure as it is written in a pipeline file. Which of the
+// parameters a procedure accepts is defined in `procedureRegistry`.
+type stepConfig struct {
+	Procedure string `toml:"procedure"`
+
+	// Clients is the number of clients `wait-for-clients` waits for. It
+	// defaults to `procedures.waitForClients` of the server's configuration.
+	Clients int `toml:"clients"`
+
+	// Layers are the layers `iterate-specifications` evolves, in order. It
+	// defaults to every defined layer.
+	Layers []string `toml:"layers"`
+
+	// Exchanges is the number of exchanges per layer. It defaults to the
+	// `-exchanges` flag.
+	Exchanges int `toml:"exchanges"`
+
+	// LayerExchanges overrides `Exchanges` for individual layers.
+	LayerExchanges map[string]int `toml:"layerExchanges"`
+
+	// Duration is how long `wait-procedure` waits, and how long
+	// `iterate-logograms` waits between exchanges, such as "10s". It
+	// defaults to `procedures.waitDuration` of the server's configuration.
+	Duration string `toml:"duration"`
+
+	// Words are the words `iterate-logograms` iterates on. When empty,
+	// `WordCount` words are chosen by the strategies in `Selection`, which
+	// are asked in order until enough words are chosen.
+	Words     []string `toml:"words"`
+	WordCount int      `toml:"wordCount"`
+	Selection []string `toml:"selection"`
+}
+
+// params lists the parameters that are set on the step.
+func (c stepConfig) params() []string {
+	var p []string
+
+	if c.Clients != 0 {
+		p = append(p, "clients")
+	}
+	if len(c.Layers) > 0 {
+		p = append(p, "layers")
+	}
+	if c.Exchanges != 0 {
+		p = append(p, "exchanges")
+	}
+	if len(c.LayerExchanges) > 0 {
+		p = append(p, "layerExchanges")
+	}
+	if c.Duration != "" {
+		p = append(p, "duration")
+	}
+	if len(c.Words) > 0 {
+		p = append(p, "words")
+	}
+	if c.WordCount != 0 {
+		p = append(p, "wordCount")
+	}
+	if len(c.Selection) > 0 {
+		p = append(p, "selection")
+	}
+
+	return p
+}
+
+// pipelineConfig is the layout of a pipeline file.
+type pipelineConfig struct {
+	Initialize []stepConfig `toml:"initialize"`
+	Evolve     []stepConfig `toml:"evolve"`
+	Finalize   []stepConfig `toml:"finalize"`
+
+	// Fitness is how the candidates of each generation are scored and
+	// selected.
+	Fitness fitnessConfig `toml:"fitness"`
+}
+
+// step is a validated procedure of a pipeline, with its parameters parsed and
+// defaults applied.
+type step struct {
+	procedure string
+
+	// clients, like `duration`, is zero when the server's default applies.
+	clients int
+	layers  []chat.Layer
+
+	// exchanges maps a layer to its number of exchanges. Zero means the
+	// server's default.
+	exchanges map[chat.Layer]int
+	duration  time.Duration
+	words     []string
+	wordCount int
+	selection []string
+}
+
+// pipeline is the validated job graph of an evolution.
+type pipeline struct {
+	initialize []step
+	evolve     []step
+	finalize   []step
+	fitness    fitness
+
+	// source is the pipeline file the pipeline was validated from.
+	source pipelineConfig
+}
+
+// procedureDefinition describes a procedure that a pipeline can run.
+type procedureDefinition struct {
+	// params are the parameters the procedure accepts.
+	params []string
+
+	// stages are the stages the procedure may run in. Procedures that
+	// operate on the generation being evolved may only run while
+	// evolving.
+	stages []stage
+
+	// build creates the procedure's job. `g` is the generation being
+	// evolved and `t` reports the time elapsed since the run started.
+	build func(
+		s *ConlangServer,
+		st step,
+		g *memory.Generation,
+		t func() time.Duration,
+	) Job
+}
+
+var allStages = []stage{stageInitialize, stageEvolve, stageFinalize}
+
+// procedureRegistry holds every procedure a pipeline can run, by name.
+var procedureRegistry = map[string]procedureDefinition{
+	"wait-for-clients": {
+		params: []string{"clients"},
+		stages: allStages,
+		build: func(s *ConlangServer, st step, _ *memory.Generation, _ func() time.Duration) Job {
+			return s.WaitForClients(cmp.Or(st.clients, s.config.procedures.waitForClients))
+		},
+	},
+	"iterate-specifications": {
+		params: []string{"layers", "exchanges", "layerExchanges"},
+		stages: []stage{stageEvolve},
+		build: func(s *ConlangServer, st step, g *memory.Generation, _ func() time.Duration) Job {
+			return s.iterateSpecs(st.layers, st.exchanges, g)
+		},
+	},
+	"iterate-dictionary": {
+		stages: []stage{stageEvolve},
+		build: func(s *ConlangServer, _ step, g *memory.Generation, _ func() time.Duration) Job {
+			return s.iterateDictionary(g)
+		},
+	},
+	"iterate-logograms": {
+		params: []string{"words", "wordCount", "selection", "duration"},
+		stages: []stage{stageEvolve},
+		build: func(s *ConlangServer, st step, g *memory.Generation, _ func() time.Duration) Job {
+			return s.iterateLogograms(
+				st.words,
+				st.wordCount,
+				st.selection,
+				cmp.Or(st.duration, s.config.procedures.waitDuration),
+				g,
+			)
+		},
+	},
+	"update-generations": {
+		stages: []stage{stageEvolve},
+		build: func(s *ConlangServer, _ step, g *memory.Generation, _ func() time.Duration) Job {
+			return s.updateGenerations(g)
+		},
+	},
+	"wait-procedure": {
+		params: []string{"duration"},
+		stages: allStages,
+		build: func(s *ConlangServer, st step, _ *memory.Generation, _ func() time.Duration) Job {
+			return s.wait(cmp.Or(st.duration, s.config.procedures.waitDuration))
+		},
+	},
+	"export-data": {
+		stages: allStages,
+		build: func(s *ConlangServer, _ step, _ *memory.Generation, t func() time.Duration) Job {
+			return s.exportData(t)
+		},
+	},
+}
+
+// defaultPipelineConfig is the pipeline that runs when no pipeline file is
+// given.
+func defaultPipelineConfig() pipelineConfig {
+	return pipelineConfig{
+		Initialize: []stepConfig{
+			{Procedure: "wait-for-clients"},
+		},
+		Evolve: []stepConfig{
+			{Procedure: "iterate-specifications"},
+			{Procedure: "iterate-dictionary"},
+			{Procedure: "iterate-logograms"},
+			{Procedure: "update-generations"},
+			{Procedure: "wait-procedure"},
+		},
+		Finalize: []stepConfig{
+			{Procedure: "export-data"},
+		},
+	}
+}
+
+// loadPipeline reads and validates a pipeline file against the layers in
+// `ls`. An empty path returns the default pipeline.
+func loadPipeline(p string, ls layerSet) (*pipeline, error) {
+	if p == "" {
+		return defaultPipelineConfig().validate(ls)
+	}
+
+	var cfg pipelineConfig
+
+	md, err := toml.DecodeFile(p, &cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load pipeline file %s", p)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, errors.Errorf(
+			"pipeline file %s has unknown keys: %v",
+			p,
+			undecoded,
+		)
+	}
+
+	pl, err := cfg.validate(ls)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pipeline file %s", p)
+	}
+
+	return pl, nil
+}
+
+// validate checks that every procedure exists, runs in a stage it is allowed
+// in, and has sensible parameters. It also checks that procedures which
+// depend on the output of another procedure come after it.
+func (c pipelineConfig) validate(ls layerSet) (*pipeline, error) {
+	var (
+		err error
+		p   = &pipeline{source: c}
+	)
+
+	p.initialize, err = validateStage(stageInitialize, c.Initialize, ls)
+	if err != nil {
+		return nil, err
+	}
+
+	p.evolve, err = validateStage(stageEvolve, c.Evolve, ls)
+	if err != nil {
+		return nil, err
+	}
+
+	p.finalize, err = validateStage(stageFinalize, c.Finalize, ls)
+	if err != nil {
+		return nil, err
+	}
+
+	p.fitness, err = c.Fitness.validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "fitness")
+	}
+
+	if len(p.evolve) == 0 {
+		return nil, errors.New("evolve stage has no procedures")
+	}
+
+	if !slices.ContainsFunc(p.evolve, func(st step) bool {
+		return st.procedure == "update-generations"
+	}) {
+		return nil, errors.New(
+			"evolve stage must run update-generations, " +
+				"otherwise evolved generations are discarded",
+		)
+	}
+
+	// Each generation starts from the previous one, so the layers evolved
+	// so far are tracked to catch procedures that read a layer's
+	// transcript before it exists.
+
+	var (
+		evolved          = make(map[chat.Layer]bool)
+		dictionaryUpdate = false
+
+		// dictionaryLayers are the layers whose evolution produces
+		// dictionary updates.
+		dictionaryLayers = ls.withHook("update-dictionary")
+	)
+
+	for i, st := range p.evolve {
+		switch st.procedure {
+		case "iterate-specifications":
+			for _, l := range st.layers {
+				evolved[l] = true
+			}
+		case "iterate-dictionary":
+			dictionaryUpdate = true
+
+			if !slices.ContainsFunc(dictionaryLayers, func(l chat.Layer) bool {
+				return evolved[l]
+			}) {
+				return nil, errors.Errorf(
+					"evolve[%d]: iterate-dictionary requires an earlier "+
+						"iterate-specifications on a layer with the "+
+						"update-dictionary hook",
+					i,
+				)
+			}
+		case "iterate-logograms":
+			if !evolved[chat.LogographyLayer] {
+				return nil, errors.Errorf(
+					"evolve[%d]: iterate-logograms requires an earlier "+
+						"iterate-specifications on the %s layer",
+					i,
+					chat.LogographyLayer,
+				)
+			}
+		}
+	}
+
+	// Evolving a dictionary layer produces dictionary updates, which pile
+	// up unless they are applied.
+
+	for _, l := range dictionaryLayers {
+		if evolved[l] && !dictionaryUpdate {
+			return nil, errors.Errorf(
+				"evolve stage iterates on the %s layer but never runs "+
+					"iterate-dictionary to apply its updates",
+				l,
+			)
+		}
+	}
+
+	return p, nil
+}
+
+func validateStage(
+	sg stage,
+	steps []stepConfig,
+	ls layerSet,
+) ([]step, error) {
+	validated := make([]step, 0, len(steps))
+
+	for i, sc := range steps {
+		st, err := sc.validate(sg, ls)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s[%d]", sg, i)
+		}
+
+		validated = append(validated, st)
+	}
+
+	return validated, nil
+}
+
+func (c stepConfig) validate(sg stage, ls layerSet) (step, error) {
+	st := step{procedure: c.Procedure}
+
+	def, ok := procedureRegistry[c.Procedure]
+	if !ok {
+		return st, fmt.Errorf(
+			"unknown procedure %q, expected one of %s",
+			c.Procedure,
+			strings.Join(procedureNames(), ", "),
+		)
+	}
+
+	if !slices.Contains(def.stages, sg) {
+		return st, fmt.Errorf(
+			"procedure %s cannot run in the %s stage",
+			c.Procedure,
+			sg,
+		)
+	}
+
+	for _, param := range c.params() {
+		if !slices.Contains(def.params, param) {
+			return st, fmt.Errorf(
+				"procedure %s does not take parameter %s",
+				c.Procedure,
+				param,
+			)
+		}
+	}
+
+	st.clients = c.Clients
+	if st.clients < 0 {
+		return st, fmt.Errorf("clients must be positive, got %d", c.Clients)
+	}
+
+	if len(c.Layers) == 0 {
+		st.layers = ls.layers()
+	}
+
+	for _, name := range c.Layers {
+		l, err := chat.ParseLayer(name)
+		if err != nil {
+			return st, err
+		}
+
+		if ls.get(l) == nil {
+			return st, fmt.Errorf("layer %s is not defined", l)
+		}
+
+		if slices.Contains(st.layers, l) {
+			return st, fmt.Errorf("layer %s is listed more than once", l)
+		}
+
+		st.layers = append(st.layers, l)
+	}
+
+	// A layer builds on the specifications of its dependencies, so
+	// dependencies evolved in the same step must be evolved first.
+
+	for i, l := range st.layers {
+		for _, dep := range ls.get(l).dependsOn {
+			if j := slices.Index(st.layers, dep); j > i {
+				return st, fmt.Errorf(
+					"layer %s depends on %s, which must be listed before it",
+					l,
+					dep,
+				)
+			}
+		}
+	}
+
+	if c.Exchanges < 0 {
+		return st, fmt.Errorf("exchanges must be positive, got %d", c.Exchanges)
+	}
+
+	st.exchanges = make(map[chat.Layer]int)
+	for _, l := range st.layers {
+		st.exchanges[l] = c.Exchanges
+	}
+
+	for name, n := range c.LayerExchanges {
+		l, err := chat.ParseLayer(name)
+		if err != nil {
+			return st, err
+		}
+
+		if _, ok := st.exchanges[l]; !ok {
+			return st, fmt.Errorf("layerExchanges sets %s, which is not in layers", l)
+		}
+
+		if n <= 0 {
+			return st, fmt.Errorf("exchanges for %s must be positive, got %d", l, n)
+		}
+
+		st.exchanges[l] = n
+	}
+
+	if c.Duration != "" {
+		d, err := time.ParseDuration(c.Duration)
+		if err != nil {
+			return st, errors.Wrap(err, "invalid duration")
+		}
+
+		if d <= 0 {
+			return st, fmt.Errorf("duration must be positive, got %s", d)
+		}
+
+		st.duration = d
+	}
+
+	if len(c.Words) > 0 && c.WordCount != 0 {
+		return st, errors.New("words and wordCount are mutually exclusive")
+	}
+
+	if c.WordCount < 0 {
+		return st, fmt.Errorf("wordCount must be positive, got %d", c.WordCount)
+	}
+
+	if len(c.Words) > 0 && len(c.Selection) > 0 {
+		return st, errors.New("words and selection are mutually exclusive")
+	}
+
+	for _, name := range c.Selection {
+		if _, ok := wordSelectors[name]; !ok {
+			return st, fmt.Errorf(
+				"unknown word selection %q, expected one of %s",
+				name,
+				strings.Join(wordSelectorNames(), ", "),
+			)
+		}
+	}
+
+	st.words = c.Words
+	st.wordCount = c.WordCount
+	if st.wordCount == 0 {
+		st.wordCount = DefaultLogogramWordCount
+	}
+
+	st.selection = c.Selection
+	if len(st.selection) == 0 {
+		st.selection = DefaultWordSelection
+	}
+
+	return st, nil
+}
+
+func procedureNames() []string {
+	names := make([]string, 0, len(procedureRegistry))
+	for k := range procedureRegistry {
+		names = append(names, k)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// evolveJobs creates the jobs that evolve a generation. Each candidate of the
+// generation is evolved by jobs of its own, one candidate after another.
+func (s *ConlangServer) evolveJobs(t func() time.Duration) jobs {
+	var js jobs
+
+	for range s.config.pipeline.fitness.candidates {
+		js = append(
+			js,
+			s.buildJobs(stageEvolve, s.config.pipeline.evolve, &memory.Generation{}, t)...,
+		)
+	}
+
+	return js
+}
+
+// buildJobs creates the jobs of stage `sg`. `g` is the generation the jobs
+// evolve, shared between every job of the stage.
+func (s *ConlangServer) buildJobs(
+	sg stage,
+	steps []step,
+	g *memory.Generation,
+	t func() time.Duration,
+) jobs {
+	js := make(jobs, 0, len(steps))
+
+	for _, st := range steps {
+		js = append(js, &procedure{
+			name:  st.procedure,
+			stage: sg,
+			exec:  procedureRegistry[st.procedure].build(s, st, g, t),
+		})
+	}
+
+	return js
+}
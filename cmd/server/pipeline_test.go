@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPipelineConfig_validate(t *testing.T) {
+	ls, err := defaultLayersConfig().validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// evolve builds a pipeline that evolves `steps` and keeps the result.
+	evolve := func(steps ...stepConfig) pipelineConfig {
+		return pipelineConfig{
+			Evolve: append(steps, stepConfig{Procedure: "update-generations"}),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		pipeline pipelineConfig
+		wantErr  bool
+	}{
+		{
+			name:     "default pipeline",
+			pipeline: defaultPipelineConfig(),
+		},
+		{
+			name:     "only update-generations",
+			pipeline: evolve(),
+		},
+		{
+			name:     "no evolve stage",
+			pipeline: pipelineConfig{},
+			wantErr:  true,
+		},
+		{
+			name: "no update-generations",
+			pipeline: pipelineConfig{
+				Evolve: []stepConfig{{Procedure: "wait-procedure"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "unknown procedure",
+			pipeline: evolve(stepConfig{Procedure: "iterate-grammar"}),
+			wantErr:  true,
+		},
+		{
+			name: "procedure in the wrong stage",
+			pipeline: pipelineConfig{
+				Initialize: []stepConfig{{Procedure: "update-generations"}},
+				Evolve:     evolve().Evolve,
+			},
+			wantErr: true,
+		},
+		{
+			name:     "parameter the procedure does not take",
+			pipeline: evolve(stepConfig{Procedure: "iterate-dictionary", Duration: "1s"}),
+			wantErr:  true,
+		},
+		{
+			name: "dependency listed after its layer",
+			pipeline: evolve(stepConfig{
+				Procedure: "iterate-specifications",
+				Layers:    []string{"grammar", "phonetics"},
+			}),
+			wantErr: true,
+		},
+		{
+			name: "layer exchanges for a layer not evolved",
+			pipeline: evolve(stepConfig{
+				Procedure:      "iterate-specifications",
+				Layers:         []string{"phonetics"},
+				LayerExchanges: map[string]int{"grammar": 4},
+			}),
+			wantErr: true,
+		},
+		{
+			name:     "iterate-dictionary before its layer is evolved",
+			pipeline: evolve(stepConfig{Procedure: "iterate-dictionary"}),
+			wantErr:  true,
+		},
+		{
+			name: "dictionary updates never applied",
+			pipeline: evolve(stepConfig{
+				Procedure: "iterate-specifications",
+				Layers:    []string{"phonetics", "grammar", "dictionary"},
+			}),
+			wantErr: true,
+		},
+		{
+			name: "iterate-logograms after the logography layer",
+			pipeline: evolve(
+				stepConfig{
+					Procedure: "iterate-specifications",
+					Layers:    []string{"logography"},
+				},
+				stepConfig{Procedure: "iterate-logograms"},
+			),
+		},
+		{
+			name:     "iterate-logograms before the logography layer",
+			pipeline: evolve(stepConfig{Procedure: "iterate-logograms"}),
+			wantErr:  true,
+		},
+		{
+			name: "words and wordCount",
+			pipeline: evolve(
+				stepConfig{
+					Procedure: "iterate-specifications",
+					Layers:    []string{"logography"},
+				},
+				stepConfig{
+					Procedure: "iterate-logograms",
+					Words:     []string{"toki"},
+					WordCount: 2,
+				},
+			),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.pipeline.validate(ls)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/book"
 	"codeberg.org/n30w/jasima/pkg/chat"
 	"codeberg.org/n30w/jasima/pkg/memory"
 	"codeberg.org/n30w/jasima/pkg/network"
@@ -16,57 +23,74 @@
 	"github.com/pkg/errors"
 )
 
-// iterate begins the processing of a Layer. The function completes after the
-// total number of back and forth rounds are complete. Layer control and message
-// routing are decoupled.
+// iterate evolves the specifications of `layers`, in order, starting from
+// `initialGeneration`. Each layer builds on the specifications the layers
+// before it produced. `exchanges` is the number of exchanges of each layer.
 func (s *ConlangServer) iterate(
 	ctx context.Context,
 	initialGeneration memory.Generation,
-	initialLayer chat.Layer,
-	exchanges int,
+	layers []chat.Layer,
+	exchanges map[chat.Layer]int,
 ) (memory.Generation, error) {
 	// The maps and slices need to be copied, since in Go, maps and slices are
 	// pass by reference always.
 
-	newGeneration := memory.Generation{
+	g := memory.Generation{
 		Transcript:     newTranscriptGeneration(),
 		Logography:     initialGeneration.Logography.Copy(),
 		Specifications: initialGeneration.Specifications.Copy(),
 		Dictionary:     initialGeneration.Dictionary.Copy(),
+		Changes:        make(memory.SpecificationChanges),
 	}
 
-	if initialLayer == chat.SystemLayer {
-		s.logger.Info("initial layer is system")
-		return newGeneration, nil
+	for _, layer := range layers {
+		n := exchanges[layer]
+		if n == 0 {
+			n = s.config.procedures.maxExchanges
+		}
+
+		s.logger.Infof("%d: Iterating on %s", layer, layer)
+
+		var err error
+
+		g, err = s.iterateLayer(ctx, initialGeneration, g, layer, n)
+		if err != nil {
+			return initialGeneration, errors.Wrapf(
+				err,
+				"failed iteration at %s",
+				layer,
+			)
+		}
 	}
 
-	s.logger.Infof("%d: Recursing on %s", initialLayer, initialLayer)
+	return g, nil
+}
 
-	prevGeneration, err := s.iterate(
-		ctx,
-		initialGeneration,
-		initialLayer-1,
-		exchanges,
-	)
-	if err != nil {
-		return initialGeneration, errors.Wrapf(
-			err,
-			"failed iteration at %s",
-			initialLayer,
-		)
+// iterateLayer begins the processing of a Layer. The function completes after
+// the total number of back and forth rounds are complete. Layer control and
+// message routing are decoupled.
+func (s *ConlangServer) iterateLayer(
+	ctx context.Context,
+	initialGeneration memory.Generation,
+	prevGeneration memory.Generation,
+	initialLayer chat.Layer,
+	exchanges int,
+) (memory.Generation, error) {
+	newGeneration := memory.Generation{
+		Transcript:     prevGeneration.Transcript.Copy(),
+		Logography:     initialGeneration.Logography.Copy(),
+		Specifications: prevGeneration.Specifications.Copy(),
+		Dictionary:     prevGeneration.Dictionary.Copy(),
+		Changes:        prevGeneration.Changes.Copy(),
 	}
 
-	sysClient, err := s.gs.GetClientByName("SYSTEM_AGENT_A")
-	if err != nil {
-		return newGeneration, errors.Wrap(
-			err,
-			"failed to retrieve client by name",
-		)
+	clients := rotate(s.clientsByLayer(initialLayer), s.candidate())
+	if len(clients) == 0 {
+		return newGeneration, errors.Errorf("no agents are connected to %s", initialLayer)
 	}
 
 	var (
-		timer   = utils.Timer(time.Now())
-		clients = s.gs.GetClientsByLayer(initialLayer)
+		timer = utils.Timer(time.Now())
 
 		// kickoff is the command that is sent to kick off the layer's
 		// iteration exchanges. It consists of the initializer client, which
@@ -80,7 +104,7 @@ func (s *ConlangServer) iterate(
 					"let's begin developing Toki Pona %s. You go first.",
 				initialLayer,
 			),
-		)(s.gs.GetClientsByLayer(initialLayer)[0])
+		)(clients[0])
 
 		// initialInstructions are the initial instructions each agent on the
 		// layer is given for its system prompt.
@@ -101,32 +125,26 @@ func (s *ConlangServer) iterate(
 				initialLayer,
 				initialGeneration.Specifications[initialLayer].String(),
 			),
-		)(sysClient)
+		)
 
-		layerSpecificInstructions = map[chat.Layer]string{
-			chat.SystemLayer:    "",
-			chat.PhoneticsLayer: "",
-			chat.GrammarLayer:   "",
-			chat.DictionaryLayer: "Do not discuss the structure of the" +
-				" dictionary. Rather, " +
-				"discuss the words and enhancements that may need to be made to" +
-				" them.",
-			chat.LogographyLayer: "",
-		}
+		layerDef = s.config.layers.get(initialLayer)
 
 		sb strings.Builder
 	)
 
-	sendCommands := network.SendCommandBuilder(ctx, s.gs.Channel.ToClients)
+	if layerDef == nil {
+		return newGeneration, errors.Errorf("layer %s is not defined", initialLayer)
+	}
 
-	newGeneration.Transcript = prevGeneration.Transcript.Copy()
-	newGeneration.Specifications = prevGeneration.Specifications.Copy()
-	newGeneration.Dictionary = prevGeneration.Dictionary.Copy()
+	sendCommands := network.SendCommandBuilder(ctx, s.gs.Channel.ToClients)
 
 	sb.WriteString(initialInstructions)
 
-	for i := initialLayer; i > 0; i-- {
-		sb.WriteString(newGeneration.Specifications[i].String())
+	// Agents are given the specification of their layer and of every layer
+	// it depends on.
+
+	for _, l := range s.config.layers.context(initialLayer) {
+		sb.WriteString(newGeneration.Specifications[l].String())
 		sb.WriteString("\n")
 	}
 
@@ -139,8 +157,9 @@ func (s *ConlangServer) iterate(
 				" language:\n",
 		)
 		sb.WriteString(newGeneration.Dictionary.String())
-		sb.WriteString(layerSpecificInstructions[initialLayer])
+		sb.WriteString(layerDef.instructions)
 		sb.WriteString("\n")
+		sb.WriteString(layerDef.termination.instructions())
 
 		// Add all grammar in the language.
 
@@ -150,28 +169,189 @@ func (s *ConlangServer) iterate(
 		wordsAndGrammar = sb.String()
 	}
 
-	sendCommands(
-		clients,
-		s.cmd(agent.AppendInstructions, wordsAndGrammar),
-		s.cmd(agent.Unlatch),
+	err := sendCommands(clients, s.cmd(agent.AppendInstructions, wordsAndGrammar))
+	if err != nil {
+		return newGeneration, errors.Wrap(err, "failed to send instructions")
+	}
+
+	// The turn policy decides who is unlatched and who receives each
+	// message. `unlatched` tracks who it unlatched.
+
+	var (
+		turns     = turnPolicies[layerDef.turns](s)
+		unlatched = make(map[chat.Name]bool)
 	)
 
-	s.logger.Infof("Sending %s to %s", agent.Unlatch, initialLayer)
+	s.logger.Infof("Sending %s to %s, taking turns by %s", agent.Unlatch, initialLayer, layerDef.turns)
+
+	// The kickoff must not race ahead of the instructions and unlatching.
+
+	err = s.setSpeakers(ctx, turns.start(clients), clients, unlatched)
+	if err != nil {
+		return newGeneration, err
+	}
 
 	err = s.swc(ctx, kickoff)
 	if err != nil {
 		return newGeneration, err
 	}
 
+	s.run.enterLayer(initialLayer.String())
+	defer s.run.leaveLayer()
+
+	// The conversation ends on the layer's terms, and `reason` is recorded
+	// in its transcript.
+
+	var (
+		ending = layerDef.termination.begin(s, exchanges)
+		reason string
+	)
+
+	// The watchdog waits on `waiting` to send the next message. Agents that
+	// stop replying are dropped from `active`, the participants that the
+	// conversation goes on with.
+
+	var (
+		watch    = s.watchLayer(initialLayer)
+		active   = slices.Clone(clients)
+		waiting  = clients[:1]
+		last     *memory.Message
+		lastTurn turn
+	)
+
+	defer watch.stop()
+
+	// resend nudges the agents that are waited on with the last message, or
+	// the kickoff, or hands it to other agents when they are not nudged.
+
+	resend := func(nudge bool) error {
+		switch {
+		case nudge && last == nil:
+			return s.swc(ctx, kickoff)
+		case nudge:
+			return s.takeTurn(ctx, *last, turn{receivers: waiting, speakers: lastTurn.speakers}, active, unlatched)
+		}
+
+		active = slices.DeleteFunc(active, func(c *network.ChatClient) bool {
+			return slices.Contains(waiting, c)
+		})
+
+		if last == nil {
+			if len(active) == 0 {
+				reason = "no agent was left to begin it"
+				return nil
+			}
+
+			waiting = active[:1]
+			kickoff.Receiver = string(active[0].Name)
+
+			err := s.setSpeakers(ctx, turns.start(active), active, unlatched)
+			if err != nil {
+				return err
+			}
+
+			return s.swc(ctx, kickoff)
+		}
+
+		speakers := slices.DeleteFunc(slices.Clone(active), func(c *network.ChatClient) bool {
+			return c.Name == last.Sender
+		})
+
+		if len(speakers) == 0 {
+			reason = "no agent was left to reply"
+			return nil
+		}
+
+		waiting = speakers
+		lastTurn = turn{receivers: speakers, speakers: speakers}
+
+		return s.takeTurn(ctx, *last, lastTurn, active, unlatched)
+	}
+
+	// interrupted ends the exchanges when an operator skips the layer. An
+	// aborted generation puts the agents back and gives up on the layer.
+
+	interrupted := func(err error) (bool, error) {
+		switch {
+		case err == nil:
+			return false, nil
+		case errors.Is(err, errLayerSkipped):
+			s.logger.Warnf("Skipping the rest of %s", initialLayer)
+			reason = "an operator skipped the rest of the layer"
+			return true, nil
+		default:
+			_ = turns.end(context.WithoutCancel(ctx))
+			_ = ending.reset(context.WithoutCancel(ctx))
+			_ = s.resetAgents(context.WithoutCancel(ctx), active)
+			return true, err
+		}
+	}
+
 	select {
 	case <-ctx.Done():
 		return newGeneration, ctx.Err()
 	default:
-		for i := range exchanges {
+		i := 0
+
+	exchange:
+		for reason == "" {
 			select {
 			case <-ctx.Done():
 				return newGeneration, nil
+			case <-ending.deadline:
+				reason = fmt.Sprintf("reached its time limit of %s", ending.timeLimit)
+			case <-watch.timer.C:
+				notes, nudge := watch.silent(waiting)
+
+				newGeneration.Transcript[initialLayer] = append(
+					newGeneration.Transcript[initialLayer],
+					notes...,
+				)
+
+				err := resend(nudge)
+				if err != nil {
+					return newGeneration, err
+				}
+			case <-s.run.Changed():
+				stop, err := interrupted(s.run.Interrupted())
+				if err != nil {
+					return newGeneration, err
+				}
+
+				if stop {
+					break exchange
+				}
+			case m := <-s.moderation:
+				// A message for a layer that has since ended is out of
+				// place in this one.
+
+				if m.Layer != initialLayer {
+					s.logger.Warnf("Dropping moderator message for %s", m.Layer)
+					continue
+				}
+
+				newGeneration.Transcript[initialLayer] = append(
+					newGeneration.Transcript[initialLayer],
+					m,
+				)
+
+				err := s.moderate(ctx, m, active)
+				if err != nil {
+					return newGeneration, err
+				}
 			case m := <-s.procedureChan:
+				// Replies that arrive late from an earlier layer, or from an
+				// agent that is not exchanging on this one, are not part of
+				// its transcript.
+
+				if m.Layer != initialLayer || !slices.ContainsFunc(
+					active,
+					func(c *network.ChatClient) bool { return c.Name == m.Sender },
+				) {
+					s.logger.Warnf("Dropping message from %s for %s", m.Sender, m.Layer)
+					continue
+				}
+
 				newGeneration.Transcript[initialLayer] = append(
 					newGeneration.Transcript[initialLayer],
 					m,
@@ -192,133 +372,223 @@ func (s *ConlangServer) iterate(
 
 				s.ws.Broadcasters.MessageWordDictExtraction.Broadcast(usedWords)
 
-				s.logger.Infof("Exchange Total: %d/%d", i+1, exchanges)
+				i++
+
+				s.logger.Infof("Exchange Total: %d/%d", i, exchanges)
+
+				reason, err = ending.over(
+					ctx,
+					m,
+					i,
+					active,
+					newGeneration.Transcript[initialLayer],
+				)
+				if err != nil {
+					return newGeneration, err
+				}
+
+				if reason != "" {
+					break exchange
+				}
+
+				// Hand the message to the other agents on the layer once the
+				// exchange may go ahead.
+
+				stop, err := interrupted(s.run.awaitExchange(ctx))
+				if err != nil {
+					return newGeneration, err
+				}
+
+				if stop {
+					break exchange
+				}
+
+				t, err := turns.next(ctx, m, active)
+				if err != nil {
+					return newGeneration, errors.Wrap(err, "failed to take turn")
+				}
+
+				err = s.takeTurn(ctx, m, t, active, unlatched)
+				if err != nil {
+					return newGeneration, err
+				}
+
+				last, lastTurn, waiting = &m, t, t.speakers
+
+				watch.replied()
 			}
 		}
 
-		s.resetAgents(ctx, clients)
+		err = turns.end(ctx)
+		if err != nil {
+			return newGeneration, err
+		}
+
+		newGeneration.Transcript[initialLayer], err = ending.end(
+			ctx,
+			initialLayer,
+			i,
+			reason,
+			newGeneration.Transcript[initialLayer],
+		)
+		if err != nil {
+			return newGeneration, err
+		}
+
+		err = s.resetAgents(ctx, active)
+		if err != nil {
+			return newGeneration, err
+		}
 
 		sb.Reset()
 
 		// The system agent will ONLY summarize the chat log, and not read the
 		// other Specifications for other layers (for now at least).
 
-		err = s.swc(ctx, addSysAgentInstructions)
+		specPrime, sysClient, err := s.ask(ctx, systemRequest{
+			role: agent.CapabilitySpecificationWriter,
+			prepare: func(ctx context.Context, c *network.ChatClient) error {
+				err := s.swc(ctx, addSysAgentInstructions(c))
+				if err != nil {
+					return err
+				}
+
+				return s.swc(ctx, s.cmd(agent.Unlatch)(c))
+			},
+			request: s.cmd(
+				agent.RequestSpecificationUpdate,
+				transcriptToString(newGeneration.Transcript[initialLayer]),
+			),
+		})
+		if ctx.Err() != nil {
+			return newGeneration, nil
+		}
+
 		if err != nil {
 			return newGeneration, err
 		}
 
-		err = s.swc(ctx, s.cmd(agent.Unlatch)(sysClient))
+		sb.Reset()
+
+		err = s.resetAgent(ctx, sysClient)
 		if err != nil {
 			return newGeneration, err
 		}
 
-		msg := s.messageToSystemAgent(
-			sysClient.Name,
-			transcriptToString(newGeneration.Transcript[initialLayer]),
-		)
+		s.logger.Infof("%s took %s to complete", initialLayer, timer())
+
+		var update memory.SpecificationUpdate
 
-		err = s.swc(ctx, msg)
+		err = json.Unmarshal([]byte(specPrime.Text), &update)
 		if err != nil {
-			return newGeneration, err
+			// Providers without typed responses reply with the
+			// specification alone.
+
+			s.logger.Warnf("%s did not explain its specification update", sysClient.Name)
+
+			update = memory.SpecificationUpdate{Specification: specPrime.Text.String()}
 		}
 
-		select {
-		case <-ctx.Done():
-			return newGeneration, nil
-		case specPrime := <-s.gs.Channel.ToServer:
-			sb.Reset()
+		change := memory.DiffSpecifications(
+			initialLayer,
+			newGeneration.Specifications[initialLayer].String(),
+			update.Specification,
+			update.Explanation,
+		)
 
-			s.resetAgent(ctx, sysClient)
+		newGeneration.Specifications[initialLayer] = chat.Content(update.Specification)
+		newGeneration.Changes[initialLayer] = change
 
-			s.logger.Infof("%s took %s to complete", initialLayer, timer())
+		s.journal.record(
+			memory.JournalSpecification,
+			s.lineage,
+			s.run.currentGeneration()+1,
+			change,
+		)
+
+		s.ws.Broadcasters.Specification.Broadcast(newGeneration.Specifications)
 
-			newGeneration.Specifications[initialLayer] = specPrime.Text
-			s.ws.Broadcasters.Specification.Broadcast(newGeneration.Specifications)
+		err = s.ws.InitialData.RecentChanges.Enqueue(change)
+		if err != nil {
+			s.logger.Errorf("failed to save specification change to InitialData: %v", err)
+		}
 
-			// End of side effects.
+		s.ws.Broadcasters.SpecificationChange.Broadcast(change)
 
-			if initialLayer == chat.DictionaryLayer {
-				s.iterateUpdateDictionary(ctx, newGeneration)
-			}
+		// End of side effects.
 
-			return newGeneration, nil
+		if hook, ok := layerHooks[layerDef.hook]; ok {
+			hook(s, ctx, initialLayer, newGeneration)
 		}
+
+		return newGeneration, nil
 	}
 }
 
+// iterateUpdateDictionary asks the dictionary updater for the changes that
+// the transcript of `layer` makes to the dictionary.
 func (s *ConlangServer) iterateUpdateDictionary(
 	ctx context.Context,
+	layer chat.Layer,
 	newGeneration memory.Generation,
 ) {
 	s.logger.Info("Initiating dictionary updates...")
 
-	dictSysAgent, err := s.gs.GetClientByName("SYSTEM_AGENT_B")
-	if err != nil {
-		s.errs <- err
-		return
-	}
-
-	clients := []*network.ChatClient{dictSysAgent}
-
 	genDict, err := json.Marshal(newGeneration.Dictionary)
 	if err != nil {
 		s.errs <- errors.Wrap(err, "failed to Marshal dictionary")
 		return
 	}
 
-	err = s.swc(ctx, s.cmd(agent.Latch)(dictSysAgent))
-	if err != nil {
-		s.errs <- err
-		return
-	}
+	// Send results to dictionary LLM.
 
-	currentDict := s.cmd(
-		agent.AppendInstructions, fmt.Sprintf(
-			"This is the current dictionary\n%s",
-			string(genDict),
-		),
-	)(dictSysAgent)
+	dictUpdates, dictSysAgent, err := s.ask(ctx, systemRequest{
+		role: agent.CapabilityDictionaryUpdater,
+		prepare: func(ctx context.Context, c *network.ChatClient) error {
+			err := s.swc(ctx, s.cmd(agent.Latch)(c))
+			if err != nil {
+				return err
+			}
 
-	err = s.swc(ctx, currentDict)
-	if err != nil {
-		s.errs <- err
-		return
-	}
+			currentDict := s.cmd(
+				agent.AppendInstructions, fmt.Sprintf(
+					"This is the current dictionary\n%s",
+					string(genDict),
+				),
+			)(c)
 
-	// Send results to dictionary LLM.
+			err = s.swc(ctx, currentDict)
+			if err != nil {
+				return err
+			}
 
-	err = s.swc(ctx, s.cmd(agent.Unlatch)(dictSysAgent))
-	if err != nil {
-		s.errs <- err
+			return s.swc(ctx, s.cmd(agent.Unlatch)(c))
+		},
+		request: s.cmd(
+			agent.RequestJsonDictionaryUpdate,
+			transcriptToString(newGeneration.Transcript[layer]),
+		),
+	})
+	if ctx.Err() != nil {
 		return
 	}
 
-	dictUpdateRequest := s.cmd(
-		agent.RequestJsonDictionaryUpdate,
-		transcriptToString(newGeneration.Transcript[chat.DictionaryLayer]),
-	)(dictSysAgent)
-
-	err = s.swc(ctx, dictUpdateRequest)
 	if err != nil {
 		s.errs <- err
 		return
 	}
 
+	clients := []*network.ChatClient{dictSysAgent}
+
 	var updates memory.ResponseDictionaryEntries
 
-	select {
-	case <-ctx.Done():
+	err = json.Unmarshal([]byte(dictUpdates.Text), &updates)
+	if err != nil {
+		s.errs <- errors.Wrap(
+			err,
+			"failed to unmarshal dictionary updates",
+		)
 		return
-	case dictUpdates := <-s.gs.Channel.ToServer:
-		err = json.Unmarshal([]byte(dictUpdates.Text), &updates)
-		if err != nil {
-			s.errs <- errors.Wrap(
-				err,
-				"failed to unmarshal dictionary updates",
-			)
-			return
-		}
 	}
 
 	select {
@@ -328,31 +598,29 @@ func (s *ConlangServer) iterateUpdateDictionary(
 		s.logger.Info("Updates sent to dictionary channel")
 	}
 
-	s.resetAgents(ctx, clients)
+	err = s.resetAgents(ctx, clients)
+	if err != nil {
+		s.errs <- err
+	}
 }
 
 func (s *ConlangServer) iterateLogogram(
 	ctx context.Context,
 	newGeneration memory.Generation,
 	word string,
+	pair logogramPair,
+	delay time.Duration,
+	progress *sync.Mutex,
 ) (
 	string,
 	error,
 ) {
 	genericInstructions := "\nHere is the current dictionary:\n" + newGeneration.Specifications[chat.DictionaryLayer].String() + "\nHere is the current logography specification:\n" + newGeneration.Specifications[chat.LogographyLayer].String()
 
-	generator, err := s.gs.GetClientByName("SYSTEM_AGENT_D")
-	if err != nil {
-		return "", errors.Wrap(err, "failed to find generator agent")
-	}
-
-	adversary, err := s.gs.GetClientByName("SYSTEM_AGENT_E")
-	if err != nil {
-		return "", errors.Wrap(err, "failed to find adversary agent")
-	}
-
 	var (
 		i          = 0
+		generator  = pair.generator
+		adversary  = pair.adversary
 		clients    = []*network.ChatClient{generator, adversary}
 		currentSvg = ""
 
@@ -373,7 +641,21 @@ func (s *ConlangServer) iterateLogogram(
 
 	// Fresh slate.
 
-	sendCommands(clients, s.cmd(agent.Latch), s.cmd(agent.ClearMemory))
+	err := sendCommands(clients, s.cmd(agent.Latch), s.cmd(agent.ClearMemory))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to reset pair")
+	}
+
+	err = s.settle(ctx, clients, network.Reset)
+	if err != nil {
+		return "", err
+	}
+
+	// Latching cancels whatever the pair was working on, so replies left
+	// over from an earlier word are stale.
+
+	s.replies.drain(generator.Name)
+	s.replies.drain(adversary.Name)
 
 	err = s.swc(ctx, generatorInstructions)
 	if err != nil {
@@ -385,13 +667,21 @@ func (s *ConlangServer) iterateLogogram(
 		return "", errors.Wrap(err, "failed to send adversary instructions")
 	}
 
-	sendCommands(clients, s.cmd(agent.Unlatch))
+	err = sendCommands(clients, s.cmd(agent.Unlatch))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to unlatch pair")
+	}
+
+	err = s.settle(ctx, clients, network.Unlatched)
+	if err != nil {
+		return "", err
+	}
 
 	// Send the initial message.
 
 	initMsg := memory.ResponseLogogramIteration{
 		Name: word,
-		Svg:  s.dictionary[word].Logogram,
+		Svg:  newGeneration.Dictionary[word].Logogram,
 		ResponseText: memory.ResponseText{
 			Response: "This is the initial svg. We will be developing logogram for the word: " + word,
 		},
@@ -410,126 +700,284 @@ func (s *ConlangServer) iterateLogogram(
 	}
 
 	logoIter := memory.LogogramIteration{
+		Word:      word,
 		Generator: initMsg,
 		Adversary: memory.ResponseLogogramCritique{},
 	}
 
-	err = s.ws.InitialData.RecentLogogram.Enqueue(logoIter)
+	// publish shows the progress on the word. Pairs share the web server's
+	// queues, so they take turns.
+
+	publish := func(iter memory.LogogramIteration) error {
+		progress.Lock()
+		defer progress.Unlock()
+
+		err := s.ws.InitialData.RecentLogogram.Enqueue(iter)
+		if err != nil {
+			return err
+		}
+
+		s.ws.Broadcasters.LogogramDisplay.Broadcast(iter)
+
+		s.journal.record(
+			memory.JournalLogogram,
+			s.lineage,
+			s.run.currentGeneration()+1,
+			iter,
+		)
+
+		return nil
+	}
+
+	err = publish(logoIter)
 	if err != nil {
 		return "", err
 	}
 
-	s.ws.Broadcasters.LogogramDisplay.Broadcast(logoIter)
+	// interrupted ends the exchanges when an operator skips the logograms.
+	// An aborted generation puts the agents back and gives up on the word.
+
+	interrupted := func(err error) (bool, error) {
+		switch {
+		case err == nil:
+			return false, nil
+		case errors.Is(err, errLayerSkipped):
+			s.logger.Warnf("Skipping the rest of logogram %s", word)
+			return true, nil
+		default:
+			_ = s.resetAgents(context.WithoutCancel(ctx), clients)
+			return true, err
+		}
+	}
+
+	// skipped is set once the operator skips the logograms, so that the
+	// other pairs stop too.
+
+	var skipped error
+
+	// The watchdog waits on `waiting` to reply to `pending`, and gives up on
+	// the word once it has been nudged enough.
+
+	var (
+		timeout = s.config.procedures.replyTimeout
+		silence = time.NewTimer(timeout)
+		pending = kickoff
+		waiting = generator
+		nudges  int
+		gaveUp  bool
+	)
+
+	defer silence.Stop()
 
 	// In case the agents go out of control, cap `i` at `DefaultMaxExchanges`.
 
+exchange:
 	for (!adversaryOk || !generatorOk) && i <= DefaultMaxExchanges {
+		var m memory.Message
+
 		select {
 		case <-ctx.Done():
 			return "", ctx.Err()
-		case m := <-s.gs.Channel.ToServer:
-			var msg *chat.Message
+		case <-s.run.Changed():
+			stop, err := interrupted(s.run.Interrupted())
+			if err != nil {
+				return "", err
+			}
 
-			logoIter = memory.LogogramIteration{
-				Generator: logoIter.Generator,
-				Adversary: logoIter.Adversary,
+			if stop {
+				skipped = errLayerSkipped
+				break exchange
 			}
 
-			// Switch the message to the recipient based on the sender. If the
-			// sender is the generator, rewrite the response into one for
-			// the adversary. If the sender is the adversary, rewrite the message
-			// for the generator.
+			continue exchange
+		case <-silence.C:
+			s.watchNotes.add(s.watch(network.WatchdogEvent{
+				Kind:   watchTimeout,
+				Client: waiting.Name,
+				Layer:  chat.LogographyLayer,
+				Detail: fmt.Sprintf("no reply on %s after %s", word, timeout),
+			}))
+
+			if !alive(waiting) || nudges == s.config.procedures.replyRetries {
+				s.watchNotes.add(s.watch(network.WatchdogEvent{
+					Kind:   watchGaveUp,
+					Client: waiting.Name,
+					Layer:  chat.LogographyLayer,
+					Detail: fmt.Sprintf("keeping logogram %s as it is after %d exchanges", word, i),
+				}))
+
+				gaveUp = true
+				break exchange
+			}
 
-			switch m.Sender {
-			case generator.Name:
+			nudges++
 
-				// Make a message for the adversary.
+			s.watchNotes.add(s.watch(network.WatchdogEvent{
+				Kind:   watchNudge,
+				Client: waiting.Name,
+				Layer:  chat.LogographyLayer,
+				Detail: fmt.Sprintf("sending the last message on %s again, nudge %d", word, nudges),
+			}))
 
-				var res memory.ResponseLogogramIteration
+			err := s.swc(ctx, pending)
+			if err != nil {
+				return "", err
+			}
 
-				err := json.Unmarshal([]byte(m.Text), &res)
-				if err != nil {
-					return "", errors.Wrap(err, "failed to unmarshal agent logogram iteration")
-				}
+			silence.Reset(timeout)
+
+			continue exchange
+		case m = <-s.replies.from(generator.Name):
+		case m = <-s.replies.from(adversary.Name):
+		}
+
+		var msg *chat.Message
+
+		logoIter = memory.LogogramIteration{
+			Word:      word,
+			Generator: logoIter.Generator,
+			Adversary: logoIter.Adversary,
+		}
 
-				logoIter.Generator = res
+		// Switch the message to the recipient based on the sender. If the
+		// sender is the generator, rewrite the response into one for
+		// the adversary. If the sender is the adversary, rewrite the message
+		// for the generator.
 
-				currentSvg = res.Svg
+		switch m.Sender {
+		case generator.Name:
 
-				generatorOk = res.Stop
+			// Make a message for the adversary.
 
-				msg = s.cmd(
-					agent.RequestLogogramCritique,
-					res.Name+"\n"+res.Svg+"\n\n"+res.Response,
-				)(adversary)
+			var res memory.ResponseLogogramIteration
 
-				// Validate SVG, send to sys agent for correction.
+			err := json.Unmarshal([]byte(m.Text), &res)
+			if err != nil {
+				return "", errors.Wrap(err, "failed to unmarshal agent logogram iteration")
+			}
 
-			case adversary.Name:
+			logoIter.Generator = res
 
-				// Make a message for the generator.
+			currentSvg = res.Svg
 
-				var res memory.ResponseLogogramCritique
+			generatorOk = res.Stop
 
-				err := json.Unmarshal([]byte(m.Text), &res)
-				if err != nil {
-					return "", errors.Wrap(err, "failed to unmarshal generator logogram critique")
-				}
+			msg = s.cmd(
+				agent.RequestLogogramCritique,
+				res.Name+"\n"+res.Svg+"\n\n"+res.Response,
+			)(adversary)
 
-				logoIter.Adversary = res
+			// Validate SVG, send to sys agent for correction.
 
-				adversaryOk = res.Stop
+		case adversary.Name:
 
-				msg = s.cmd(agent.RequestLogogramIteration, res.Response)(generator)
-			}
+			// Make a message for the generator.
 
-			usedWords, err := s.extractUsedWords(ctx, newGeneration.Dictionary, m.Text.String())
+			var res memory.ResponseLogogramCritique
+
+			err := json.Unmarshal([]byte(m.Text), &res)
 			if err != nil {
-				return "", errors.Wrap(err, "failed finding used words")
+				return "", errors.Wrap(err, "failed to unmarshal generator logogram critique")
 			}
 
-			// Broadcast the sent message.
+			logoIter.Adversary = res
 
-			s.ws.Broadcasters.Messages.Broadcast(m)
+			adversaryOk = res.Stop
 
-			// Broadcast the extracted words from the sent message.
+			msg = s.cmd(agent.RequestLogogramIteration, res.Response)(generator)
+		}
 
-			s.ws.Broadcasters.MessageWordDictExtraction.Broadcast(usedWords)
+		logoIter.Exchange = i
 
-			err = s.ws.InitialData.RecentLogogram.Enqueue(logoIter)
-			if err != nil {
-				return "", err
-			}
+		// The word detector answers one request at a time.
 
-			s.ws.Broadcasters.LogogramDisplay.Broadcast(logoIter)
+		progress.Lock()
+		usedWords, err := s.extractUsedWords(ctx, newGeneration.Dictionary, m.Text.String())
+		progress.Unlock()
 
-			select {
-			case <-ctx.Done():
-				return "", ctx.Err()
-			case <-time.After(time.Second * 10):
-			}
+		if err != nil {
+			return "", errors.Wrap(err, "failed finding used words")
+		}
 
-			select {
-			case <-ctx.Done():
-				return "", ctx.Err()
-			case s.gs.Channel.ToClients <- msg:
-				// `i` is incremented here because an exchange is only when a message
-				// traverses the boundary of one agent to another.
+		// Broadcast the sent message.
 
-				i++
+		s.ws.Broadcasters.Messages.Broadcast(m)
 
-				s.logger.Debugf("Exchanges: %d", i)
-			}
+		// Broadcast the extracted words from the sent message.
+
+		s.ws.Broadcasters.MessageWordDictExtraction.Broadcast(usedWords)
+
+		err = publish(logoIter)
+		if err != nil {
+			return "", err
 		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(delay):
+		}
+
+		stop, err := interrupted(s.run.awaitExchange(ctx))
+		if err != nil {
+			return "", err
+		}
+
+		if stop {
+			skipped = errLayerSkipped
+			break exchange
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case s.gs.Channel.ToClients <- msg:
+			// `i` is incremented here because an exchange is only when a message
+			// traverses the boundary of one agent to another.
+
+			i++
+
+			s.logger.Debugf("%s exchanges: %d", word, i)
+		}
+
+		pending, nudges = msg, 0
+
+		waiting = generator
+		if m.Sender == generator.Name {
+			waiting = adversary
+		}
+
+		silence.Reset(timeout)
+	}
+
+	// Put everything back. An agent that missed its heartbeats cannot
+	// acknowledge its reset.
+
+	if gaveUp {
+		clients = slices.DeleteFunc(clients, func(c *network.ChatClient) bool {
+			return !alive(c)
+		})
 	}
 
-	// Put everything back.
+	err = s.resetAgents(ctx, clients)
+	if err != nil {
+		return "", err
+	}
 
-	s.resetAgents(ctx, clients)
+	logoIter.Exchange = i
+	logoIter.Done = true
 
-	return currentSvg, nil
+	err = publish(logoIter)
+	if err != nil {
+		return "", err
+	}
+
+	return currentSvg, skipped
 }
 
+// WaitForClients waits until `total` clients of the server's lineage have
+// joined. When the server has a roster, it waits for the agents on the roster
+// instead.
 func (s *ConlangServer) WaitForClients(total int) Job {
 	return func(ctx context.Context) error {
 		var err error
@@ -538,19 +986,44 @@ func (s *ConlangServer) WaitForClients(total int) Job {
 
 		defer joinCtxCancel()
 
+		expected := s.config.roster.expected(s.lineage)
+
+		// absent returns the agents on the roster that have not joined.
+
+		absent := func() []chat.Name {
+			return slices.DeleteFunc(slices.Clone(expected), func(n chat.Name) bool {
+				_, err := s.gs.GetClientByName(n)
+				return err == nil
+			})
+		}
+
 		go func() {
 			defer joinCtxCancel()
 			s.logger.Info("Waiting for clients to join...")
-			for {
+			for i := 1; ; i++ {
 				select {
 				case <-joinCtx.Done():
 					err = joinCtx.Err()
 					return
 				case <-time.After(time.Second):
-					if s.gs.TotalClients() >= total {
+					if len(expected) == 0 && len(s.clients()) >= total {
 						s.logger.Info("All clients joined!")
 						return
 					}
+
+					if len(expected) == 0 {
+						continue
+					}
+
+					names := absent()
+					if len(names) == 0 {
+						s.logger.Info("Every agent on the roster joined!")
+						return
+					}
+
+					if i%10 == 0 {
+						s.logger.Info("Waiting for agents on the roster", "missing", names)
+					}
 				}
 			}
 		}()
@@ -569,11 +1042,17 @@ func (s *ConlangServer) WaitForClients(total int) Job {
 
 type job interface {
 	do(ctx context.Context) error
+	Name() string
+	Stage() stage
 	String() string
+
+	// Elapsed is how long the job last took to do.
+	Elapsed() time.Duration
 }
 
 type procedure struct {
 	name    string
+	stage   stage
 	exec    Job
 	elapsed time.Duration
 }
@@ -586,11 +1065,27 @@ func (j *procedure) do(ctx context.Context) error {
 	return j.exec(ctx)
 }
 
+func (j *procedure) Name() string {
+	return j.name
+}
+
+func (j *procedure) Stage() stage {
+	return j.stage
+}
+
+func (j *procedure) Elapsed() time.Duration {
+	return j.elapsed
+}
+
 func (j *procedure) String() string {
 	return fmt.Sprintf("%s %s", j.name, j.elapsed)
 }
 
-func (s *ConlangServer) iterateSpecs(i int, g *memory.Generation) Job {
+func (s *ConlangServer) iterateSpecs(
+	layers []chat.Layer,
+	exchanges map[chat.Layer]int,
+	g *memory.Generation,
+) Job {
 	return func(ctx context.Context) error {
 		var err error
 
@@ -599,13 +1094,15 @@ func (s *ConlangServer) iterateSpecs(i int, g *memory.Generation) Job {
 			return errors.Wrap(err, "failed to iterate specs")
 		}
 
-		// Starts on Layer 4, recurses to 1.
+		// Evolve from the most recent generation.
+
+		i := s.run.currentGeneration()
 
 		*g, err = s.iterate(
 			ctx,
-			genSlice[i],
-			chat.LogographyLayer,
-			s.config.procedures.maxExchanges,
+			genSlice[len(genSlice)-1],
+			layers,
+			exchanges,
 		)
 		if err != nil {
 			return errors.Wrapf(err, "failed to iterate on generation %d", i)
@@ -617,64 +1114,131 @@ func (s *ConlangServer) iterateSpecs(i int, g *memory.Generation) Job {
 	}
 }
 
-func (s *ConlangServer) iterateLogograms(i int, g *memory.Generation) Job {
+// iterateLogograms iterates on the logograms of `words`, one word per pair of
+// logogram agents at a time, waiting `delay` between exchanges. When `words`
+// is empty, `wordCount` words are chosen by the strategies in `selection`
+// instead. How the words were chosen is recorded in the generation.
+func (s *ConlangServer) iterateLogograms(
+	words []string,
+	wordCount int,
+	selection []string,
+	delay time.Duration,
+	g *memory.Generation,
+) Job {
 	return func(ctx context.Context) error {
-		// Get the transcript of the logography layer.
-		t := g.Transcript[chat.LogographyLayer]
+		i := s.run.currentGeneration()
 
-		// Extract logogram names from logography transcript.
-		res, err := s.findUsedWords(ctx, g.Dictionary.Copy(), t.String())
-		if err != nil {
-			return err
+		var sel *memory.WordSelection
+
+		if len(words) > 0 {
+			sel = &memory.WordSelection{Strategies: []string{"words"}}
+			for _, w := range words {
+				sel.Words = append(sel.Words, memory.SelectedWord{Word: w, Strategy: "words"})
+			}
+		} else {
+			history, err := s.generations.ToSlice()
+			if err != nil {
+				return errors.Wrap(err, "failed to select words")
+			}
+
+			sel, err = s.selectWords(
+				ctx,
+				selection,
+				wordCount,
+				wordSelection{g: g, history: history},
+			)
+			if err != nil {
+				return err
+			}
 		}
 
-		// For each used word, iterate it.
+		g.WordSelection = sel
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+		// The job runs for every generation, so the words it chooses are
+		// kept apart from the pipeline's `words`.
 
-			// For now, do this rudimentary word selection:
+		chosen := make([]string, 0, len(sel.Words))
+		for _, w := range sel.Words {
+			chosen = append(chosen, w.Word)
+		}
 
-			words := res.Words[:3]
+		if len(chosen) == 0 {
+			s.logger.Warnf("No words were selected by %v", sel.Strategies)
+			return nil
+		}
 
-			// It can be made so that agents do not clear their memory on each
-			// iteration of a word to keep a long-running context window, but
-			// I currently do not have the money or compute for that, and I
-			// don't know if I ever will.
+		pairs, err := s.logogramPairs()
+		if err != nil {
+			return errors.Wrapf(err, "failed to iterate logograms on iteration %d", i)
+		}
 
-			for _, word := range words {
-				if word == "" {
-					continue
-				}
+		s.logger.Infof("Iterating on %d logograms with %d pairs", len(chosen), len(pairs))
 
-				svg, err := s.iterateLogogram(ctx, *g, word)
-				if err != nil {
-					return errors.Wrapf(err, "failed to iterate logograms on iteration %d", i)
-				}
+		s.run.enterLayer("logograms")
+		defer s.run.leaveLayer()
 
-				// This will automatically update the svg, so in the next iteration
-				// the agents will have access to their previous developed
-				// logograms.
+		// It can be made so that agents do not clear their memory on each
+		// iteration of a word to keep a long-running context window, but
+		// I currently do not have the money or compute for that, and I
+		// don't know if I ever will.
 
-				g.Logography[word] = svg
+		// Every pair starts from the same generation, so it does not matter
+		// which pair finishes first.
 
-				s.ws.Broadcasters.Generation.Broadcast(*g)
+		svgs, err := s.iterateWords(
+			ctx,
+			pairs,
+			chosen,
+			func(
+				ctx context.Context,
+				word string,
+				pair logogramPair,
+				progress *sync.Mutex,
+			) (string, error) {
+				return s.iterateLogogram(ctx, *g, word, pair, delay, progress)
+			},
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to iterate logograms on iteration %d", i)
+		}
 
-				s.dictionary = g.Dictionary.Copy()
+		// Merge in the order of `chosen`.
 
-				s.ws.Broadcasters.Generation.Broadcast(*g)
+		for j, word := range chosen {
+			if svgs[j] != "" {
+				g.Logography[word] = svgs[j]
 			}
-
-			return nil
 		}
+
+		s.ws.Broadcasters.Generation.Broadcast(*g)
+
+		return nil
 	}
 }
 
-func (s *ConlangServer) updateGenerations(i int, g *memory.Generation) Job {
+func (s *ConlangServer) updateGenerations(g *memory.Generation) Job {
 	return func(ctx context.Context) error {
-		err := s.generations.Enqueue(*g)
+		i := s.run.currentGeneration()
+
+		s.watchNotes.flush(g)
+
+		// When the pipeline evolves several candidates, only the one that
+		// is selected once they are all evolved becomes the generation.
+
+		selected, err := s.selectGeneration(ctx, *g)
+		if err != nil {
+			return errors.Wrapf(err, "failed to select generation %d", i)
+		}
+
+		if selected == nil {
+			return nil
+		}
+
+		*g = *selected
+
+		s.dictionary = g.Dictionary.Copy()
+
+		err = s.retain(*g)
 		if err != nil {
 			return errors.Wrapf(
 				err,
@@ -692,11 +1256,17 @@ func (s *ConlangServer) updateGenerations(i int, g *memory.Generation) Job {
 
 		s.ws.Broadcasters.Generation.Broadcast(*g)
 
+		s.journal.record(memory.JournalGeneration, s.lineage, i+1, *g)
+
+		s.run.generationDone()
+
+		s.exportPeriodically()
+
 		return nil
 	}
 }
 
-func (s *ConlangServer) iterateDictionary(_ int, g *memory.Generation) Job {
+func (s *ConlangServer) iterateDictionary(g *memory.Generation) Job {
 	return func(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
@@ -705,6 +1275,13 @@ func (s *ConlangServer) iterateDictionary(_ int, g *memory.Generation) Job {
 
 			s.logger.Info("Received dictionary update")
 
+			s.journal.record(
+				memory.JournalDictionary,
+				s.lineage,
+				s.run.currentGeneration()+1,
+				updates,
+			)
+
 			// Update the generation's dictionary based on updates.
 
 			currentDict := g.Dictionary.Copy()
@@ -759,49 +1336,191 @@ func (s *ConlangServer) exportData(t func() time.Duration) Job {
 			return nil
 		}
 
-		s.gs.Listening = false
+		// Agents of the other lineages are still evolving.
+
+		if s.lineage == DefaultLineage {
+			s.gs.Listening = false
+		}
 
 		s.logger.Info("EVOLUTION COMPLETE")
 		s.logger.Infof("Evolution took %s", t())
 
-		// Marshal to JSON
-
-		allMsgs, err := s.memory.All()
+		_, err := s.export()
 		if err != nil {
 			return err
 		}
 
-		fileName := fmt.Sprintf(
-			"./outputs/chats/chat_%s.json",
-			time.Now().Format("20060102150405"),
-		)
+		return nil
+	}
+}
 
-		err = saveToJson(allMsgs, fileName)
-		if err != nil {
-			return errors.Wrap(err, "evolution failed to save JSON")
-		}
+// export saves the chat history and the generations evolved so far to JSON
+// files, and returns the paths of those files.
+func (s *ConlangServer) export() ([]string, error) {
+	allMsgs, err := s.memory.All()
+	if err != nil {
+		return nil, err
+	}
 
-		s.logger.Infof("Saved chat to %s", fileName)
+	now := s.exportSuffix(time.Now())
 
-		fileName = fmt.Sprintf(
-			"./outputs/generations/generations_%s.json",
-			time.Now().Format("20060102150405"),
-		)
+	chatFile := filepath.Join(
+		s.config.files.outputs,
+		"chats",
+		fmt.Sprintf("chat_%s.json", now),
+	)
+
+	err = saveToJson(allMsgs, chatFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "evolution failed to save JSON")
+	}
 
-		g, err := s.generations.ToSlice()
+	s.logger.Infof("Saved chat to %s", chatFile)
+
+	generationsFile := filepath.Join(
+		s.config.files.outputs,
+		"generations",
+		fmt.Sprintf("generations_%s.json", now),
+	)
+
+	g, err := s.generations.ToSlice()
+	if err != nil {
+		return nil, errors.Wrap(err, "evolution failed to save JSON")
+	}
+
+	err = saveToJson(g, generationsFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "evolution failed to save JSON")
+	}
+
+	s.logger.Infof("Saved generations to %s", generationsFile)
+
+	changesFile := filepath.Join(
+		s.config.files.outputs,
+		"generations",
+		fmt.Sprintf("changes_%s.md", now),
+	)
+
+	err = os.WriteFile(changesFile, []byte(changelog(g, s.flushed)), 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "evolution failed to save changes")
+	}
+
+	s.logger.Infof("Saved specification changes to %s", changesFile)
+
+	bookFiles, err := s.exportBooks(g, now)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := s.manifest()
+	if err != nil {
+		return nil, errors.Wrap(err, "evolution failed to describe run")
+	}
+
+	manifestFile, err := s.saveManifest(m, now)
+	if err != nil {
+		return nil, err
+	}
+
+	files := append([]string{chatFile, generationsFile, changesFile}, bookFiles...)
+
+	return append(files, manifestFile), nil
+}
+
+// exportBooks writes the book of the latest generation of `gens` in every
+// format to the books directory, named by `suffix`, and returns the paths of
+// those files.
+func (s *ConlangServer) exportBooks(gens []memory.Generation, suffix string) ([]string, error) {
+	dir := filepath.Join(s.config.files.outputs, "books")
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create books directory")
+	}
+
+	var (
+		b     = book.New(fmt.Sprintf("%s, run %s", s.name, s.runID), gens, s.flushed)
+		files []string
+	)
+
+	for _, name := range slices.Sorted(maps.Keys(book.Formats)) {
+		f := book.Formats[name]
+
+		var buf bytes.Buffer
+
+		err = f.Write(&buf, b)
 		if err != nil {
-			return errors.Wrap(err, "evolution failed to save JSON")
+			return nil, errors.Wrapf(err, "failed to write %s book", name)
 		}
 
-		err = saveToJson(g, fileName)
+		p := filepath.Join(dir, fmt.Sprintf("%s_%s%s", f.Name, suffix, f.Extension))
+
+		err = os.WriteFile(p, buf.Bytes(), 0o644)
 		if err != nil {
-			return errors.Wrap(err, "evolution failed to save JSON")
+			return nil, errors.Wrapf(err, "failed to save %s book", name)
 		}
 
-		s.logger.Infof("Saved generations to %s", fileName)
+		files = append(files, p)
+	}
 
-		return nil
+	s.logger.Infof("Saved books to %s", dir)
+
+	return files, nil
+}
+
+// exportSuffix names the files of an export made at `t`. The files of
+// lineages other than the main one are named after their lineage too.
+func (s *ConlangServer) exportSuffix(t time.Time) string {
+	suffix := t.Format("20060102150405")
+	if s.lineage != DefaultLineage {
+		suffix += "_" + s.lineage
 	}
+
+	return suffix
+}
+
+// changelog describes how the specifications of `gens` changed and why, as
+// Markdown. `first` is the number of the first generation of `gens`.
+func changelog(gens []memory.Generation, first int) string {
+	var sb strings.Builder
+
+	for i, g := range gens {
+		if len(g.Changes) == 0 {
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf("# Generation %d\n\n", first+i))
+
+		if f := g.Fitness; f != nil {
+			sb.WriteString(fmt.Sprintf(
+				"Selected candidate %d of %d by %s, scoring %.3f.\n\n",
+				f.Selected+1,
+				len(f.Candidates),
+				f.Selection,
+				f.Candidates[f.Selected].Score,
+			))
+		}
+
+		for _, layer := range slices.Sorted(maps.Keys(g.Changes)) {
+			c := g.Changes[layer]
+
+			sb.WriteString(fmt.Sprintf("## %s\n\n", layer))
+
+			if c.Explanation != "" {
+				sb.WriteString(c.Explanation + "\n\n")
+			}
+
+			if len(c.Diff) == 0 {
+				sb.WriteString("No changes.\n\n")
+				continue
+			}
+
+			sb.WriteString("```diff\n" + c.String() + "```\n\n")
+		}
+	}
+
+	return sb.String()
 }
 
 func (s *ConlangServer) TestIterateLogogram(ctx context.Context) error {
@@ -810,7 +1529,19 @@ func (s *ConlangServer) TestIterateLogogram(ctx context.Context) error {
 		return err
 	}
 
-	svg, err := s.iterateLogogram(ctx, g[0], "suli")
+	pairs, err := s.logogramPairs()
+	if err != nil {
+		return err
+	}
+
+	svg, err := s.iterateLogogram(
+		ctx,
+		g[0],
+		"suli",
+		pairs[0],
+		s.config.procedures.waitDuration,
+		&sync.Mutex{},
+	)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,687 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+	"codeberg.org/n30w/jasima/pkg/utils"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+)
+
+// recording is a recorded run, as the events its web server broadcast in
+// the order they happened.
+type recording struct {
+	// run names the recording, after the file it was read from.
+	run    string
+	events []recordedEvent
+
+	// generations is the number of the last generation of the recording.
+	generations int
+}
+
+// recordedEvent is an event of a recording.
+type recordedEvent struct {
+	// at is how long after the recording started the event happened.
+	at time.Duration
+
+	// generation is the number of generations evolved when the event
+	// happened.
+	generation int
+
+	// data is the replayedMessage, memory.SpecificationChange,
+	// memory.LogogramIteration or memory.Generation the event broadcast.
+	data any
+}
+
+// replayedMessage is a message of a recording, with the words of the
+// dictionary it used.
+type replayedMessage struct {
+	msg   memory.Message
+	words memory.ResponseDictionaryWordsDetection
+}
+
+// add appends an event to the recording. Events never go back in time, even
+// when lineages recorded them out of order.
+func (rec *recording) add(at time.Duration, generation int, data any) {
+	if n := len(rec.events); n > 0 {
+		at = max(at, rec.events[n-1].at)
+	}
+
+	rec.events = append(rec.events, recordedEvent{
+		at:         at,
+		generation: generation,
+		data:       data,
+	})
+
+	rec.generations = max(rec.generations, generation)
+}
+
+func (rec *recording) length() time.Duration {
+	if len(rec.events) == 0 {
+		return 0
+	}
+
+	return rec.events[len(rec.events)-1].at
+}
+
+// seekGeneration returns where the replay of generation `n` ends: the index
+// of the event after it, and when it was evolved. It reports false when the
+// recording does not have the generation.
+func (rec *recording) seekGeneration(n int) (int, time.Duration, bool) {
+	i := slices.IndexFunc(rec.events, func(ev recordedEvent) bool {
+		_, ok := ev.data.(memory.Generation)
+		return ok && ev.generation == n
+	})
+	if i == -1 {
+		return 0, 0, false
+	}
+
+	return i + 1, rec.events[i].at, true
+}
+
+// seekPosition returns the index of the first event after `at`, and `at`
+// within the length of the recording.
+func (rec *recording) seekPosition(at time.Duration) (int, time.Duration) {
+	at = min(max(at, 0), rec.length())
+
+	i := sort.Search(len(rec.events), func(i int) bool {
+		return rec.events[i].at > at
+	})
+
+	return i, at
+}
+
+// recordedRun finds the recording of run `run` in outputs directory `dir`,
+// or its latest recording when `run` is empty. Journals are preferred over
+// exported generations, since they also record logograms and when every
+// event happened.
+func recordedRun(dir, run string) (string, error) {
+	for _, pattern := range []string{
+		filepath.Join(dir, "journal", "journal_*.jsonl"),
+		filepath.Join(dir, "generations", "generations_*.json"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", err
+		}
+
+		slices.Sort(matches)
+
+		for i := len(matches) - 1; i >= 0; i-- {
+			if run == "" || runName(matches[i]) == run {
+				return matches[i], nil
+			}
+		}
+	}
+
+	if run == "" {
+		return "", errors.Errorf("%s has no recorded runs", dir)
+	}
+
+	return "", errors.Errorf("%s has no recording of run %s", dir, run)
+}
+
+// runName is the name of the run a journal or an export was written by.
+func runName(p string) string {
+	base := filepath.Base(p)
+	_, name, _ := strings.Cut(strings.TrimSuffix(base, filepath.Ext(base)), "_")
+
+	return name
+}
+
+// loadRecording reads the recording the server is configured to replay.
+func (s *ConlangServer) loadRecording() (*recording, error) {
+	p, err := recordedRun(s.config.replay.path, s.config.replay.run)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &recording{run: runName(p)}
+
+	if filepath.Ext(p) == ".jsonl" {
+		err = s.readJournalRecording(rec, p)
+	} else {
+		err = s.readExportRecording(rec, p)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read recording %s", p)
+	}
+
+	if len(rec.events) == 0 {
+		return nil, errors.Errorf("recording %s is empty", p)
+	}
+
+	return rec, nil
+}
+
+// journalDecoders decode the events of a journal that are replayed, by kind.
+var journalDecoders = map[memory.JournalKind]func(json.RawMessage) (any, error){
+	memory.JournalMessage:       decodeEvent[memory.Message],
+	memory.JournalSpecification: decodeEvent[memory.SpecificationChange],
+	memory.JournalLogogram:      decodeEvent[memory.LogogramIteration],
+	memory.JournalGeneration:    decodeEvent[memory.Generation],
+}
+
+func decodeEvent[T any](b json.RawMessage) (any, error) {
+	var v T
+
+	err := json.Unmarshal(b, &v)
+
+	return v, err
+}
+
+// readJournalRecording reads the main lineage of the journal at `p`.
+func (s *ConlangServer) readJournalRecording(rec *recording, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var (
+		start   time.Time
+		evolved int
+		dict    memory.DictionaryGeneration
+	)
+
+	err = memory.ScanJournal(f, func(_ int, ev memory.JournalEvent) error {
+		decode, ok := journalDecoders[ev.Kind]
+		if !ok || ev.Lineage != "" && ev.Lineage != DefaultLineage {
+			return nil
+		}
+
+		data, err := decode(ev.Data)
+		if err != nil {
+			return err
+		}
+
+		if start.IsZero() {
+			start = ev.Time
+		}
+
+		switch d := data.(type) {
+		case memory.Message:
+			if !s.replayed(d) {
+				return nil
+			}
+
+			data = replayedMessage{
+				msg:   d,
+				words: s.findUsedWordsRegex(dict, d.Text.String()),
+			}
+		case memory.Generation:
+			evolved = ev.Generation
+			dict = d.Dictionary
+		}
+
+		rec.add(ev.Time.Sub(start), evolved, data)
+
+		return nil
+	})
+	if errors.Is(err, memory.ErrJournalTorn) {
+		s.logger.Warnf("Replaying %s without its last line: %v", p, err)
+		return nil
+	}
+
+	return err
+}
+
+// readExportRecording reads the exported generations file at `p`. Exports
+// only record when messages were sent, so every generation is replayed
+// right after its last message, with the changes to its specifications.
+func (s *ConlangServer) readExportRecording(rec *recording, p string) error {
+	gens, err := loadJsonFile[memory.Generation](p)
+	if err != nil {
+		return err
+	}
+
+	if len(gens) == 0 {
+		return nil
+	}
+
+	var start time.Time
+
+	for _, g := range gens {
+		for _, t := range g.Transcript {
+			for _, m := range t {
+				if start.IsZero() || m.Timestamp.Before(start) {
+					start = m.Timestamp
+				}
+			}
+		}
+	}
+
+	rec.add(0, 0, gens[0])
+
+	for i, g := range gens[1:] {
+		var msgs []memory.Message
+
+		for _, t := range g.Transcript {
+			msgs = append(msgs, t...)
+		}
+
+		slices.SortStableFunc(msgs, func(a, b memory.Message) int {
+			return a.Timestamp.Compare(b.Timestamp)
+		})
+
+		for _, m := range msgs {
+			if !s.replayed(m) {
+				continue
+			}
+
+			rec.add(m.Timestamp.Sub(start), i, replayedMessage{
+				msg:   m,
+				words: s.findUsedWordsRegex(gens[i].Dictionary, m.Text.String()),
+			})
+		}
+
+		at := rec.length()
+
+		for _, l := range slices.Sorted(maps.Keys(g.Changes)) {
+			rec.add(at, i, g.Changes[l])
+		}
+
+		rec.add(at, i+1, g)
+	}
+
+	return nil
+}
+
+// replayed reports whether `m` was shown on the frontend when it was sent.
+// Only agents conversing on a layer are.
+func (s *ConlangServer) replayed(m memory.Message) bool {
+	return m.Command == agent.NoCommand &&
+		m.Layer != chat.SystemLayer &&
+		m.Sender != s.name
+}
+
+// replay plays a recording through the web server's feeds, the way they were
+// broadcast when the run was recorded. Operators pause, seek, speed up and
+// loop it.
+type replay struct {
+	mu  sync.Mutex
+	rec *recording
+
+	speed  float64
+	loop   bool
+	paused bool
+
+	// next is the index of the next event to play.
+	next int
+
+	// position is how far into the recording the replay was at `clock`.
+	position time.Duration
+	clock    time.Time
+
+	// generation is the number of generations evolved at `position`.
+	generation int
+
+	// changed is closed and replaced every time an operator changes the
+	// replay, to wake up the player.
+	changed chan struct{}
+}
+
+func newReplay(rec *recording, cfg replayConfig) *replay {
+	return &replay{
+		rec:     rec,
+		speed:   cfg.speed,
+		loop:    cfg.loop,
+		clock:   time.Now(),
+		changed: make(chan struct{}),
+	}
+}
+
+// now is how far into the recording the replay is. It must be called with
+// the lock held.
+func (r *replay) now() time.Duration {
+	if r.paused {
+		return r.position
+	}
+
+	return r.position + time.Duration(float64(time.Since(r.clock))*r.speed)
+}
+
+// update applies `f` to the replay while locked, then wakes up the player.
+// Time played so far is kept, so that `f` may change how fast time passes.
+func (r *replay) update(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.position = r.now()
+	r.clock = time.Now()
+
+	f()
+
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// State returns the current state of the replay.
+func (r *replay) State() network.ReplayState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return network.ReplayState{
+		Run:         r.rec.run,
+		Paused:      r.paused,
+		Loop:        r.loop,
+		Speed:       r.speed,
+		Position:    min(r.now(), r.rec.length()),
+		Length:      r.rec.length(),
+		Generation:  r.generation,
+		Generations: r.rec.generations,
+	}
+}
+
+// replayRecording plays the recording until the server shuts down.
+func (s *ConlangServer) replayRecording(ctx context.Context) {
+	r := s.replay
+
+	s.logger.Info(
+		"Replaying run",
+		"run", r.rec.run,
+		"events", len(r.rec.events),
+		"length", r.rec.length(),
+		"speed", r.speed,
+	)
+
+	r.update(func() {
+		s.seekReplay(0, 0)
+	})
+
+	s.broadcastReplayState()
+
+	for {
+		var wait <-chan time.Time
+
+		r.mu.Lock()
+
+		changed := r.changed
+
+		// A recording that takes no time is not looped, or it would be
+		// played over and over without end.
+
+		if r.next == len(r.rec.events) && r.loop && !r.paused && r.rec.length() > 0 {
+			s.seekReplay(0, 0)
+		}
+
+		if r.next < len(r.rec.events) && !r.paused {
+			d := time.Duration(float64(r.rec.events[r.next].at-r.now()) / r.speed)
+			wait = time.After(max(d, 0))
+		}
+
+		r.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			continue
+		case <-wait:
+		}
+
+		r.mu.Lock()
+
+		// An operator may have changed the replay as the event came due.
+
+		if r.changed != changed {
+			r.mu.Unlock()
+			continue
+		}
+
+		ev := r.rec.events[r.next]
+		s.playEvent(ev, true)
+		r.next++
+
+		ended := r.next == len(r.rec.events)
+
+		r.mu.Unlock()
+
+		if _, ok := ev.data.(memory.Generation); ok {
+			s.broadcastReplayState()
+		}
+
+		if ended {
+			s.logger.Info("Replayed the whole run", "loop", r.loop)
+		}
+	}
+}
+
+// seekReplay moves the replay to event `i`, `position` into the recording.
+// The feeds' initial data is rebuilt from the events before it, and
+// connected displays are sent the generation at that point. It must be
+// called with the replay locked.
+func (s *ConlangServer) seekReplay(i int, position time.Duration) {
+	r := s.replay
+	d := s.ws.InitialData
+
+	drain(d.RecentMessages)
+	drain(d.RecentUsedWords)
+	drain(d.RecentChanges)
+	drain(d.RecentLogogram)
+	drain(d.RecentGenerations)
+	drain(d.RecentSpecifications)
+
+	r.generation = 0
+
+	var latest *memory.Generation
+
+	for _, ev := range r.rec.events[:i] {
+		s.playEvent(ev, false)
+
+		if g, ok := ev.data.(memory.Generation); ok {
+			latest = &g
+		}
+	}
+
+	r.next = i
+	r.position = position
+	r.clock = time.Now()
+
+	if latest != nil {
+		s.ws.Broadcasters.Generation.Broadcast(*latest)
+		s.ws.Broadcasters.Specification.Broadcast(latest.Specifications)
+	}
+}
+
+// playEvent saves an event to the initial data of its feed and, when `live`,
+// broadcasts it. It must be called with the replay locked.
+func (s *ConlangServer) playEvent(ev recordedEvent, live bool) {
+	var (
+		b = s.ws.Broadcasters
+		d = s.ws.InitialData
+	)
+
+	s.replay.generation = ev.generation
+
+	switch e := ev.data.(type) {
+	case replayedMessage:
+		enqueue(s.logger, d.RecentMessages, e.msg)
+		enqueue(s.logger, d.RecentUsedWords, e.words)
+
+		if live {
+			b.Messages.Broadcast(e.msg)
+			b.MessageWordDictExtraction.Broadcast(e.words)
+		}
+	case memory.SpecificationChange:
+		enqueue(s.logger, d.RecentChanges, e)
+
+		if live {
+			b.SpecificationChange.Broadcast(e)
+		}
+	case memory.LogogramIteration:
+		enqueue(s.logger, d.RecentLogogram, e)
+
+		if live {
+			b.LogogramDisplay.Broadcast(e)
+		}
+	case memory.Generation:
+		enqueue(s.logger, d.RecentGenerations, e)
+		enqueue(s.logger, d.RecentSpecifications, e.Specifications)
+
+		if live {
+			b.Generation.Broadcast(e)
+			b.Specification.Broadcast(e.Specifications)
+		}
+	}
+}
+
+// broadcastReplayState shows displays whether the replay is paused, and at
+// which generation.
+func (s *ConlangServer) broadcastReplayState() {
+	st := s.replay.State()
+
+	s.broadcastRunState(network.RunState{
+		Paused:     st.Paused,
+		Unit:       string(unitJob),
+		Job:        "replay",
+		Generation: st.Generation,
+	})
+}
+
+func enqueue[T any](l *log.Logger, q utils.Queue[T], item T) {
+	err := q.Enqueue(item)
+	if err != nil {
+		l.Errorf("failed to save %T to InitialData: %v", item, err)
+	}
+}
+
+func drain[T any](q utils.Queue[T]) {
+	for _, err := q.Dequeue(); err == nil; _, err = q.Dequeue() {
+	}
+}
+
+func (s *ConlangServer) handleReplayState(w http.ResponseWriter, _ *http.Request) {
+	network.WriteJson(w, http.StatusOK, s.replay.State())
+}
+
+func (s *ConlangServer) handleReplayPause(w http.ResponseWriter, _ *http.Request) {
+	s.replay.update(func() {
+		s.replay.paused = true
+	})
+
+	s.logger.Warn("Operator paused the replay")
+
+	s.writeReplayState(w)
+}
+
+func (s *ConlangServer) handleReplayResume(w http.ResponseWriter, _ *http.Request) {
+	s.replay.update(func() {
+		s.replay.paused = false
+	})
+
+	s.logger.Warn("Operator resumed the replay")
+
+	s.writeReplayState(w)
+}
+
+// handleReplaySeek moves the replay to the `position` into the recording, or
+// to right after generation `generation` was evolved.
+func (s *ConlangServer) handleReplaySeek(w http.ResponseWriter, r *http.Request) {
+	var (
+		q  = r.URL.Query()
+		i  int
+		at time.Duration
+	)
+
+	switch {
+	case q.Has("generation"):
+		n, err := strconv.Atoi(q.Get("generation"))
+		if err != nil {
+			network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: "invalid generation"})
+			return
+		}
+
+		var ok bool
+
+		i, at, ok = s.replay.rec.seekGeneration(n)
+		if !ok {
+			network.WriteJson(
+				w,
+				http.StatusNotFound,
+				network.AdminError{Error: "generation " + strconv.Itoa(n) + " is not in the recording"},
+			)
+			return
+		}
+	case q.Has("position"):
+		d, err := time.ParseDuration(q.Get("position"))
+		if err != nil {
+			network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: "invalid position"})
+			return
+		}
+
+		i, at = s.replay.rec.seekPosition(d)
+	default:
+		network.WriteJson(
+			w,
+			http.StatusBadRequest,
+			network.AdminError{Error: "seek requires a position or a generation"},
+		)
+		return
+	}
+
+	s.replay.update(func() {
+		s.seekReplay(i, at)
+	})
+
+	s.logger.Warn("Operator moved the replay", "position", at)
+
+	s.writeReplayState(w)
+}
+
+func (s *ConlangServer) handleReplaySpeed(w http.ResponseWriter, r *http.Request) {
+	speed, err := strconv.ParseFloat(r.URL.Query().Get("speed"), 64)
+	if err != nil || speed <= 0 {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: "speed must be positive"})
+		return
+	}
+
+	s.replay.update(func() {
+		s.replay.speed = speed
+	})
+
+	s.logger.Warn("Operator changed the replay speed", "speed", speed)
+
+	s.writeReplayState(w)
+}
+
+func (s *ConlangServer) handleReplayLoop(w http.ResponseWriter, r *http.Request) {
+	loop, err := strconv.ParseBool(r.URL.Query().Get("loop"))
+	if err != nil {
+		network.WriteJson(w, http.StatusBadRequest, network.AdminError{Error: "loop must be true or false"})
+		return
+	}
+
+	s.replay.update(func() {
+		s.replay.loop = loop
+	})
+
+	s.logger.Warn("Operator changed the replay loop", "loop", loop)
+
+	s.writeReplayState(w)
+}
+
+// writeReplayState answers a replay control request with the new state of the
+// replay, and shows it on displays.
+func (s *ConlangServer) writeReplayState(w http.ResponseWriter) {
+	s.broadcastReplayState()
+
+	network.WriteJson(w, http.StatusOK, s.replay.State())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/memory"
+)
+
+func TestRecording_seek(t *testing.T) {
+	var rec recording
+
+	// Generation 1 is evolved at 3s and generation 2 at 6s, with messages
+	// before and after each. The message at 5s is out of order, and is
+	// recorded at 6s.
+
+	rec.add(0, 0, memory.Generation{})
+	rec.add(1*time.Second, 0, replayedMessage{})
+	rec.add(3*time.Second, 1, memory.Generation{})
+	rec.add(3*time.Second, 1, replayedMessage{})
+	rec.add(6*time.Second, 2, memory.Generation{})
+	rec.add(5*time.Second, 2, replayedMessage{})
+	rec.add(8*time.Second, 2, replayedMessage{})
+
+	t.Run("generation", func(t *testing.T) {
+		tests := []struct {
+			generation int
+			wantNext   int
+			wantAt     time.Duration
+			wantOk     bool
+		}{
+			{0, 1, 0, true},
+			{1, 3, 3 * time.Second, true},
+			{2, 5, 6 * time.Second, true},
+			{3, 0, 0, false},
+			{-1, 0, 0, false},
+		}
+
+		for _, tt := range tests {
+			next, at, ok := rec.seekGeneration(tt.generation)
+			if next != tt.wantNext || at != tt.wantAt || ok != tt.wantOk {
+				t.Errorf(
+					"seekGeneration(%d) = %d, %s, %t, want %d, %s, %t",
+					tt.generation,
+					next, at, ok,
+					tt.wantNext, tt.wantAt, tt.wantOk,
+				)
+			}
+		}
+	})
+
+	t.Run("position", func(t *testing.T) {
+		tests := []struct {
+			position time.Duration
+			wantNext int
+			wantAt   time.Duration
+		}{
+			{-time.Second, 1, 0},
+			{0, 1, 0},
+			{2 * time.Second, 2, 2 * time.Second},
+			{3 * time.Second, 4, 3 * time.Second},
+			{6 * time.Second, 6, 6 * time.Second},
+			{7 * time.Second, 6, 7 * time.Second},
+			{8 * time.Second, 7, 8 * time.Second},
+			{time.Minute, 7, 8 * time.Second},
+		}
+
+		for _, tt := range tests {
+			next, at := rec.seekPosition(tt.position)
+			if next != tt.wantNext || at != tt.wantAt {
+				t.Errorf(
+					"seekPosition(%s) = %d, %s, want %d, %s",
+					tt.position,
+					next, at,
+					tt.wantNext, tt.wantAt,
+				)
+			}
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var empty recording
+
+		if next, at := empty.seekPosition(time.Second); next != 0 || at != 0 {
+			t.Errorf("seekPosition(1s) = %d, %s, want 0, 0s", next, at)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+)
+
+// DefaultReplyBuffer is how many replies of a single agent are held before
+// the router blocks.
+const DefaultReplyBuffer = 100
+
+// replies holds the replies of system agents to the server, by sender. A
+// procedure waits on the agents it asked, so procedures that run at once do
+// not take each other's replies.
+type replies struct {
+	mu    sync.Mutex
+	boxes map[chat.Name]memory.MessageChannel
+}
+
+func newReplies() *replies {
+	return &replies{boxes: make(map[chat.Name]memory.MessageChannel)}
+}
+
+// from returns the replies of `name`.
+func (r *replies) from(name chat.Name) memory.MessageChannel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	box, ok := r.boxes[name]
+	if !ok {
+		box = make(memory.MessageChannel, DefaultReplyBuffer)
+		r.boxes[name] = box
+	}
+
+	return box
+}
+
+// drain discards the replies of `name` that no one waited for.
+func (r *replies) drain(name chat.Name) {
+	box := r.from(name)
+
+	for {
+		select {
+		case <-box:
+		default:
+			return
+		}
+	}
+}
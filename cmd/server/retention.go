@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/utils"
+
+	"github.com/pkg/errors"
+)
+
+// flushedGeneration is a line of a history file.
+type flushedGeneration struct {
+	// Number is the number of the generation in the run.
+	Number int `json:"generation"`
+
+	memory.Generation
+}
+
+// newGenerationWindow creates the queue that keeps the generations of a run
+// in memory, and enqueues `gens`. When only the last `retainGenerations` are
+// kept, the generations that do not fit are left out, and their number is
+// returned.
+func newGenerationWindow(
+	p procedureConfig,
+	gens []memory.Generation,
+) (utils.Queue[memory.Generation], int, error) {
+	size := max(p.maxGenerations+1, len(gens))
+
+	if p.retainGenerations > 0 {
+		size = p.retainGenerations
+	}
+
+	generations, err := utils.NewStaticFixedQueue[memory.Generation](size)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to create generation queue")
+	}
+
+	dropped := max(len(gens)-size, 0)
+
+	err = generations.Enqueue(gens[dropped:]...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to enqueue generations")
+	}
+
+	return generations, dropped, nil
+}
+
+// retain keeps generation `g` in memory. Once the window of retained
+// generations is full, its oldest generation is flushed to the run's
+// history file to make room.
+func (s *ConlangServer) retain(g memory.Generation) error {
+	if n := s.config.procedures.retainGenerations; n > 0 {
+		gens, err := s.generations.ToSlice()
+		if err != nil {
+			return errors.Wrap(err, "failed to read generations")
+		}
+
+		if len(gens) >= n {
+			oldest, err := s.generations.Dequeue()
+			if err != nil {
+				return errors.Wrap(err, "failed to dequeue oldest generation")
+			}
+
+			err = s.flush(oldest)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.generations.Enqueue(g)
+}
+
+// flush appends the oldest generation kept in memory, `g`, to the run's
+// history file.
+func (s *ConlangServer) flush(g memory.Generation) error {
+	dir := filepath.Join(s.config.files.outputs, "generations")
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return errors.Wrap(err, "failed to create history directory")
+	}
+
+	p := filepath.Join(dir, fmt.Sprintf("history_%s.jsonl", s.runID))
+
+	b, err := json.Marshal(flushedGeneration{Number: s.flushed, Generation: g})
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal generation %d", s.flushed)
+	}
+
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open history file")
+	}
+
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		return errors.Wrapf(err, "failed to flush generation %d", s.flushed)
+	}
+
+	s.logger.Debugf("Flushed generation %d to %s", s.flushed, p)
+
+	s.flushed++
+
+	return nil
+}
+
+// exportPeriodically exports the run every `exportEvery` generations, and
+// once `exportInterval` has passed since the last export. It is checked as
+// each generation completes, so that runs that never finish still leave
+// their data behind.
+func (s *ConlangServer) exportPeriodically() {
+	var (
+		p   = s.config.procedures
+		n   = s.run.currentGeneration()
+		due = p.exportEvery > 0 && n%p.exportEvery == 0 ||
+			p.exportInterval > 0 && time.Since(s.exported) >= p.exportInterval
+	)
+
+	if !due {
+		return
+	}
+
+	_, err := s.export()
+	if err != nil {
+		s.record.error(n, "", err)
+		s.logger.Warnf("failed periodic export after generation %d: %v", n, err)
+		return
+	}
+
+	s.exported = time.Now()
+}
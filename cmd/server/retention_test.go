@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"codeberg.org/n30w/jasima/pkg/memory"
+
+	"github.com/charmbracelet/log"
+)
+
+// generations returns `n` generations, numbered from `from` by the single
+// word of their dictionary.
+func generations(from, n int) []memory.Generation {
+	gens := make([]memory.Generation, 0, n)
+	for i := from; i < from+n; i++ {
+		gens = append(gens, memory.Generation{Dictionary: dictionary(fmt.Sprint(i))})
+	}
+
+	return gens
+}
+
+// numbers returns the number each of `gens` was given by generations.
+func numbers(gens []memory.Generation) []string {
+	n := make([]string, 0, len(gens))
+	for _, g := range gens {
+		for w := range g.Dictionary {
+			n = append(n, w)
+		}
+	}
+
+	return n
+}
+
+func TestNewGenerationWindow(t *testing.T) {
+	tests := []struct {
+		name         string
+		procedures   procedureConfig
+		gens         []memory.Generation
+		wantCapacity int
+		wantKept     []string
+		wantDropped  int
+	}{
+		{
+			name:         "every generation of a new run",
+			procedures:   procedureConfig{maxGenerations: 3},
+			gens:         generations(0, 1),
+			wantCapacity: 4,
+			wantKept:     []string{"0"},
+		},
+		{
+			name:         "every generation of a resumed run",
+			procedures:   procedureConfig{maxGenerations: 3},
+			gens:         generations(0, 6),
+			wantCapacity: 6,
+			wantKept:     []string{"0", "1", "2", "3", "4", "5"},
+		},
+		{
+			name:         "retained generations of a new run",
+			procedures:   procedureConfig{maxGenerations: 10, retainGenerations: 3},
+			gens:         generations(0, 1),
+			wantCapacity: 3,
+			wantKept:     []string{"0"},
+		},
+		{
+			name:         "retained generations of a resumed run",
+			procedures:   procedureConfig{maxGenerations: 10, retainGenerations: 3},
+			gens:         generations(0, 5),
+			wantCapacity: 3,
+			wantKept:     []string{"2", "3", "4"},
+			wantDropped:  2,
+		},
+		{
+			name:         "as many generations as are retained",
+			procedures:   procedureConfig{maxGenerations: 10, retainGenerations: 3},
+			gens:         generations(0, 3),
+			wantCapacity: 3,
+			wantKept:     []string{"0", "1", "2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, dropped, err := newGenerationWindow(tt.procedures, tt.gens)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+
+			gens, err := window.ToSlice()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := numbers(gens); !slices.Equal(got, tt.wantKept) {
+				t.Errorf("kept %v, want %v", got, tt.wantKept)
+			}
+
+			// The window takes generations until it is full.
+
+			capacity := len(gens)
+			for window.Enqueue(memory.Generation{}) == nil {
+				capacity++
+			}
+
+			if capacity != tt.wantCapacity {
+				t.Errorf("capacity = %d, want %d", capacity, tt.wantCapacity)
+			}
+		})
+	}
+}
+
+func TestConlangServer_retain(t *testing.T) {
+	// The run is resumed, or forked, from generations 0 to 4, of which
+	// generation 0 was already flushed and 1 is dropped from the window.
+
+	var (
+		procedures = procedureConfig{maxGenerations: 10, retainGenerations: 3}
+		dir        = t.TempDir()
+	)
+
+	window, dropped, err := newGenerationWindow(procedures, generations(1, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &ConlangServer{
+		logger: log.New(io.Discard),
+		config: &config{
+			procedures: procedures,
+			files:      filePathConfig{outputs: dir},
+		},
+		runID:       "run",
+		generations: window,
+		flushed:     1 + dropped,
+	}
+
+	for _, g := range generations(5, 3) {
+		err := s.retain(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gens, err := s.generations.ToSlice()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := numbers(gens), []string{"5", "6", "7"}; !slices.Equal(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+
+	if s.flushed != 5 {
+		t.Errorf("flushed = %d, want 5", s.flushed)
+	}
+
+	// Generation 1 was dropped when the window was created, so it is in
+	// the history of the run it came from, and not flushed again.
+
+	f, err := os.Open(filepath.Join(dir, "generations", "history_run.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	var got []string
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var fg flushedGeneration
+
+		err := json.Unmarshal(sc.Bytes(), &fg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n := numbers([]memory.Generation{fg.Generation})
+		if want := fmt.Sprint(fg.Number); !slices.Equal(n, []string{want}) {
+			t.Errorf("generation %v was flushed as generation %d", n, fg.Number)
+		}
+
+		got = append(got, n...)
+	}
+
+	if want := []string{"2", "3", "4"}; !slices.Equal(got, want) {
+		t.Errorf("flushed %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+)
+
+// roleSpeaker is the role of agents that take part in the conversations of
+// their layer. Every other role is a capability of system agents.
+const roleSpeaker agent.Capability = "speaker"
+
+// rosterSettings is an expected agent as it is written in the server's
+// configuration.
+type rosterSettings struct {
+	Name  string `toml:"name"`
+	Layer string `toml:"layer"`
+
+	// Roles are what the server asks of the agent: "speaker" on a layer,
+	// or one of the capabilities of system agents on the system layer.
+	Roles []string `toml:"roles"`
+
+	// Peers are the agents the agent talks to. An agent that registers
+	// with other peers is warned about.
+	Peers []string `toml:"peers"`
+
+	// Lineage is the lineage the agent takes part in. It defaults to the
+	// main lineage.
+	Lineage string `toml:"lineage"`
+}
+
+// rosterEntry is a validated expected agent.
+type rosterEntry struct {
+	name    chat.Name
+	layer   chat.Layer
+	roles   []agent.Capability
+	peers   []chat.Name
+	lineage string
+}
+
+// roster holds the agents a server expects, by name. When it is empty, every
+// agent is admitted and roles are resolved from the capabilities agents
+// declare.
+type roster map[chat.Name]rosterEntry
+
+// newRoster validates the roster of the server's configuration against the
+// layers in `ls`. `server` is the name of the server, which agents may have
+// as a peer.
+func newRoster(entries []rosterSettings, ls layerSet, server string) (roster, error) {
+	r := make(roster, len(entries))
+
+	for i, e := range entries {
+		key := fmt.Sprintf("roster[%d]", i)
+
+		if e.Name == "" {
+			return nil, errors.Errorf("%s.name: must not be empty", key)
+		}
+
+		name := chat.Name(e.Name)
+
+		if _, ok := r[name]; ok {
+			return nil, errors.Errorf("%s.name: %s is listed more than once", key, name)
+		}
+
+		if name == chat.ModeratorName || e.Name == server {
+			return nil, errors.Errorf("%s.name: %s is reserved", key, name)
+		}
+
+		layer, err := chat.ParseLayer(e.Layer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s.layer", key)
+		}
+
+		if layer != chat.SystemLayer && ls.get(layer) == nil {
+			return nil, errors.Errorf("%s.layer: %s is not defined", key, layer)
+		}
+
+		if len(e.Roles) == 0 {
+			return nil, errors.Errorf("%s.roles: must not be empty", key)
+		}
+
+		entry := rosterEntry{name: name, layer: layer, lineage: e.Lineage}
+
+		for _, v := range e.Roles {
+			role := agent.Capability(v)
+
+			switch {
+			case role == roleSpeaker && layer == chat.SystemLayer:
+				return nil, errors.Errorf(
+					"%s.roles: %s requires a layer other than %s",
+					key,
+					role,
+					chat.SystemLayer,
+				)
+			case role == roleSpeaker:
+			case !role.Valid():
+				return nil, errors.Errorf("%s.roles: %q is unknown", key, role)
+			case layer != chat.SystemLayer:
+				return nil, errors.Errorf(
+					"%s.roles: %s requires the %s layer",
+					key,
+					role,
+					chat.SystemLayer,
+				)
+			}
+
+			entry.roles = append(entry.roles, role)
+		}
+
+		for _, p := range e.Peers {
+			entry.peers = append(entry.peers, chat.Name(p))
+		}
+
+		r[name] = entry
+	}
+
+	// Agents talk to each other or to the server.
+
+	for i, e := range entries {
+		for _, p := range e.Peers {
+			if _, ok := r[chat.Name(p)]; !ok && p != server {
+				return nil, errors.Errorf(
+					"roster[%d].peers: %s is neither on the roster nor the server",
+					i,
+					p,
+				)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// admission admits only the agents on the roster, on the layer, lineage and
+// with the capabilities the roster expects. Agents whose peers differ from
+// the roster are admitted, and warned about with `l`.
+func (r roster) admission(l *log.Logger) func(chat.Registration) error {
+	return func(reg chat.Registration) error {
+		if len(r) == 0 {
+			return nil
+		}
+
+		e, ok := r[reg.Name]
+		if !ok {
+			return errors.New("not on the roster")
+		}
+
+		if reg.Layer != e.layer {
+			return errors.Errorf("expected on %s, not %s", e.layer, reg.Layer)
+		}
+
+		if cmp.Or(reg.Lineage, DefaultLineage) != cmp.Or(e.lineage, DefaultLineage) {
+			return errors.Errorf(
+				"expected in lineage %q, not %q",
+				e.lineage,
+				reg.Lineage,
+			)
+		}
+
+		for _, role := range e.roles {
+			if role != roleSpeaker && !reg.HasCapability(role) {
+				return errors.Errorf("expected to be capable of %s", role)
+			}
+		}
+
+		if len(e.peers) > 0 && !slices.Equal(reg.Peers, e.peers) {
+			l.Warn(
+				"Agent peers differ from the roster",
+				"agent",
+				reg.Name,
+				"peers",
+				reg.Peers,
+				"roster",
+				e.peers,
+			)
+		}
+
+		return nil
+	}
+}
+
+// expected returns the names of the agents expected in `lineage`, in name
+// order.
+func (r roster) expected(lineage string) []chat.Name {
+	names := make([]chat.Name, 0, len(r))
+
+	for _, e := range r {
+		if cmp.Or(e.lineage, DefaultLineage) == lineage {
+			names = append(names, e.name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// withRole returns the clients of `clients` that have `role` on the roster.
+// Every client has every role when the roster is empty.
+func (r roster) withRole(
+	role agent.Capability,
+	clients []*network.ChatClient,
+) []*network.ChatClient {
+	if len(r) == 0 {
+		return clients
+	}
+
+	return slices.DeleteFunc(clients, func(c *network.ChatClient) bool {
+		return !slices.Contains(r[c.Name].roles, role)
+	})
+}
@@ -57,8 +57,50 @@ type ConlangServer struct {
 	dictionary      memory.DictionaryGeneration
 	generations     utils.Queue[memory.Generation]
 	ws              *network.WebServer
+	admin           *network.WebServer
+	run             *runControl
+	replies         *replies
+	pinned          pinnedWords
+	watchNotes      watchNotes
 	errs            chan error
 
+	// moderation holds moderator messages until they are injected into the
+	// conversation they were sent to.
+	moderation chan memory.Message
+
+	// candidates are the candidates of the generation being evolved that
+	// are waiting to be selected.
+	candidates []memory.Generation
+
+	// flushed is the number of generations flushed from `generations` to
+	// the run's history file, so the first generation in `generations` is
+	// generation `flushed`.
+	flushed int
+
+	// exported is when the run was last exported.
+	exported time.Time
+
+	// record is what the run recorded for its manifest.
+	record *runRecord
+
+	// runID identifies the run in the names of the files it writes.
+	runID string
+
+	// journal is where the events of the run are appended as they happen.
+	// It is nil when journaling is disabled.
+	journal *journal
+
+	// replay plays a recorded run rather than evolving a language. It is
+	// nil unless the server replays.
+	replay *replay
+
+	// lineage is the ID of the lineage the server evolves. A lineage other
+	// than the main one was forked from generation `forkedAt` of `parent`.
+	lineage  string
+	parent   string
+	forkedAt int
+	lineages *lineages
+
 	// cmd builds commands that can be sent to an agent.
 	cmd network.CommandForAgent
 }
@@ -69,12 +111,17 @@ func NewConlangServer(
 	m MemoryService,
 	errs chan error,
 ) (*ConlangServer, error) {
+	// A run that evolves forever cannot keep every generation in memory.
+
 	if cfg.procedures.maxGenerations == 0 {
+		if cfg.procedures.retainGenerations == 0 {
+			cfg.procedures.retainGenerations = DefaultRollingWindow
+		}
+
 		l.Infof(
-			"Max generations not specified, setting to default %d",
-			DefaultMaxGenerations,
+			"Evolving forever, keeping the last %d generations in memory",
+			cfg.procedures.retainGenerations,
 		)
-		cfg.procedures.maxGenerations = DefaultMaxGenerations
 	}
 
 	transcriptGen1 := newTranscriptGeneration()
@@ -82,8 +129,8 @@ func NewConlangServer(
 	// Load and serialize specifications.
 
 	specificationsGen1, err := loadSpecificationsFromFile(
-		cfg.files.
-			specifications,
+		cfg.files.specifications,
+		cfg.layers,
 	)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed loading specifications from file")
@@ -119,34 +166,120 @@ func NewConlangServer(
 		Dictionary:     dictionaryGen1,
 	}
 
-	generations, err := utils.NewStaticFixedQueue[memory.Generation](
-		cfg.procedures.maxGenerations + 1,
+	var (
+		gens       = []memory.Generation{initialGen}
+		dictionary = dictionaryGen1
+		evolved    = 0
+		flushed    = 0
+		runID      = time.Now().Format("20060102150405")
 	)
+
+	// The journal is opened first, so that the messages a resumed run
+	// restores are journaled too.
+
+	jl, err := openJournal(cfg, runID, l)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create generation queue")
+		return nil, err
+	}
+
+	if jl != nil {
+		m = journaledMemory{MemoryService: m, journal: jl}
 	}
 
-	err = generations.Enqueue(initialGen)
+	// Resuming replaces the initial generation with the generations of the
+	// checkpoint.
+
+	if cfg.resume != "" {
+		cp, err := loadCheckpoint(cfg.resume)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to resume")
+		}
+
+		if cp.MaxGenerations != 0 &&
+			cp.MaxGenerations != cfg.procedures.maxGenerations {
+			l.Warnf(
+				"Checkpoint was made with %d max generations, resuming with %d",
+				cp.MaxGenerations,
+				cfg.procedures.maxGenerations,
+			)
+		}
+
+		err = restoreMessages(context.Background(), m, cp.Messages)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to resume")
+		}
+
+		gens = cp.Generations
+		dictionary = cp.Dictionary
+		evolved = cp.Generation
+		flushed = cp.Flushed
+
+		l.Info(
+			"Resuming from checkpoint",
+			"path",
+			cfg.resume,
+			"generation",
+			evolved,
+			"job",
+			cp.Job,
+			"messages",
+			len(cp.Messages),
+		)
+	}
+
+	// Generations of the checkpoint that do not fit in memory are already
+	// in the checkpoint, so they are not flushed again.
+
+	generations, dropped, err := newGenerationWindow(cfg.procedures, gens)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to enqueue initial generation")
 	}
 
-	webServer, err := network.NewWebServer(l, errs, network.WithPort("7070"))
+	gens = gens[dropped:]
+	flushed += dropped
+
+	webServer, err := network.NewWebServer(
+		l,
+		errs,
+		network.WithPort(cfg.network.webPort),
+	)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create web server")
 	}
 
-	grpcServer, err := network.NewChatServer(l, errs)
+	adminServer, err := network.NewWebServer(
+		l,
+		errs,
+		network.WithPort(cfg.admin.port),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create admin server")
+	}
+
+	grpcOpts, err := grpcServerOptions(cfg.security)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to configure grpc security")
+	}
+
+	grpcOpts = append(
+		grpcOpts,
+		network.WithAddress(cfg.network.grpcAddress),
+		network.WithAdmission(cfg.roster.admission(l)),
+	)
+
+	grpcServer, err := network.NewChatServer(l, errs, grpcOpts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create grpc server")
 	}
 
-	err = webServer.InitialData.RecentSpecifications.Enqueue(specificationsGen1)
+	err = webServer.InitialData.RecentSpecifications.Enqueue(
+		gens[len(gens)-1].Specifications,
+	)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to enqueue specifications")
 	}
 
-	err = webServer.InitialData.RecentGenerations.Enqueue(initialGen)
+	err = webServer.InitialData.RecentGenerations.Enqueue(gens...)
 	if err != nil {
 		return nil, errors.Wrap(
 			err,
@@ -159,17 +292,49 @@ func NewConlangServer(
 		memory:        m,
 		gs:            grpcServer,
 		ws:            webServer,
+		admin:         adminServer,
+		runID:         runID,
 		generations:   generations,
+		flushed:       flushed,
 		procedureChan: make(chan memory.Message, 100),
+		moderation:    make(chan memory.Message, 10),
 		// Make channel buffered with 1 spot, since it will only be used by that
 		// many concurrent processes at a time.
 		dictUpdatesChan: make(chan memory.ResponseDictionaryEntries, 1),
 		jobsChan:        make(chan utils.Queue[[]job], 100),
-		dictionary:      dictionaryGen1,
+		dictionary:      dictionary,
+		replies:         newReplies(),
 		config:          cfg,
 		logger:          l,
 		cmd:             network.BuildCommand(cfg.name),
 		errs:            errs,
+		lineage:         DefaultLineage,
+		lineages:        newLineages(),
+		record:          newRunRecord(),
+		journal:         jl,
+	}
+
+	cs.journalGenerations(gens, flushed)
+
+	if cfg.replay.path != "" {
+		rec, err := cs.loadRecording()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load replay")
+		}
+
+		cs.replay = newReplay(rec, cfg.replay)
+	}
+
+	err = cs.lineages.add(cs)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.run = newRunControl(evolved, cs.broadcastRunState)
+
+	err = webServer.InitialData.RecentRunState.Enqueue(cs.run.State())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to enqueue run state")
 	}
 
 	return cs, nil
@@ -179,8 +344,16 @@ func (s *ConlangServer) Router(ctx context.Context) {
 	var (
 		msg memory.Message
 
+		// lineage is the lineage the message takes part in. Messages of
+		// agents whose lineage has not been forked go nowhere.
+		lineage *ConlangServer
+
 		eventsRoute = func(ctx context.Context, pbMsg *chat.Message) error {
-			err := s.ws.InitialData.RecentMessages.Enqueue(msg)
+			if lineage == nil {
+				return nil
+			}
+
+			err := lineage.ws.InitialData.RecentMessages.Enqueue(msg)
 			if err != nil {
 				s.logger.Errorf("failed to save message to InitialData: %v", err)
 			}
@@ -206,17 +379,31 @@ func (s *ConlangServer) Router(ctx context.Context) {
 				return nil
 			}
 
+			// Conversations on a layer are forwarded by the procedure
+			// iterating on the layer, so that operators can pause them
+			// between exchanges.
+
+			isAgentMsg := msg.Sender != s.name && msg.Command == agent.NoCommand
+			if isAgentMsg && msg.Layer != chat.SystemLayer {
+				return nil
+			}
+
 			return s.gs.Broadcast(&msg)
 		}
 
 		procedureRoute = func(ctx context.Context, pbMsg *chat.Message) error {
 			isAgentMsg := msg.Sender != s.name && msg.Command == agent.NoCommand
 
+			if isAgentMsg && lineage == nil {
+				s.logger.Warn("Dropping message of an agent without a lineage", "sender", msg.Sender)
+				return nil
+			}
+
 			// Match any message solely from an agent.
 			if isAgentMsg && msg.Layer != chat.SystemLayer {
 				return utils.SendWithContext(
 					ctx,
-					s.procedureChan,
+					lineage.procedureChan,
 					msg,
 					func() {
 						s.logger.Debug(
@@ -233,7 +420,7 @@ func() {
 			} else if isAgentMsg && msg.Layer == chat.SystemLayer {
 				return utils.SendWithContext(
 					ctx,
-					s.gs.Channel.ToServer,
+					s.replies.from(msg.Sender),
 					msg,
 					func() {
 						s.logger.Debug("msg sent to system channel")
@@ -257,6 +444,17 @@ func(ctx context.Context, pbMsg *chat.Message) error {
 				pbMsg.Sender, pbMsg.Receiver,
 				pbMsg.Content, pbMsg.Layer, pbMsg.Command,
 			)
+
+			agentName := msg.Sender
+			if agentName == s.name {
+				agentName = msg.Receiver
+			}
+
+			lineage = s.lineages.of(s.gs, agentName)
+			if lineage == nil && agentName == "" {
+				lineage = s
+			}
+
 			return nil
 		},
 		printConsoleData,
@@ -280,36 +478,38 @@ func (s *ConlangServer) WebEvents(ctx context.Context) {
 			mux.HandleFunc("/time", s.ws.Broadcasters.CurrentTime.HandleClient)
 		}
 
-		chatting = func(mux *http.ServeMux) {
-			mux.HandleFunc(
-				"/chat", s.ws.Broadcasters.Messages.InitialData(
-					s.ws.InitialData.RecentMessages,
-				),
-			)
-			mux.HandleFunc(
-				"/wordDetection",
-				s.ws.Broadcasters.MessageWordDictExtraction.InitialData(
-					s.ws.InitialData.RecentUsedWords,
-				),
-			)
+		// events are the main lineage's feeds at the root, and every
+		// lineage's feeds under `/lineages/{id}/`.
+		events = func(mux *http.ServeMux) {
+			for path, feed := range s.feeds() {
+				mux.HandleFunc(path, feed)
+			}
+
+			mux.HandleFunc("/lineages/{id}/{feed...}", s.handleLineageFeed)
 		}
 
-		generations = func(mux *http.ServeMux) {
-			mux.HandleFunc(
-				"/specifications",
-				s.ws.Broadcasters.Specification.InitialData(s.ws.InitialData.RecentSpecifications),
-			)
-			mux.HandleFunc(
-				"/generations",
-				s.ws.Broadcasters.Generation.InitialData(s.ws.InitialData.RecentGenerations),
+		// history compares the generations kept in memory of the main
+		// lineage, or of the lineage named by the `lineage` query parameter.
+		history = func(mux *http.ServeMux) {
+			mux.Handle(
+				"GET /generations/diff",
+				s.lineageHandler((*ConlangServer).handleGenerationDiff),
 			)
 		}
 
-		logograms = func(mux *http.ServeMux) {
-			mux.HandleFunc(
-				"/logograms/display",
-				s.ws.Broadcasters.LogogramDisplay.InitialData(s.ws.InitialData.RecentLogogram),
+		// moderation lets people steer the conversation on a layer of the
+		// main lineage, or of the lineage named by the `lineage` query
+		// parameter.
+		moderation = func(mux *http.ServeMux) {
+			mux.Handle(
+				"POST /chat/moderator",
+				network.RateLimit(
+					s.config.moderation.rate,
+					time.Minute,
+					s.lineageHandler((*ConlangServer).handleModerator),
+				),
 			)
+			mux.HandleFunc("OPTIONS /chat/moderator", network.AllowCrossOrigin)
 		}
 
 		testing = func(mux *http.ServeMux) {
@@ -326,17 +526,48 @@ func (s *ConlangServer) WebEvents(ctx context.Context) {
 		}
 	)
 
+	routes := []func(*http.ServeMux){timeNow, events, history, testing}
+
+	// Nobody takes part in a replay, so there is nobody to moderate.
+
+	if s.replay == nil {
+		routes = append(routes, moderation)
+	}
+
 	webCtx, webCancel := context.WithCancel(ctx)
 	defer webCancel()
 
-	s.ws.ListenAndServe(
-		webCtx,
-		timeNow,
-		chatting,
-		generations,
-		logograms,
-		testing,
-	)
+	s.ws.ListenAndServe(webCtx, routes...)
+}
+
+// feeds are the web events of the server's lineage, by path.
+func (s *ConlangServer) feeds() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/chat": s.ws.Broadcasters.Messages.InitialData(
+			s.ws.InitialData.RecentMessages,
+		),
+		"/wordDetection": s.ws.Broadcasters.MessageWordDictExtraction.InitialData(
+			s.ws.InitialData.RecentUsedWords,
+		),
+		"/specifications": s.ws.Broadcasters.Specification.InitialData(
+			s.ws.InitialData.RecentSpecifications,
+		),
+		"/specifications/changes": s.ws.Broadcasters.SpecificationChange.InitialData(
+			s.ws.InitialData.RecentChanges,
+		),
+		"/generations": s.ws.Broadcasters.Generation.InitialData(
+			s.ws.InitialData.RecentGenerations,
+		),
+		"/logograms/display": s.ws.Broadcasters.LogogramDisplay.InitialData(
+			s.ws.InitialData.RecentLogogram,
+		),
+		"/state": s.ws.Broadcasters.RunState.InitialData(
+			s.ws.InitialData.RecentRunState,
+		),
+		"/watchdog": s.ws.Broadcasters.Watchdog.InitialData(
+			s.ws.InitialData.RecentWatchdog,
+		),
+	}
 }
 
 func (s *ConlangServer) ProcessJobs(ctx context.Context) {
@@ -347,18 +578,61 @@ func (s *ConlangServer) ProcessJobs(ctx context.Context) {
 				s.logger.Warn("Processing context cancelled")
 				return
 			default:
-				for _, j := range p {
-					select {
-					case <-ctx.Done():
-						s.logger.Warn("Processing context cancelled")
-						return
-					default:
-						err = j.do(ctx)
-						if err != nil {
-							s.errs <- err
+				// An aborted generation skips the rest of its batch, and
+				// the batch runs again to evolve the generation anew, so
+				// that the run still evolves as many generations as it
+				// was asked to.
+
+				for again := true; again; {
+					again = false
+
+				batch:
+					for _, j := range p {
+						select {
+						case <-ctx.Done():
+							s.logger.Warn("Processing context cancelled")
 							return
+						default:
+							// Operators may pause the queue before any job.
+
+							err = s.run.awaitJob(ctx, j.Stage())
+							if err == nil {
+								s.run.startJob(j.Name(), j.Stage())
+								err = j.do(ctx)
+								s.run.endJob()
+
+								s.record.job(j, j.Elapsed())
+								s.record.seen(s.clients())
+							}
+
+							n := s.run.currentGeneration()
+
+							if errors.Is(err, errGenerationAborted) {
+								s.record.error(n, j.Name(), err)
+								s.discardGeneration()
+								again = true
+								break batch
+							}
+
+							// Jobs cut short by the server shutting down did
+							// not fail the run.
+
+							if err != nil {
+								if ctx.Err() == nil {
+									s.record.fail(n, j.Name(), err)
+								}
+
+								s.errs <- err
+								return
+							}
+							s.logger.Infof("job complete: %s", j)
+
+							err = s.saveCheckpoint(j.Name())
+							if err != nil {
+								s.record.error(n, j.Name(), err)
+								s.logger.Warnf("failed to save checkpoint: %v", err)
+							}
 						}
-						s.logger.Infof("job complete: %s", j)
 					}
 				}
 			}
@@ -367,11 +641,7 @@ func (s *ConlangServer) ProcessJobs(ctx context.Context) {
 }
 
 func (s *ConlangServer) Run(ctx context.Context, wg *sync.WaitGroup) {
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		s.gs.ListenAndServe(ctx)
-	}()
+	s.lineages.ctx = ctx
 
 	wg.Add(1)
 	go func() {
@@ -382,113 +652,36 @@ func (s *ConlangServer) Run(ctx context.Context, wg *sync.WaitGroup) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		s.Router(ctx)
+		s.AdminEvents(ctx)
 	}()
 
-	// wg.Add(1)
-	go func() {
-		// defer wg.Done()
-		t := utils.Timer(time.Now())
-
-		var (
-			err error
-
-			// ng is the new generation that will be used throughout batches
-			// of jobs to evolve the language.
-			ng = &memory.Generation{}
-
-			// i keeps track of the current generation.
-			i = 0
-
-			waitForClientsProc = &procedure{
-				name: "wait-for-clients",
-				exec: s.WaitForClients(11),
-			}
-
-			iterateSpecsProc = &procedure{
-				name: "iterate-specifications",
-				exec: s.iterateSpecs(i, ng),
-			}
-
-			iterateDictionaryProc = &procedure{
-				name: "iterate-dictionary",
-				exec: s.iterateDictionary(i, ng),
-			}
-
-			iterateLogogramsProc = &procedure{
-				name: "iterate-logograms",
-				exec: s.iterateLogograms(i, ng),
-			}
-
-			updateGenerationsProc = &procedure{
-				name: "update-generations",
-				exec: s.updateGenerations(i, ng),
-			}
-
-			waitProcedureProc = &procedure{
-				name: "wait-procedure",
-				exec: s.wait(10 * time.Second),
-			}
-
-			exportDataProc = &procedure{
-				name: "export-data",
-				exec: s.exportData(t),
-			}
-
-			initializeProcs = jobs{
-				waitForClientsProc,
-			}
-
-			evolveProcs = jobs{
-				iterateSpecsProc,
-				iterateDictionaryProc,
-				iterateLogogramsProc,
-				updateGenerationsProc,
-				waitProcedureProc,
-			}
-
-			exportProcs = jobs{
-				exportDataProc,
-			}
-		)
-
-		q, _ := utils.NewStaticFixedQueue[jobs](1)
+	// A replay only needs the web events, since no agent takes part in it.
 
-		_ = q.Enqueue(initializeProcs)
-
-		err = utils.SendWithContext(ctx, s.jobsChan, q)
-		if err != nil {
-			s.errs <- err
-			return
-		}
-
-		// Add the configured number of generation iterations to the queue.
-
-		gq, _ := utils.NewStaticFixedQueue[jobs](s.config.procedures.maxGenerations)
-
-		for range s.config.procedures.maxGenerations {
-			_ = gq.Enqueue(evolveProcs)
-
-			err = utils.SendWithContext(ctx, s.jobsChan, gq)
-			if err != nil {
-				s.errs <- err
-				return
-			}
-		}
-
-		eq, _ := utils.NewStaticFixedQueue[jobs](1)
+	if s.replay != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.replayRecording(ctx)
+		}()
 
-		_ = eq.Enqueue(exportProcs)
+		return
+	}
 
-		err = utils.SendWithContext(ctx, s.jobsChan, eq)
-		if err != nil {
-			s.errs <- err
-			return
-		}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.gs.ListenAndServe(ctx)
+	}()
 
-		s.ProcessJobs(ctx)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.Router(ctx)
 	}()
 
+	// wg.Add(1)
+	go s.evolve(ctx)
+
 	if s.config.debugEnabled && s.config.broadcastTestData {
 		wg.Add(1)
 		go func() {
@@ -531,8 +724,80 @@ func (s *ConlangServer) Run(ctx context.Context, wg *sync.WaitGroup) {
 	}
 }
 
+// evolve queues the jobs of the server's pipeline, and processes them.
+func (s *ConlangServer) evolve(ctx context.Context) {
+	t := utils.Timer(time.Now())
+
+	var (
+		err error
+
+		// ng is the new generation that will be used throughout batches
+		// of jobs to evolve the language.
+		ng = &memory.Generation{}
+
+		initializeProcs = s.buildJobs(stageInitialize, s.config.pipeline.initialize, ng, t)
+		evolveProcs     = s.evolveJobs(t)
+		exportProcs     = s.buildJobs(stageFinalize, s.config.pipeline.finalize, ng, t)
+	)
+
+	q, _ := utils.NewStaticFixedQueue[jobs](1)
+
+	_ = q.Enqueue(initializeProcs)
+
+	err = utils.SendWithContext(ctx, s.jobsChan, q)
+	if err != nil {
+		s.errs <- err
+		return
+	}
+
+	// Generations are queued while earlier ones are processed, so that a
+	// run that evolves forever does not queue without end. A resumed run
+	// only evolves the generations it has left.
+
+	maxGenerations := s.config.procedures.maxGenerations
+
+	if maxGenerations > 0 && s.run.currentGeneration() >= maxGenerations {
+		s.logger.Warn("Every generation has already been evolved")
+	}
+
+	s.exported = time.Now()
+
+	go func() {
+		for n := s.run.currentGeneration(); maxGenerations == 0 || n < maxGenerations; n++ {
+			gq, _ := utils.NewStaticFixedQueue[jobs](1)
+
+			_ = gq.Enqueue(evolveProcs)
+
+			// The context is only done when the server shuts down.
+
+			err := utils.SendWithContext(ctx, s.jobsChan, gq)
+			if err != nil {
+				return
+			}
+		}
+
+		eq, _ := utils.NewStaticFixedQueue[jobs](1)
+
+		_ = eq.Enqueue(exportProcs)
+
+		err := utils.SendWithContext(ctx, s.jobsChan, eq)
+		if err != nil {
+			return
+		}
+	}()
+
+	s.ProcessJobs(ctx)
+}
+
 func (s *ConlangServer) Teardown() {
-	close(s.procedureChan)
-	close(s.dictUpdatesChan)
-	close(s.jobsChan)
+	for _, l := range s.lineages.all() {
+		close(l.procedureChan)
+		close(l.dictUpdatesChan)
+		close(l.jobsChan)
+	}
+
+	err := s.journal.close()
+	if err != nil {
+		s.logger.Errorf("failed to close journal: %v", err)
+	}
 }
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// envPrefix starts the name of every environment variable that overrides a
+// key of the server's configuration.
+const envPrefix = "JASIMA_"
+
+// settings is the layout of a server configuration file. A key is resolved
+// from, in increasing precedence, its default, the configuration file, its
+// environment variable and its flag. The environment variable of a key is
+// its path in upper snake case after `JASIMA_`, so `procedures.replyTimeout`
+// is `JASIMA_PROCEDURES_REPLY_TIMEOUT`.
+type settings struct {
+	Name              string `toml:"name"`
+	Debug             bool   `toml:"debug"`
+	LogToFile         bool   `toml:"logToFile"`
+	BroadcastTestData bool   `toml:"broadcastTestData"`
+
+	// Pipeline and Layers are paths to the pipeline and layers files. The
+	// defaults are used when empty.
+	Pipeline string `toml:"pipeline"`
+	Layers   string `toml:"layers"`
+
+	// Resume is the path to a checkpoint or generations file to resume from.
+	Resume string `toml:"resume"`
+
+	Network    networkSettings    `toml:"network"`
+	Files      fileSettings       `toml:"files"`
+	Procedures procedureSettings  `toml:"procedures"`
+	Security   securitySettings   `toml:"security"`
+	Admin      adminSettings      `toml:"admin"`
+	Moderation moderationSettings `toml:"moderation"`
+	Journal    journalSettings    `toml:"journal"`
+	Replay     replaySettings     `toml:"replay"`
+
+	// Roster declares the agents the server expects. Any agent is admitted
+	// when it is empty.
+	Roster []rosterSettings `toml:"roster"`
+}
+
+type networkSettings struct {
+	// GrpcAddress is the address agents connect to.
+	GrpcAddress string `toml:"grpcAddress"`
+
+	// WebPort is the port of the web events.
+	WebPort string `toml:"webPort"`
+}
+
+type fileSettings struct {
+	Specifications string `toml:"specifications"`
+	Logography     string `toml:"logography"`
+	Dictionary     string `toml:"dictionary"`
+
+	// Outputs is the directory chats, generations and logs are saved to.
+	Outputs string `toml:"outputs"`
+
+	// Checkpoints is the directory checkpoints are saved to. Checkpoints
+	// are disabled when empty.
+	Checkpoints string `toml:"checkpoints"`
+}
+
+type procedureSettings struct {
+	Exchanges               int           `toml:"exchanges"`
+	Generations             int           `toml:"generations"`
+	DictionaryExtractMethod int           `toml:"dictionaryExtractMethod"`
+	ExportData              bool          `toml:"exportData"`
+	ReplyTimeout            time.Duration `toml:"replyTimeout"`
+	ReplyRetries            int           `toml:"replyRetries"`
+	RetainGenerations       int           `toml:"retainGenerations"`
+	ExportEvery             int           `toml:"exportEvery"`
+	ExportInterval          time.Duration `toml:"exportInterval"`
+
+	// WaitForClients is how many clients `wait-for-clients` waits for when
+	// its step does not say.
+	WaitForClients int `toml:"waitForClients"`
+
+	// WaitDuration is how long `wait-procedure` waits, and how long
+	// `iterate-logograms` waits between exchanges, when their step does not
+	// say.
+	WaitDuration time.Duration `toml:"waitDuration"`
+}
+
+type securitySettings struct {
+	TlsCert     string `toml:"tlsCert"`
+	TlsKey      string `toml:"tlsKey"`
+	TlsClientCA string `toml:"tlsClientCA"`
+	AuthTokens  string `toml:"authTokens"`
+}
+
+type adminSettings struct {
+	Port  string `toml:"port"`
+	Token string `toml:"token"`
+}
+
+type moderationSettings struct {
+	MaxLength int `toml:"maxLength"`
+	Rate      int `toml:"rate"`
+}
+
+type journalSettings struct {
+	Enabled bool `toml:"enabled"`
+
+	// Sync is when journal events are written to disk: "never", "interval"
+	// or "always".
+	Sync         string        `toml:"sync"`
+	SyncInterval time.Duration `toml:"syncInterval"`
+}
+
+type replaySettings struct {
+	// Path is an outputs directory whose recorded run is replayed instead of
+	// evolving a language. Replaying is disabled when empty.
+	Path string `toml:"path"`
+
+	// Run is the run of the directory to replay, its latest when empty.
+	Run   string  `toml:"run"`
+	Speed float64 `toml:"speed"`
+	Loop  bool    `toml:"loop"`
+}
+
+// flagKeys maps the name of a flag to the key it sets.
+var flagKeys = map[string]string{
+	"name":                    "name",
+	"debug":                   "debug",
+	"logToFile":               "logToFile",
+	"broadcastTestData":       "broadcastTestData",
+	"pipeline":                "pipeline",
+	"layers":                  "layers",
+	"resume":                  "resume",
+	"specPath":                "files.specifications",
+	"svgPath":                 "files.logography",
+	"dictPath":                "files.dictionary",
+	"checkpointDir":           "files.checkpoints",
+	"exchanges":               "procedures.exchanges",
+	"generations":             "procedures.generations",
+	"dictionaryExtractMethod": "procedures.dictionaryExtractMethod",
+	"exportData":              "procedures.exportData",
+	"replyTimeout":            "procedures.replyTimeout",
+	"replyRetries":            "procedures.replyRetries",
+	"retainGenerations":       "procedures.retainGenerations",
+	"exportEvery":             "procedures.exportEvery",
+	"exportInterval":          "procedures.exportInterval",
+	"tlsCert":                 "security.tlsCert",
+	"tlsKey":                  "security.tlsKey",
+	"tlsClientCA":             "security.tlsClientCA",
+	"authTokens":              "security.authTokens",
+	"adminPort":               "admin.port",
+	"adminToken":              "admin.token",
+	"moderatorMaxLength":      "moderation.maxLength",
+	"moderatorRate":           "moderation.rate",
+	"journal":                 "journal.enabled",
+	"journalSync":             "journal.sync",
+	"journalSyncInterval":     "journal.syncInterval",
+	"replay":                  "replay.path",
+	"replayRun":               "replay.run",
+	"replaySpeed":             "replay.speed",
+	"replayLoop":              "replay.loop",
+}
+
+// defaultSettings are the settings of a server that is given no
+// configuration.
+func defaultSettings() settings {
+	return settings{
+		Name:              DefaultServerName,
+		Debug:             DefaultDebugToggle,
+		LogToFile:         DefaultLogToFileToggle,
+		BroadcastTestData: DefaultBroadcastTestData,
+		Pipeline:          DefaultPipelinePath,
+		Layers:            DefaultLayersPath,
+		Resume:            DefaultResumePath,
+		Network: networkSettings{
+			GrpcAddress: DefaultGrpcAddress,
+			WebPort:     DefaultWebPort,
+		},
+		Files: fileSettings{
+			Specifications: DefaultSpecResourcePath,
+			Logography:     DefaultSvgResourcePath,
+			Dictionary:     DefaultDictionaryJsonPath,
+			Outputs:        DefaultOutputPath,
+			Checkpoints:    DefaultCheckpointPath,
+		},
+		Procedures: procedureSettings{
+			Exchanges:               DefaultMaxExchanges,
+			Generations:             DefaultMaxGenerations,
+			DictionaryExtractMethod: DefaultDictionaryExtractionMethod,
+			ExportData:              DefaultExportData,
+			ReplyTimeout:            DefaultReplyTimeout,
+			ReplyRetries:            DefaultReplyRetries,
+			RetainGenerations:       DefaultRetainGenerations,
+			ExportEvery:             DefaultExportEvery,
+			ExportInterval:          DefaultExportInterval,
+			WaitForClients:          DefaultWaitForClients,
+			WaitDuration:            DefaultWaitDuration,
+		},
+		Security: securitySettings{
+			TlsCert:     DefaultTLSCert,
+			TlsKey:      DefaultTLSKey,
+			TlsClientCA: DefaultTLSClientCA,
+			AuthTokens:  DefaultAuthTokensPath,
+		},
+		Admin: adminSettings{
+			Port:  DefaultAdminPort,
+			Token: DefaultAdminToken,
+		},
+		Moderation: moderationSettings{
+			MaxLength: DefaultModeratorMaxLength,
+			Rate:      DefaultModeratorRate,
+		},
+		Journal: journalSettings{
+			Enabled:      DefaultJournal,
+			Sync:         DefaultJournalSync,
+			SyncInterval: DefaultJournalSyncInterval,
+		},
+		Replay: replaySettings{
+			Path:  DefaultReplayPath,
+			Run:   DefaultReplayRun,
+			Speed: DefaultReplaySpeed,
+			Loop:  DefaultReplayLoop,
+		},
+	}
+}
+
+// loadSettings resolves the server's settings from the configuration file at
+// `p`, the environment and the flags that were set. An empty path reads the
+// file at `JASIMA_CONFIG`, and skips the file when that is empty too.
+func loadSettings(p string) (settings, error) {
+	st := defaultSettings()
+
+	if p == "" {
+		p = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	if p != "" {
+		md, err := toml.DecodeFile(p, &st)
+		if err != nil {
+			return st, errors.Wrapf(err, "failed to load config file %s", p)
+		}
+
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return st, errors.Errorf(
+				"config file %s has unknown keys: %v",
+				p,
+				undecoded,
+			)
+		}
+	}
+
+	keys := st.keys()
+
+	for key, v := range keys {
+		name := envName(key)
+
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		err := setValue(v, s)
+		if err != nil {
+			return st, errors.Wrapf(err, "%s (from %s)", key, name)
+		}
+	}
+
+	var err error
+
+	flag.Visit(func(f *flag.Flag) {
+		key, ok := flagKeys[f.Name]
+		if !ok || err != nil {
+			return
+		}
+
+		err = setValue(keys[key], f.Value.String())
+		if err != nil {
+			err = errors.Wrapf(err, "%s (from -%s)", key, f.Name)
+		}
+	})
+	if err != nil {
+		return st, err
+	}
+
+	return st, st.validate()
+}
+
+// keys returns every key of the settings, by its path.
+func (st *settings) keys() map[string]reflect.Value {
+	keys := make(map[string]reflect.Value)
+
+	var walk func(prefix string, v reflect.Value)
+
+	walk = func(prefix string, v reflect.Value) {
+		for i := range v.NumField() {
+			key := prefix + v.Type().Field(i).Tag.Get("toml")
+
+			switch v.Field(i).Kind() {
+			case reflect.Struct:
+				walk(key+".", v.Field(i))
+				continue
+			case reflect.Slice:
+				// Tables such as the roster are only read from the
+				// configuration file.
+				continue
+			}
+
+			keys[key] = v.Field(i)
+		}
+	}
+
+	walk("", reflect.ValueOf(st).Elem())
+
+	return keys
+}
+
+// envName is the name of the environment variable that overrides `key`.
+func envName(key string) string {
+	var sb strings.Builder
+
+	sb.WriteString(envPrefix)
+
+	var prev rune
+
+	for _, r := range key {
+		switch {
+		case r == '.':
+			sb.WriteRune('_')
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			sb.WriteRune('_')
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(unicode.ToUpper(r))
+		}
+
+		prev = r
+	}
+
+	return sb.String()
+}
+
+// setValue parses `s` into `v`, a field of the settings.
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(f)
+	default:
+		return errors.Errorf("cannot set a value of kind %s", v.Kind())
+	}
+
+	return nil
+}
+
+// validate checks the settings, naming the key at fault.
+func (st settings) validate() error {
+	p := st.Procedures
+
+	checks := []struct {
+		key string
+		bad bool
+		msg string
+	}{
+		{"name", st.Name == "", "must not be empty"},
+		{"network.grpcAddress", st.Network.GrpcAddress == "", "must not be empty"},
+		{"network.webPort", st.Network.WebPort == "", "must not be empty"},
+		{"admin.port", st.Admin.Port == "", "must not be empty"},
+		{"files.outputs", st.Files.Outputs == "", "must not be empty"},
+		{"procedures.exchanges", p.Exchanges <= 0, "must be positive"},
+		{"procedures.generations", p.Generations < 0, "must not be negative"},
+		{
+			"procedures.dictionaryExtractMethod",
+			p.DictionaryExtractMethod != int(extractWithRegex) &&
+				p.DictionaryExtractMethod != int(extractWithAgent),
+			"must be 0 or 1",
+		},
+		{"procedures.replyTimeout", p.ReplyTimeout <= 0, "must be positive"},
+		{"procedures.replyRetries", p.ReplyRetries < 0, "must not be negative"},
+		{"procedures.retainGenerations", p.RetainGenerations < 0, "must not be negative"},
+		{"procedures.exportEvery", p.ExportEvery < 0, "must not be negative"},
+		{"procedures.exportInterval", p.ExportInterval < 0, "must not be negative"},
+		{"procedures.waitForClients", p.WaitForClients <= 0, "must be positive"},
+		{"procedures.waitDuration", p.WaitDuration <= 0, "must be positive"},
+		{"moderation.maxLength", st.Moderation.MaxLength <= 0, "must be positive"},
+		{"moderation.rate", st.Moderation.Rate < 0, "must not be negative"},
+		{
+			"journal.sync",
+			st.Journal.Sync != syncNever &&
+				st.Journal.Sync != syncInterval &&
+				st.Journal.Sync != syncAlways,
+			"must be never, interval or always",
+		},
+		{"journal.syncInterval", st.Journal.SyncInterval <= 0, "must be positive"},
+		{"replay.speed", st.Replay.Speed <= 0, "must be positive"},
+	}
+
+	keys := st.keys()
+
+	for _, c := range checks {
+		if c.bad {
+			return fmt.Errorf("%s: %s, got %v", c.key, c.msg, keys[c.key])
+		}
+	}
+
+	return nil
+}
+
+// config builds the server's configuration from the settings, loading the
+// layers and pipeline they point to.
+func (st settings) config() (*config, error) {
+	// Layers are loaded first, since pipelines refer to layers by name.
+
+	ls, err := loadLayers(st.Layers)
+	if err != nil {
+		return nil, errors.Wrap(err, "layers")
+	}
+
+	pl, err := loadPipeline(st.Pipeline, ls)
+	if err != nil {
+		return nil, errors.Wrap(err, "pipeline")
+	}
+
+	r, err := newRoster(st.Roster, ls, st.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &config{
+		name:              st.Name,
+		debugEnabled:      st.Debug,
+		broadcastTestData: st.BroadcastTestData,
+		network: networkConfig{
+			grpcAddress: st.Network.GrpcAddress,
+			webPort:     st.Network.WebPort,
+		},
+		files: filePathConfig{
+			specifications: st.Files.Specifications,
+			logography:     st.Files.Logography,
+			dictionary:     st.Files.Dictionary,
+			outputs:        st.Files.Outputs,
+			checkpoints:    st.Files.Checkpoints,
+		},
+		procedures: procedureConfig{
+			maxExchanges:                   st.Procedures.Exchanges,
+			maxGenerations:                 st.Procedures.Generations,
+			dictionaryWordExtractionMethod: dictExtractMethod(st.Procedures.DictionaryExtractMethod),
+			exportData:                     st.Procedures.ExportData,
+			replyTimeout:                   st.Procedures.ReplyTimeout,
+			replyRetries:                   st.Procedures.ReplyRetries,
+			retainGenerations:              st.Procedures.RetainGenerations,
+			exportEvery:                    st.Procedures.ExportEvery,
+			exportInterval:                 st.Procedures.ExportInterval,
+			waitForClients:                 st.Procedures.WaitForClients,
+			waitDuration:                   st.Procedures.WaitDuration,
+		},
+		security: securityConfig{
+			tlsCert:     st.Security.TlsCert,
+			tlsKey:      st.Security.TlsKey,
+			tlsClientCA: st.Security.TlsClientCA,
+			authTokens:  st.Security.AuthTokens,
+		},
+		admin: adminConfig{
+			port:  st.Admin.Port,
+			token: st.Admin.Token,
+		},
+		moderation: moderationConfig{
+			maxLength: st.Moderation.MaxLength,
+			rate:      st.Moderation.Rate,
+		},
+		journal: journalConfig{
+			enabled:      st.Journal.Enabled,
+			sync:         st.Journal.Sync,
+			syncInterval: st.Journal.SyncInterval,
+		},
+		replay: replayConfig{
+			path:  st.Replay.Path,
+			run:   st.Replay.Run,
+			speed: st.Replay.Speed,
+			loop:  st.Replay.Loop,
+		},
+		pipeline: pl,
+		layers:   ls,
+		resume:   st.Resume,
+		roster:   r,
+		settings: st,
+	}, nil
+}
+
+// print writes the settings to `w` as a configuration file. The admin token
+// is left out, so that printed settings can be shared.
+func (st settings) print(w io.Writer) error {
+	if st.Admin.Token != "" {
+		st.Admin.Token = "REDACTED"
+	}
+
+	return toml.NewEncoder(w).Encode(st)
+}
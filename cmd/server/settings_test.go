@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"name", "JASIMA_NAME"},
+		{"admin.port", "JASIMA_ADMIN_PORT"},
+		{"network.grpcAddress", "JASIMA_NETWORK_GRPC_ADDRESS"},
+		{"procedures.replyTimeout", "JASIMA_PROCEDURES_REPLY_TIMEOUT"},
+		{"security.tlsClientCA", "JASIMA_SECURITY_TLS_CLIENT_CA"},
+		{"journal.syncInterval", "JASIMA_JOURNAL_SYNC_INTERVAL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := envName(tt.key); got != tt.want {
+				t.Errorf("envName(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "server.toml")
+
+	err := os.WriteFile(p, []byte(`
+name = "FILE"
+
+[admin]
+port = "7000"
+token = "file"
+
+[procedures]
+exchanges = 3
+replyRetries = 1
+
+[replay]
+speed = 2.5
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each key is set at one more source than the one before it, so that
+	// the source it is resolved from shows which takes precedence.
+
+	t.Setenv("JASIMA_CONFIG", p)
+	t.Setenv("JASIMA_ADMIN_PORT", "8000")
+	t.Setenv("JASIMA_ADMIN_TOKEN", "env")
+	t.Setenv("JASIMA_PROCEDURES_REPLY_TIMEOUT", "90s")
+
+	// The server defines its flags in main, so the flag that is set is
+	// defined here.
+
+	flag.String("adminToken", "", "")
+
+	err = flag.Set("adminToken", "flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := loadSettings("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := defaultSettings()
+
+	tests := []struct {
+		key  string
+		got  any
+		want any
+	}{
+		{"network.webPort", st.Network.WebPort, def.Network.WebPort},
+		{"name", st.Name, "FILE"},
+		{"procedures.exchanges", st.Procedures.Exchanges, 3},
+		{"procedures.replyRetries", st.Procedures.ReplyRetries, 1},
+		{"replay.speed", st.Replay.Speed, 2.5},
+		{"admin.port", st.Admin.Port, "8000"},
+		{"procedures.replyTimeout", st.Procedures.ReplyTimeout, 90 * time.Second},
+		{"admin.token", st.Admin.Token, "flag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid environment variable", func(t *testing.T) {
+		t.Setenv("JASIMA_PROCEDURES_EXCHANGES", "many")
+
+		_, err := loadSettings(p)
+		if err == nil {
+			t.Error("loadSettings() error = nil, want an invalid exchanges")
+		}
+	})
+
+	t.Run("invalid setting", func(t *testing.T) {
+		t.Setenv("JASIMA_PROCEDURES_EXCHANGES", "0")
+
+		_, err := loadSettings(p)
+		if err == nil {
+			t.Error("loadSettings() error = nil, want exchanges to be positive")
+		}
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/pkg/errors"
+)
+
+// Ways a layer conversation can end. Whatever the mode, a conversation ends
+// once it reaches its exchange limit or its time limit.
+const (
+	// endOnExchanges runs a conversation for all its exchanges.
+	endOnExchanges = "exchanges"
+
+	// endOnConsensus ends a conversation once every participant's latest
+	// message ends with `consensusStopToken`.
+	endOnConsensus = "consensus"
+
+	// endOnModerator ends a conversation once the agent with the moderator
+	// capability judges it has converged.
+	endOnModerator = "moderator"
+)
+
+// DefaultEndMode is the end mode of layers that do not set one.
+const DefaultEndMode = endOnExchanges
+
+var endModes = []string{endOnExchanges, endOnConsensus, endOnModerator}
+
+// DefaultJudgeEvery is how many exchanges the moderator lets pass between
+// judgements of layers that do not set `judgeEvery`.
+const DefaultJudgeEvery = 3
+
+// consensusStopToken is how agents signal that they are ready to end a
+// conversation.
+const consensusStopToken = "[STOP]"
+
+// termination decides when a layer conversation ends.
+type termination struct {
+	mode string
+
+	// minExchanges is how many exchanges run before a conversation may end
+	// early.
+	minExchanges int
+
+	// judgeEvery is how many exchanges pass between the moderator's
+	// judgements of whether a conversation has converged.
+	judgeEvery int
+
+	// timeLimit ends a conversation once it has run this long. Zero means
+	// no limit.
+	timeLimit time.Duration
+}
+
+func (t termination) validate() error {
+	switch t.mode {
+	case endOnExchanges, endOnConsensus, endOnModerator:
+	default:
+		return fmt.Errorf(
+			"unknown end mode %q, expected one of %s",
+			t.mode,
+			strings.Join(endModes, ", "),
+		)
+	}
+
+	if t.minExchanges < 0 {
+		return fmt.Errorf("minExchanges must be positive, got %d", t.minExchanges)
+	}
+
+	if t.mode == endOnExchanges && t.minExchanges != 0 {
+		return fmt.Errorf("minExchanges requires an end mode other than %s", endOnExchanges)
+	}
+
+	if t.judgeEvery < 0 {
+		return fmt.Errorf("judgeEvery must be positive, got %d", t.judgeEvery)
+	}
+
+	if t.mode != endOnModerator && t.judgeEvery != 0 {
+		return fmt.Errorf("judgeEvery requires the %s end mode", endOnModerator)
+	}
+
+	if t.timeLimit < 0 {
+		return fmt.Errorf("timeLimit must be positive, got %s", t.timeLimit)
+	}
+
+	return nil
+}
+
+// conversationEnd follows a single layer conversation towards its end.
+type conversationEnd struct {
+	termination
+
+	s            *ConlangServer
+	maxExchanges int
+	started      time.Time
+
+	// deadline fires once the conversation runs out of time. It is nil
+	// when there is no time limit.
+	deadline <-chan time.Time
+
+	// stopped tracks whether each participant's latest message signalled
+	// stop.
+	stopped map[chat.Name]bool
+
+	// moderator is the agent that last judged the conversation, and judged
+	// how many messages of the transcript it has been given.
+	moderator *network.ChatClient
+	judged    int
+}
+
+// begin starts the clock on a conversation of at most `maxExchanges`.
+func (t termination) begin(s *ConlangServer, maxExchanges int) *conversationEnd {
+	e := &conversationEnd{
+		termination:  t,
+		s:            s,
+		maxExchanges: maxExchanges,
+		started:      time.Now(),
+		stopped:      make(map[chat.Name]bool),
+	}
+
+	if t.timeLimit > 0 {
+		e.deadline = time.After(t.timeLimit)
+	}
+
+	return e
+}
+
+// judgesAt reports whether the moderator judges the conversation once it
+// reaches `exchanges`. It judges every `judgeEvery` exchanges, starting from
+// `minExchanges`.
+func (t termination) judgesAt(exchanges int) bool {
+	if exchanges < t.minExchanges {
+		return false
+	}
+
+	return (exchanges-t.minExchanges)%t.judgeEvery == 0
+}
+
+// instructions tells agents how to end the conversation, if they can.
+func (t termination) instructions() string {
+	if t.mode != endOnConsensus {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"\nWhen you agree that nothing is left to discuss, end your message"+
+			" with %s. The discussion ends once everyone has done so.\n",
+		consensusStopToken,
+	)
+}
+
+// over returns why the conversation ends after `m`, which brought it to
+// `exchanges`. It returns an empty reason while the conversation goes on.
+func (e *conversationEnd) over(
+	ctx context.Context,
+	m memory.Message,
+	exchanges int,
+	participants []*network.ChatClient,
+	transcript memory.TranscriptMessages,
+) (string, error) {
+	e.stopped[m.Sender] = strings.HasSuffix(
+		strings.TrimSpace(m.Text.String()),
+		consensusStopToken,
+	)
+
+	if exchanges >= e.maxExchanges {
+		return fmt.Sprintf("reached its limit of %d exchanges", e.maxExchanges), nil
+	}
+
+	if exchanges < e.minExchanges {
+		return "", nil
+	}
+
+	switch e.mode {
+	case endOnConsensus:
+		for _, c := range participants {
+			if !e.stopped[c.Name] {
+				return "", nil
+			}
+		}
+
+		return "every agent agreed to stop", nil
+
+	case endOnModerator:
+		if !e.judgesAt(exchanges) {
+			return "", nil
+		}
+
+		res, err := e.judge(ctx, transcript)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+
+			e.s.logger.Warnf("Moderator did not judge convergence: %v", err)
+
+			return "", nil
+		}
+
+		if res.Converged {
+			return "the moderator judged it converged: " + res.Reason, nil
+		}
+	}
+
+	return "", nil
+}
+
+// judge asks the moderator whether `transcript` has converged. The moderator
+// that judged last keeps its earlier judgements and is only given what was
+// said since. Any other starts afresh with the whole transcript.
+func (e *conversationEnd) judge(
+	ctx context.Context,
+	transcript memory.TranscriptMessages,
+) (memory.ResponseConvergence, error) {
+	var res memory.ResponseConvergence
+
+	reply, mod, err := e.s.ask(ctx, systemRequest{
+		role: agent.CapabilityModerator,
+		prepare: func(ctx context.Context, c *network.ChatClient) error {
+			if c == e.moderator {
+				return nil
+			}
+
+			return e.s.swc(ctx, e.s.cmd(agent.ClearMemory)(c))
+		},
+		request: func(c *network.ChatClient) *chat.Message {
+			req := fmt.Sprintf(
+				"Has this discussion converged, so that it may end?\n%s",
+				transcriptToString(transcript),
+			)
+
+			if c == e.moderator {
+				req = fmt.Sprintf(
+					"Has the discussion converged now, so that it may end? This is what was said since you last judged it:\n%s",
+					transcriptToString(transcript[e.judged:]),
+				)
+			}
+
+			return e.s.cmd(agent.RequestConvergence, req)(c)
+		},
+	})
+	if err != nil {
+		return res, err
+	}
+
+	e.moderator, e.judged = mod, len(transcript)
+
+	err = json.Unmarshal([]byte(reply.Text), &res)
+	if err != nil {
+		return res, errors.Wrap(err, "failed to unmarshal convergence")
+	}
+
+	return res, nil
+}
+
+// end records why the conversation on `layer` ended as the last message of
+// its transcript, then resets.
+func (e *conversationEnd) end(
+	ctx context.Context,
+	layer chat.Layer,
+	exchanges int,
+	reason string,
+	transcript memory.TranscriptMessages,
+) (memory.TranscriptMessages, error) {
+	note := memory.NewChatMessage(
+		e.s.name.String(),
+		"",
+		fmt.Sprintf(
+			"The conversation ended after %d exchanges in %s: %s.",
+			exchanges,
+			time.Since(e.started).Truncate(time.Second),
+			reason,
+		),
+		int32(layer),
+	)
+
+	e.s.logger.Infof("%s %s", layer, note.Text)
+
+	transcript = append(transcript, *note)
+
+	return transcript, e.reset(ctx)
+}
+
+// reset resets the moderator if it was asked to judge.
+func (e *conversationEnd) reset(ctx context.Context) error {
+	if e.moderator == nil {
+		return nil
+	}
+
+	return e.s.resetAgent(ctx, e.moderator)
+}
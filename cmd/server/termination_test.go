@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestConversationEnd_over(t *testing.T) {
+	gs, err := network.NewChatServer(log.New(io.Discard), make(chan error, 10), network.WithPort("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &ConlangServer{
+		logger: log.New(io.Discard),
+		gs:     gs,
+		config: &config{},
+	}
+
+	participants := []*network.ChatClient{{Name: "toki"}, {Name: "pona"}}
+
+	// Each message brings the conversation to one more exchange than the
+	// one before it. wantOver is the exchange after which it ends, or zero
+	// if it goes on.
+
+	type message struct {
+		sender chat.Name
+		text   string
+	}
+
+	tests := []struct {
+		name         string
+		termination  termination
+		maxExchanges int
+		messages     []message
+		wantOver     int
+	}{
+		{
+			name:         "exchanges",
+			termination:  termination{mode: endOnExchanges},
+			maxExchanges: 3,
+			messages: []message{
+				{"toki", "[STOP]"},
+				{"pona", "[STOP]"},
+				{"toki", "[STOP]"},
+			},
+			wantOver: 3,
+		},
+		{
+			name:         "consensus",
+			termination:  termination{mode: endOnConsensus},
+			maxExchanges: 10,
+			messages: []message{
+				{"toki", "toki [STOP]"},
+				{"pona", "pona"},
+				{"toki", "toki"},
+				{"pona", "pona [STOP]\n"},
+				{"toki", "toki [STOP]"},
+				{"pona", "pona"},
+			},
+			wantOver: 5,
+		},
+		{
+			name:         "consensus withdrawn",
+			termination:  termination{mode: endOnConsensus},
+			maxExchanges: 10,
+			messages: []message{
+				{"toki", "[STOP]"},
+				{"toki", "toki"},
+				{"pona", "[STOP]"},
+			},
+		},
+		{
+			name:         "consensus before minExchanges",
+			termination:  termination{mode: endOnConsensus, minExchanges: 4},
+			maxExchanges: 10,
+			messages: []message{
+				{"toki", "[STOP]"},
+				{"pona", "[STOP]"},
+				{"toki", "[STOP]"},
+				{"pona", "[STOP]"},
+			},
+			wantOver: 4,
+		},
+		{
+			name:         "exchange limit before minExchanges",
+			termination:  termination{mode: endOnConsensus, minExchanges: 4},
+			maxExchanges: 2,
+			messages: []message{
+				{"toki", "toki"},
+				{"pona", "pona"},
+			},
+			wantOver: 2,
+		},
+		{
+			name:         "moderator who does not judge",
+			termination:  termination{mode: endOnModerator, judgeEvery: 1},
+			maxExchanges: 3,
+			messages: []message{
+				{"toki", "[STOP]"},
+				{"pona", "[STOP]"},
+				{"toki", "[STOP]"},
+			},
+			wantOver: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.termination.begin(s, tt.maxExchanges)
+
+			for i, m := range tt.messages {
+				exchanges := i + 1
+
+				reason, err := e.over(
+					context.Background(),
+					memory.Message{Sender: m.sender, Text: chat.Content(m.text)},
+					exchanges,
+					participants,
+					nil,
+				)
+				if err != nil {
+					t.Fatalf("over() error = %v", err)
+				}
+
+				if over := reason != ""; over != (exchanges == tt.wantOver) {
+					t.Fatalf("over() after %d exchanges = %q, want it over after %d", exchanges, reason, tt.wantOver)
+				}
+
+				if reason != "" {
+					return
+				}
+			}
+		})
+	}
+}
+
+func TestTermination_judgesAt(t *testing.T) {
+	tests := []struct {
+		name        string
+		termination termination
+		want        []int
+	}{
+		{
+			name:        "every exchange",
+			termination: termination{judgeEvery: 1},
+			want:        []int{1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:        "every third exchange",
+			termination: termination{judgeEvery: 3},
+			want:        []int{3, 6},
+		},
+		{
+			name:        "from minExchanges",
+			termination: termination{minExchanges: 2, judgeEvery: 1},
+			want:        []int{2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:        "every other exchange from minExchanges",
+			termination: termination{minExchanges: 3, judgeEvery: 2},
+			want:        []int{3, 5, 7},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+
+			for exchanges := 1; exchanges <= 7; exchanges++ {
+				if tt.termination.judgesAt(exchanges) {
+					got = append(got, exchanges)
+				}
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("judged at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversationEnd_judge(t *testing.T) {
+	gs, err := network.NewChatServer(log.New(io.Discard), make(chan error, 10), network.WithPort("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &ConlangServer{
+		logger: log.New(io.Discard),
+		gs:     gs,
+		config: &config{},
+	}
+
+	e := termination{mode: endOnModerator, judgeEvery: 1}.begin(s, 10)
+
+	_, err = e.judge(context.Background(), nil)
+	if err == nil {
+		t.Error("judge() error = nil, want no moderator")
+	}
+
+	if e.moderator != nil || e.judged != 0 {
+		t.Errorf("judge() recorded moderator %v that judged %d messages, want none", e.moderator, e.judged)
+	}
+}
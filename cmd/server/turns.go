@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultTurnPolicy is the turn policy of layers that do not set one.
+const DefaultTurnPolicy = "direct"
+
+// turn is who takes part in the next exchange of a layer conversation.
+type turn struct {
+	// receivers are forwarded the message that was just sent.
+	receivers []*network.ChatClient
+
+	// speakers are unlatched, so that they reply to the message. Every
+	// other participant is latched, and only listens.
+	speakers []*network.ChatClient
+}
+
+// turnPolicy decides who receives each message of a layer conversation and
+// who may reply to it.
+type turnPolicy interface {
+	// start returns who is unlatched before the conversation is kicked off
+	// by `participants[0]`.
+	start(participants []*network.ChatClient) []*network.ChatClient
+
+	// next returns the turn that follows message `m`.
+	next(
+		ctx context.Context,
+		m memory.Message,
+		participants []*network.ChatClient,
+	) (turn, error)
+
+	// end cleans up after the conversation is over.
+	end(ctx context.Context) error
+}
+
+// turnPolicies holds every turn policy a layer can use, by name. Each call
+// creates a policy for a single conversation.
+var turnPolicies = map[string]func(s *ConlangServer) turnPolicy{
+	// direct forwards a message only to the agent it is addressed to, and
+	// leaves every agent unlatched. Agents address their first peer.
+	"direct": func(_ *ConlangServer) turnPolicy {
+		return directTurns{}
+	},
+
+	// round-robin lets every agent hear every message, and gives the next
+	// turn to the agent after the sender.
+	"round-robin": func(_ *ConlangServer) turnPolicy {
+		return singleSpeaker(roundRobin)
+	},
+
+	// random lets every agent hear every message, and gives the next turn
+	// to a random agent other than the sender.
+	"random": func(_ *ConlangServer) turnPolicy {
+		return singleSpeaker(randomSpeaker)
+	},
+
+	// moderator lets every agent hear every message, and asks the agent
+	// with the moderator capability who speaks next.
+	"moderator": func(s *ConlangServer) turnPolicy {
+		return &moderatorTurns{s: s}
+	},
+
+	// free-for-all lets every agent hear and reply to every message, as if
+	// the conversation were a shared message queue.
+	"free-for-all": func(_ *ConlangServer) turnPolicy {
+		return freeTurns{}
+	},
+}
+
+func turnPolicyNames() []string {
+	names := make([]string, 0, len(turnPolicies))
+	for k := range turnPolicies {
+		names = append(names, k)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+type directTurns struct{}
+
+func (directTurns) start(participants []*network.ChatClient) []*network.ChatClient {
+	return participants
+}
+
+func (directTurns) next(
+	_ context.Context,
+	m memory.Message,
+	participants []*network.ChatClient,
+) (turn, error) {
+	i := slices.IndexFunc(participants, func(c *network.ChatClient) bool {
+		return c.Name == m.Receiver
+	})
+
+	// Messages addressed to no one on the layer go to everyone.
+
+	receivers := others(m.Sender, participants)
+	if i >= 0 {
+		receivers = participants[i : i+1]
+	}
+
+	return turn{receivers: receivers, speakers: participants}, nil
+}
+
+func (directTurns) end(_ context.Context) error { return nil }
+
+type freeTurns struct{}
+
+func (freeTurns) start(participants []*network.ChatClient) []*network.ChatClient {
+	return participants
+}
+
+func (freeTurns) next(
+	_ context.Context,
+	m memory.Message,
+	participants []*network.ChatClient,
+) (turn, error) {
+	return turn{
+		receivers: others(m.Sender, participants),
+		speakers:  participants,
+	}, nil
+}
+
+func (freeTurns) end(_ context.Context) error { return nil }
+
+// singleSpeaker is a policy in which every agent hears every message, but
+// only the agent it returns may reply.
+type singleSpeaker func(
+	m memory.Message,
+	others []*network.ChatClient,
+	all []*network.ChatClient,
+) *network.ChatClient
+
+func (singleSpeaker) start(participants []*network.ChatClient) []*network.ChatClient {
+	return participants[:1]
+}
+
+func (f singleSpeaker) next(
+	_ context.Context,
+	m memory.Message,
+	participants []*network.ChatClient,
+) (turn, error) {
+	receivers := others(m.Sender, participants)
+	if len(receivers) == 0 {
+		return turn{}, errors.Errorf("%s has no one to talk to", m.Sender)
+	}
+
+	return turn{
+		receivers: receivers,
+		speakers:  []*network.ChatClient{f(m, receivers, participants)},
+	}, nil
+}
+
+func (singleSpeaker) end(_ context.Context) error { return nil }
+
+func roundRobin(
+	m memory.Message,
+	_ []*network.ChatClient,
+	all []*network.ChatClient,
+) *network.ChatClient {
+	return nextAfter(m.Sender, all)
+}
+
+func randomSpeaker(
+	_ memory.Message,
+	others []*network.ChatClient,
+	_ []*network.ChatClient,
+) *network.ChatClient {
+	return others[rand.IntN(len(others))]
+}
+
+// moderatorTurns asks a moderator agent who speaks next. It falls back to
+// round-robin when there is no moderator or its choice is not a participant.
+type moderatorTurns struct {
+	s         *ConlangServer
+	moderator *network.ChatClient
+}
+
+func (p *moderatorTurns) start(participants []*network.ChatClient) []*network.ChatClient {
+	return participants[:1]
+}
+
+func (p *moderatorTurns) next(
+	ctx context.Context,
+	m memory.Message,
+	participants []*network.ChatClient,
+) (turn, error) {
+	receivers := others(m.Sender, participants)
+	if len(receivers) == 0 {
+		return turn{}, errors.Errorf("%s has no one to talk to", m.Sender)
+	}
+
+	t := turn{
+		receivers: receivers,
+		speakers:  []*network.ChatClient{nextAfter(m.Sender, participants)},
+	}
+
+	speaker, err := p.choose(ctx, m, receivers)
+	if err != nil {
+		if ctx.Err() != nil {
+			return t, ctx.Err()
+		}
+
+		p.s.logger.Warnf("Moderator did not choose, using round-robin: %v", err)
+
+		return t, nil
+	}
+
+	t.speakers = []*network.ChatClient{speaker}
+
+	return t, nil
+}
+
+// choose asks the moderator which of `candidates` replies to `m`.
+func (p *moderatorTurns) choose(
+	ctx context.Context,
+	m memory.Message,
+	candidates []*network.ChatClient,
+) (*network.ChatClient, error) {
+	names := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		names = append(names, c.Name.String())
+	}
+
+	req := fmt.Sprintf(
+		"%s said:\n%s\n\nChoose who speaks next, one of: %s",
+		m.Sender,
+		m.Text,
+		strings.Join(names, ", "),
+	)
+
+	reply, mod, err := p.s.ask(ctx, systemRequest{
+		role:    agent.CapabilityModerator,
+		request: p.s.cmd(agent.RequestNextSpeaker, req),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.moderator = mod
+
+	var res memory.ResponseNextSpeaker
+
+	err = json.Unmarshal([]byte(reply.Text), &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal next speaker")
+	}
+
+	i := slices.IndexFunc(candidates, func(c *network.ChatClient) bool {
+		return c.Name == chat.Name(res.Speaker)
+	})
+	if i < 0 {
+		return nil, errors.Errorf("moderator chose %q, who cannot speak", res.Speaker)
+	}
+
+	p.s.logger.Debugf("Moderator chose %s: %s", res.Speaker, res.Reason)
+
+	return candidates[i], nil
+}
+
+func (p *moderatorTurns) end(ctx context.Context) error {
+	if p.moderator == nil {
+		return nil
+	}
+
+	return p.s.resetAgent(ctx, p.moderator)
+}
+
+// others returns every participant except `name`.
+func others(name chat.Name, participants []*network.ChatClient) []*network.ChatClient {
+	o := make([]*network.ChatClient, 0, len(participants))
+	for _, c := range participants {
+		if c.Name != name {
+			o = append(o, c)
+		}
+	}
+
+	return o
+}
+
+// nextAfter returns the participant after `name`, wrapping around. If `name`
+// is not a participant, such as when the server kicks off a conversation, it
+// returns the first participant.
+func nextAfter(name chat.Name, participants []*network.ChatClient) *network.ChatClient {
+	i := slices.IndexFunc(participants, func(c *network.ChatClient) bool {
+		return c.Name == name
+	})
+
+	return participants[(i+1)%len(participants)]
+}
+
+// takeTurn latches every participant that is not a speaker of `t` and
+// unlatches every speaker, then forwards `m` to the receivers of `t`.
+// `unlatched` tracks who is unlatched between turns, so that only changes
+// are sent.
+func (s *ConlangServer) takeTurn(
+	ctx context.Context,
+	m memory.Message,
+	t turn,
+	participants []*network.ChatClient,
+	unlatched map[chat.Name]bool,
+) error {
+	err := s.setSpeakers(ctx, t.speakers, participants, unlatched)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range t.receivers {
+		fm := m
+		fm.Receiver = r.Name
+
+		err = s.gs.Broadcast(&fm)
+		if err != nil {
+			return errors.Wrap(err, "failed to forward exchange")
+		}
+	}
+
+	return nil
+}
+
+// setSpeakers unlatches `speakers` and latches every other participant. It
+// returns once every participant has acknowledged the commands it was sent.
+func (s *ConlangServer) setSpeakers(
+	ctx context.Context,
+	speakers []*network.ChatClient,
+	participants []*network.ChatClient,
+	unlatched map[chat.Name]bool,
+) error {
+	var latch, unlatch []*network.ChatClient
+
+	for _, c := range participants {
+		speaks := slices.Contains(speakers, c)
+
+		switch {
+		case speaks && !unlatched[c.Name]:
+			unlatch = append(unlatch, c)
+		case !speaks && unlatched[c.Name]:
+			latch = append(latch, c)
+		}
+
+		unlatched[c.Name] = speaks
+	}
+
+	sendCommands := network.SendCommandBuilder(ctx, s.gs.Channel.ToClients)
+
+	err := sendCommands(latch, s.cmd(agent.Latch))
+	if err != nil {
+		return errors.Wrap(err, "failed to latch participants")
+	}
+
+	err = sendCommands(unlatch, s.cmd(agent.Unlatch))
+	if err != nil {
+		return errors.Wrap(err, "failed to unlatch participants")
+	}
+
+	return s.settle(ctx, participants, network.Settled)
+}
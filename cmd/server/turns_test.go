@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/charmbracelet/log"
+)
+
+// names returns the names of `clients`.
+func names(clients []*network.ChatClient) []chat.Name {
+	n := make([]chat.Name, 0, len(clients))
+	for _, c := range clients {
+		n = append(n, c.Name)
+	}
+
+	return n
+}
+
+func TestTurnPolicies(t *testing.T) {
+	gs, err := network.NewChatServer(log.New(io.Discard), make(chan error, 10), network.WithPort("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// There is no moderator to ask, so the moderator policy takes turns
+	// round-robin.
+
+	s := &ConlangServer{
+		logger: log.New(io.Discard),
+		gs:     gs,
+		config: &config{},
+		cmd:    network.BuildCommand("SERVER"),
+	}
+
+	participants := []*network.ChatClient{{Name: "toki"}, {Name: "pona"}, {Name: "suli"}}
+
+	tests := []struct {
+		name          string
+		policy        string
+		participants  []*network.ChatClient
+		sender        chat.Name
+		receiver      chat.Name
+		wantStart     []chat.Name
+		wantReceivers []chat.Name
+		wantSpeakers  []chat.Name
+		wantErr       bool
+	}{
+		{
+			name:          "direct",
+			policy:        "direct",
+			participants:  participants,
+			sender:        "toki",
+			receiver:      "suli",
+			wantStart:     []chat.Name{"toki", "pona", "suli"},
+			wantReceivers: []chat.Name{"suli"},
+			wantSpeakers:  []chat.Name{"toki", "pona", "suli"},
+		},
+		{
+			name:          "direct to no one on the layer",
+			policy:        "direct",
+			participants:  participants,
+			sender:        "toki",
+			receiver:      "ike",
+			wantStart:     []chat.Name{"toki", "pona", "suli"},
+			wantReceivers: []chat.Name{"pona", "suli"},
+			wantSpeakers:  []chat.Name{"toki", "pona", "suli"},
+		},
+		{
+			name:          "free-for-all",
+			policy:        "free-for-all",
+			participants:  participants,
+			sender:        "pona",
+			receiver:      "toki",
+			wantStart:     []chat.Name{"toki", "pona", "suli"},
+			wantReceivers: []chat.Name{"toki", "suli"},
+			wantSpeakers:  []chat.Name{"toki", "pona", "suli"},
+		},
+		{
+			name:          "round-robin",
+			policy:        "round-robin",
+			participants:  participants,
+			sender:        "toki",
+			wantStart:     []chat.Name{"toki"},
+			wantReceivers: []chat.Name{"pona", "suli"},
+			wantSpeakers:  []chat.Name{"pona"},
+		},
+		{
+			name:          "round-robin wrapping around",
+			policy:        "round-robin",
+			participants:  participants,
+			sender:        "suli",
+			wantStart:     []chat.Name{"toki"},
+			wantReceivers: []chat.Name{"toki", "pona"},
+			wantSpeakers:  []chat.Name{"toki"},
+		},
+		{
+			name:          "round-robin from someone who is not a participant",
+			policy:        "round-robin",
+			participants:  participants,
+			sender:        "SERVER",
+			wantStart:     []chat.Name{"toki"},
+			wantReceivers: []chat.Name{"toki", "pona", "suli"},
+			wantSpeakers:  []chat.Name{"toki"},
+		},
+		{
+			name:         "round-robin with no one to talk to",
+			policy:       "round-robin",
+			participants: participants[:1],
+			sender:       "toki",
+			wantStart:    []chat.Name{"toki"},
+			wantErr:      true,
+		},
+		{
+			name:          "moderator without a moderator",
+			policy:        "moderator",
+			participants:  participants,
+			sender:        "pona",
+			wantStart:     []chat.Name{"toki"},
+			wantReceivers: []chat.Name{"toki", "suli"},
+			wantSpeakers:  []chat.Name{"suli"},
+		},
+		{
+			name:         "moderator with no one to talk to",
+			policy:       "moderator",
+			participants: participants[:1],
+			sender:       "toki",
+			wantStart:    []chat.Name{"toki"},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := turnPolicies[tt.policy](s)
+
+			if got := names(p.start(tt.participants)); !slices.Equal(got, tt.wantStart) {
+				t.Errorf("start() = %v, want %v", got, tt.wantStart)
+			}
+
+			got, err := p.next(
+				context.Background(),
+				memory.Message{Sender: tt.sender, Receiver: tt.receiver},
+				tt.participants,
+			)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("next() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if receivers := names(got.receivers); !slices.Equal(receivers, tt.wantReceivers) {
+				t.Errorf("next() receivers = %v, want %v", receivers, tt.wantReceivers)
+			}
+
+			if speakers := names(got.speakers); !slices.Equal(speakers, tt.wantSpeakers) {
+				t.Errorf("next() speakers = %v, want %v", speakers, tt.wantSpeakers)
+			}
+		})
+	}
+}
+
+func TestRandomSpeaker(t *testing.T) {
+	participants := []*network.ChatClient{{Name: "toki"}, {Name: "pona"}, {Name: "suli"}}
+
+	p := singleSpeaker(randomSpeaker)
+
+	for range 50 {
+		got, err := p.next(context.Background(), memory.Message{Sender: "pona"}, participants)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if speaker := got.speakers[0].Name; len(got.speakers) != 1 || speaker == "pona" {
+			t.Fatalf("next() speakers = %v, want one of toki and suli", names(got.speakers))
+		}
+	}
+}
+
+func TestNextAfter(t *testing.T) {
+	participants := []*network.ChatClient{{Name: "toki"}, {Name: "pona"}, {Name: "suli"}}
+
+	tests := []struct {
+		name         string
+		participants []*network.ChatClient
+		want         chat.Name
+	}{
+		{"toki", participants, "pona"},
+		{"pona", participants, "suli"},
+		{"suli", participants, "toki"},
+		{"SERVER", participants, "toki"},
+		{"toki", participants[:1], "toki"},
+	}
+
+	for _, tt := range tests {
+		if got := nextAfter(chat.Name(tt.name), tt.participants).Name; got != tt.want {
+			t.Errorf("nextAfter(%s, %v) = %s, want %s", tt.name, names(tt.participants), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	watchTimeout  = "timeout"
+	watchNudge    = "nudge"
+	watchFallback = "fallback"
+	watchGaveUp   = "gave-up"
+)
+
+// errAgentSilent is returned when an agent does not reply to a request, even
+// after it was nudged.
+var errAgentSilent = errors.New("agent did not reply")
+
+// watchNotes are the watchdog's notes about system agents in the generation
+// being evolved. They are recorded in the generation's system transcript
+// once it is saved.
+type watchNotes struct {
+	mu    sync.Mutex
+	notes memory.TranscriptMessages
+}
+
+func (w *watchNotes) add(note memory.Message) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.notes = append(w.notes, note)
+}
+
+// flush records the notes in the system transcript of `g`.
+func (w *watchNotes) flush(g *memory.Generation) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.notes) == 0 {
+		return
+	}
+
+	g.Transcript[chat.SystemLayer] = append(g.Transcript[chat.SystemLayer], w.notes...)
+	w.notes = nil
+}
+
+func (w *watchNotes) clear() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.notes = nil
+}
+
+// watch surfaces `ev` to operators and displays, and returns it as a note for
+// a transcript.
+func (s *ConlangServer) watch(ev network.WatchdogEvent) memory.Message {
+	ev.Time = time.Now()
+
+	s.logger.Warn(
+		"Watchdog",
+		"kind", ev.Kind,
+		"client", ev.Client,
+		"layer", ev.Layer,
+		"detail", ev.Detail,
+	)
+
+	err := s.ws.InitialData.RecentWatchdog.Enqueue(ev)
+	if err != nil {
+		s.logger.Errorf("failed to save watchdog event to InitialData: %v", err)
+	}
+
+	s.ws.Broadcasters.Watchdog.Broadcast(ev)
+
+	return *memory.NewChatMessage(
+		s.name.String(),
+		"",
+		fmt.Sprintf("Watchdog %s %s: %s", ev.Kind, ev.Client, ev.Detail),
+		int32(ev.Layer),
+	)
+}
+
+// alive reports whether `c` has sent anything, heartbeats included, within
+// `DefaultHeartbeatTimeout`.
+func alive(c *network.ChatClient) bool {
+	return time.Since(c.LastSeen()) < DefaultHeartbeatTimeout
+}
+
+// systemRequest is a request that any system agent with `role` can reply to.
+type systemRequest struct {
+	role agent.Capability
+
+	// prepare readies an agent for the request, such as by giving it
+	// instructions. It may be nil.
+	prepare func(ctx context.Context, c *network.ChatClient) error
+
+	// request is the message that asks an agent for its reply.
+	request func(c *network.ChatClient) *chat.Message
+}
+
+// ask sends `r` to the first agent with its role. An agent that does not reply
+// in time is nudged by sending the request again. After `replyRetries` nudges,
+// or as soon as it misses its heartbeats, the agent is reset and the next
+// agent with the role is asked instead. It returns the reply and the agent
+// that replied, which the caller resets when it is done with it.
+func (s *ConlangServer) ask(
+	ctx context.Context,
+	r systemRequest,
+) (memory.Message, *network.ChatClient, error) {
+	candidates := s.clientsByCapability(r.role)
+	if len(candidates) == 0 {
+		return memory.Message{}, nil, fmt.Errorf(
+			"no ChatClient with capability '%s' found", r.role,
+		)
+	}
+
+	for i, c := range candidates {
+		var err error
+
+		// An agent that missed its heartbeats is not asked at all, unless
+		// it is the last one left.
+
+		if alive(c) || i+1 == len(candidates) {
+			var reply memory.Message
+
+			reply, err = s.askClient(ctx, c, r)
+			if err == nil {
+				return reply, c, nil
+			}
+
+			if !errors.Is(err, errAgentSilent) {
+				return memory.Message{}, nil, err
+			}
+		}
+
+		// Only an agent that is still connected can take the reset.
+
+		if alive(c) {
+			_ = s.sendReset(ctx, c)
+		}
+
+		if i+1 < len(candidates) {
+			s.watchNotes.add(s.watch(network.WatchdogEvent{
+				Kind:   watchFallback,
+				Client: c.Name,
+				Layer:  chat.SystemLayer,
+				Role:   r.role,
+				Detail: fmt.Sprintf("asking %s instead", candidates[i+1].Name),
+			}))
+		}
+	}
+
+	s.watchNotes.add(s.watch(network.WatchdogEvent{
+		Kind:   watchGaveUp,
+		Layer:  chat.SystemLayer,
+		Role:   r.role,
+		Detail: fmt.Sprintf("no %s replied", r.role),
+	}))
+
+	return memory.Message{}, nil, errors.Wrapf(errAgentSilent, "no %s replied", r.role)
+}
+
+// askClient sends `r` to `c` and waits for its reply, nudging it when it
+// is late.
+func (s *ConlangServer) askClient(
+	ctx context.Context,
+	c *network.ChatClient,
+	r systemRequest,
+) (memory.Message, error) {
+	// A reply that arrived after an earlier request gave up on `c` would be
+	// taken for the reply to this one.
+
+	s.replies.drain(c.Name)
+
+	if r.prepare != nil {
+		err := r.prepare(ctx, c)
+		if err != nil {
+			return memory.Message{}, err
+		}
+	}
+
+	var (
+		timeout   = s.config.procedures.replyTimeout
+		deadline  = time.NewTimer(timeout)
+		heartbeat = time.NewTicker(DefaultHeartbeatTimeout / 3)
+	)
+
+	defer deadline.Stop()
+	defer heartbeat.Stop()
+
+	err := s.swc(ctx, r.request(c))
+	if err != nil {
+		return memory.Message{}, err
+	}
+
+	for nudges := 0; ; {
+		select {
+		case <-ctx.Done():
+			return memory.Message{}, ctx.Err()
+
+		case reply := <-s.replies.from(c.Name):
+			return reply, nil
+
+		case <-heartbeat.C:
+			if alive(c) {
+				continue
+			}
+
+			s.watchNotes.add(s.watch(network.WatchdogEvent{
+				Kind:   watchTimeout,
+				Client: c.Name,
+				Layer:  chat.SystemLayer,
+				Role:   r.role,
+				Detail: fmt.Sprintf("no heartbeat since %s", c.LastSeen().Format(time.TimeOnly)),
+			}))
+
+			return memory.Message{}, errAgentSilent
+
+		case <-deadline.C:
+			s.watchNotes.add(s.watch(network.WatchdogEvent{
+				Kind:   watchTimeout,
+				Client: c.Name,
+				Layer:  chat.SystemLayer,
+				Role:   r.role,
+				Detail: fmt.Sprintf("no reply after %s", timeout),
+			}))
+
+			if nudges == s.config.procedures.replyRetries {
+				return memory.Message{}, errAgentSilent
+			}
+
+			nudges++
+
+			s.watchNotes.add(s.watch(network.WatchdogEvent{
+				Kind:   watchNudge,
+				Client: c.Name,
+				Layer:  chat.SystemLayer,
+				Role:   r.role,
+				Detail: fmt.Sprintf("sending the request again, nudge %d", nudges),
+			}))
+
+			err = s.swc(ctx, r.request(c))
+			if err != nil {
+				return memory.Message{}, err
+			}
+
+			deadline.Reset(timeout)
+		}
+	}
+}
+
+// layerWatch notices when the agents of a layer conversation stop replying.
+type layerWatch struct {
+	s     *ConlangServer
+	layer chat.Layer
+	timer *time.Timer
+
+	// nudges is the number of times the agents that are waited on were
+	// nudged.
+	nudges int
+}
+
+func (s *ConlangServer) watchLayer(layer chat.Layer) *layerWatch {
+	return &layerWatch{
+		s:     s,
+		layer: layer,
+		timer: time.NewTimer(s.config.procedures.replyTimeout),
+	}
+}
+
+// replied restarts the deadline once a message arrives.
+func (w *layerWatch) replied() {
+	w.nudges = 0
+	w.timer.Reset(w.s.config.procedures.replyTimeout)
+}
+
+func (w *layerWatch) stop() {
+	w.timer.Stop()
+}
+
+// silent is called when `waiting` did not reply in time. It returns notes for
+// the layer's transcript, and whether `waiting` should be nudged. When they
+// should not, they have used up their nudges or missed their heartbeats, and
+// the conversation goes on without them.
+func (w *layerWatch) silent(waiting []*network.ChatClient) ([]memory.Message, bool) {
+	var (
+		notes   []memory.Message
+		timeout = w.s.config.procedures.replyTimeout
+		living  bool
+	)
+
+	for _, c := range waiting {
+		notes = append(notes, w.s.watch(network.WatchdogEvent{
+			Kind:   watchTimeout,
+			Client: c.Name,
+			Layer:  w.layer,
+			Detail: fmt.Sprintf("no reply after %s", timeout),
+		}))
+
+		living = living || alive(c)
+	}
+
+	defer w.timer.Reset(timeout)
+
+	if living && w.nudges < w.s.config.procedures.replyRetries {
+		w.nudges++
+
+		for _, c := range waiting {
+			notes = append(notes, w.s.watch(network.WatchdogEvent{
+				Kind:   watchNudge,
+				Client: c.Name,
+				Layer:  w.layer,
+				Detail: fmt.Sprintf("sending the last message again, nudge %d", w.nudges),
+			}))
+		}
+
+		return notes, true
+	}
+
+	w.nudges = 0
+
+	for _, c := range waiting {
+		notes = append(notes, w.s.watch(network.WatchdogEvent{
+			Kind:   watchFallback,
+			Client: c.Name,
+			Layer:  w.layer,
+			Detail: "continuing the conversation without it",
+		}))
+	}
+
+	return notes, false
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultWordSelection is how words are chosen for logograms when a pipeline
+// does not say.
+var DefaultWordSelection = []string{"transcript"}
+
+// wordSelection is what a word selector chooses from.
+type wordSelection struct {
+	// g is the generation being evolved.
+	g *memory.Generation
+
+	// history are the generations evolved before `g`, oldest first.
+	history []memory.Generation
+}
+
+// wordSelector returns the words it would iterate on, best first. It may
+// return more words than are needed.
+type wordSelector func(
+	s *ConlangServer,
+	ctx context.Context,
+	ws wordSelection,
+) ([]string, error)
+
+// wordSelectors holds every strategy that can choose the words whose
+// logograms are iterated on, by name.
+var wordSelectors = map[string]wordSelector{
+	// transcript chooses the words used in the logography layer's
+	// transcript, in the order they were found.
+	"transcript": transcriptWords,
+
+	// most-frequent chooses the words used most across every layer's
+	// transcript.
+	"most-frequent": func(_ *ConlangServer, _ context.Context, ws wordSelection) ([]string, error) {
+		var sb strings.Builder
+		for _, t := range ws.g.Transcript {
+			sb.WriteString(t.String())
+		}
+
+		counts := countWords(ws.g.Dictionary, sb.String())
+
+		words := slices.Collect(maps.Keys(counts))
+		slices.SortFunc(words, func(a, b string) int {
+			return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+		})
+
+		return words, nil
+	},
+
+	// least-recently-iterated chooses the words whose logograms have gone
+	// the longest without changing, starting with those that never have.
+	"least-recently-iterated": func(_ *ConlangServer, _ context.Context, ws wordSelection) ([]string, error) {
+		changed := lastIterated(ws.history)
+
+		words := slices.Sorted(maps.Keys(ws.g.Dictionary))
+		slices.SortStableFunc(words, func(a, b string) int {
+			return cmp.Compare(changed[a], changed[b])
+		})
+
+		return words, nil
+	},
+
+	// never-iterated chooses the words whose logograms have never changed.
+	"never-iterated": func(_ *ConlangServer, _ context.Context, ws wordSelection) ([]string, error) {
+		changed := lastIterated(ws.history)
+
+		var words []string
+		for _, w := range slices.Sorted(maps.Keys(ws.g.Dictionary)) {
+			if _, ok := changed[w]; !ok {
+				words = append(words, w)
+			}
+		}
+
+		return words, nil
+	},
+
+	// new-words chooses the words added to the dictionary since the
+	// previous generation.
+	"new-words": func(_ *ConlangServer, _ context.Context, ws wordSelection) ([]string, error) {
+		if len(ws.history) == 0 {
+			return nil, nil
+		}
+
+		prev := ws.history[len(ws.history)-1].Dictionary
+
+		var words []string
+		for _, w := range slices.Sorted(maps.Keys(ws.g.Dictionary)) {
+			if _, ok := prev[w]; !ok {
+				words = append(words, w)
+			}
+		}
+
+		return words, nil
+	},
+
+	// agent asks the word detector to choose interesting words from those
+	// used in the logography layer's transcript.
+	"agent": func(s *ConlangServer, ctx context.Context, ws wordSelection) ([]string, error) {
+		used, err := transcriptWords(s, ctx, ws)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(used) == 0 {
+			return nil, nil
+		}
+
+		chosen, err := s.chooseWordsAgent(ctx, used)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only words in the dictionary have logograms.
+
+		words := make([]string, 0, len(chosen))
+		for _, w := range chosen {
+			if _, ok := ws.g.Dictionary[w]; ok {
+				words = append(words, w)
+			}
+		}
+
+		return words, nil
+	},
+
+	// pinned chooses the words pinned by an operator.
+	"pinned": func(s *ConlangServer, _ context.Context, _ wordSelection) ([]string, error) {
+		return s.pinned.get(), nil
+	},
+}
+
+func transcriptWords(
+	s *ConlangServer,
+	ctx context.Context,
+	ws wordSelection,
+) ([]string, error) {
+	res, err := s.findUsedWords(
+		ctx,
+		ws.g.Dictionary.Copy(),
+		ws.g.Transcript[chat.LogographyLayer].String(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Words, nil
+}
+
+func wordSelectorNames() []string {
+	names := make([]string, 0, len(wordSelectors))
+	for k := range wordSelectors {
+		names = append(names, k)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// selectWords asks each of `strategies`, in order, for words until `count`
+// distinct words are chosen.
+func (s *ConlangServer) selectWords(
+	ctx context.Context,
+	strategies []string,
+	count int,
+	ws wordSelection,
+) (*memory.WordSelection, error) {
+	sel := &memory.WordSelection{
+		Strategies: strategies,
+		Words:      make([]memory.SelectedWord, 0, count),
+	}
+
+	seen := make(map[string]bool)
+
+	for _, name := range strategies {
+		if len(sel.Words) == count {
+			break
+		}
+
+		words, err := wordSelectors[name](s, ctx, ws)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to select words by %s", name)
+		}
+
+		for _, w := range words {
+			if len(sel.Words) == count {
+				break
+			}
+
+			if w == "" || seen[w] {
+				continue
+			}
+
+			seen[w] = true
+			sel.Words = append(sel.Words, memory.SelectedWord{Word: w, Strategy: name})
+		}
+	}
+
+	return sel, nil
+}
+
+// countWords counts how many times each word of `dict` is used in `text`.
+// Words that are not used are left out.
+func countWords(dict memory.DictionaryGeneration, text string) map[string]int {
+	var (
+		counts    = make(map[string]int)
+		textLower = strings.ToLower(text)
+	)
+
+	for _, v := range dict {
+		pattern := fmt.Sprintf(`\b%s\b`, regexp.QuoteMeta(strings.ToLower(v.Word)))
+
+		n := len(regexp.MustCompile(pattern).FindAllStringIndex(textLower, -1))
+		if n > 0 {
+			counts[v.Word] = n
+		}
+	}
+
+	return counts
+}
+
+// lastIterated returns, for each word whose logogram changed over `history`,
+// the index of the last generation that changed it.
+func lastIterated(history []memory.Generation) map[string]int {
+	changed := make(map[string]int)
+
+	for i := 1; i < len(history); i++ {
+		for w, svg := range history[i].Logography {
+			if history[i-1].Logography[w] != svg {
+				changed[w] = i
+			}
+		}
+	}
+
+	return changed
+}
+
+// chooseWordsAgent asks the word detector to choose interesting words from
+// `candidates`.
+func (s *ConlangServer) chooseWordsAgent(
+	ctx context.Context,
+	candidates []string,
+) ([]string, error) {
+	reply, chooser, err := s.ask(ctx, systemRequest{
+		role: agent.CapabilityWordDetector,
+		prepare: func(ctx context.Context, c *network.ChatClient) error {
+			err := s.swc(ctx, s.cmd(agent.Latch)(c))
+			if err != nil {
+				return err
+			}
+
+			err = s.swc(
+				ctx,
+				s.cmd(agent.SetInstructions, agent.ServiceChooseInterestingWordsFromText)(c),
+			)
+			if err != nil {
+				return err
+			}
+
+			return s.swc(ctx, s.cmd(agent.Unlatch)(c))
+		},
+		request: s.cmd(
+			agent.RequestDictionaryWordDetection,
+			strings.Join(candidates, ", "),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res memory.ResponseDictionaryWordsDetection
+
+	err = json.Unmarshal([]byte(reply.Text), &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal chosen words")
+	}
+
+	err = s.resetAgent(ctx, chooser)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Words, nil
+}
+
+// pinnedWords are the words an operator pinned for the `pinned` strategy.
+type pinnedWords struct {
+	mu    sync.Mutex
+	words []string
+}
+
+func (p *pinnedWords) get() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.words)
+}
+
+func (p *pinnedWords) set(words []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.words = slices.Clone(words)
+}
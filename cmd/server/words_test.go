@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+	"codeberg.org/n30w/jasima/pkg/network"
+	"codeberg.org/n30w/jasima/pkg/utils"
+
+	"github.com/charmbracelet/log"
+)
+
+// dictionary builds a dictionary of `words`.
+func dictionary(words ...string) memory.DictionaryGeneration {
+	d := make(memory.DictionaryGeneration)
+
+	for _, w := range words {
+		var e memory.DictionaryEntry
+		e.Word = w
+		d[w] = e
+	}
+
+	return d
+}
+
+// selected returns the words of `sel` and the strategies that chose them.
+func selected(sel *memory.WordSelection) ([]string, []string) {
+	var words, strategies []string
+
+	for _, w := range sel.Words {
+		words = append(words, w.Word)
+		strategies = append(strategies, w.Strategy)
+	}
+
+	return words, strategies
+}
+
+func TestSelectWords(t *testing.T) {
+	var (
+		g = &memory.Generation{
+			Dictionary: dictionary("toki", "pona", "suli", "ike"),
+			Transcript: memory.TranscriptGeneration{
+				chat.PhoneticsLayer: {{Text: "toki pona li pona. toki suli"}},
+				chat.GrammarLayer:   {{Text: "pona"}},
+			},
+		}
+
+		// The logogram of "ike" changed in generation 1, and that of
+		// "toki" in generation 2.
+		history = []memory.Generation{
+			{Logography: memory.LogographyGeneration{"toki": "a", "ike": "a"}},
+			{Logography: memory.LogographyGeneration{"toki": "a", "ike": "b"}},
+			{Logography: memory.LogographyGeneration{"toki": "b", "ike": "b"}},
+		}
+	)
+
+	s := &ConlangServer{}
+	s.pinned.set([]string{"suli", "toki"})
+
+	tests := []struct {
+		name           string
+		strategies     []string
+		count          int
+		history        []memory.Generation
+		wantWords      []string
+		wantStrategies []string
+	}{
+		{
+			name:           "most frequent",
+			strategies:     []string{"most-frequent"},
+			count:          2,
+			wantWords:      []string{"pona", "toki"},
+			wantStrategies: []string{"most-frequent", "most-frequent"},
+		},
+		{
+			name:           "least recently iterated",
+			strategies:     []string{"least-recently-iterated"},
+			count:          4,
+			history:        history,
+			wantWords:      []string{"pona", "suli", "ike", "toki"},
+			wantStrategies: slices.Repeat([]string{"least-recently-iterated"}, 4),
+		},
+		{
+			name:           "never iterated",
+			strategies:     []string{"never-iterated"},
+			count:          4,
+			history:        history,
+			wantWords:      []string{"pona", "suli"},
+			wantStrategies: []string{"never-iterated", "never-iterated"},
+		},
+		{
+			name:       "new words",
+			strategies: []string{"new-words"},
+			count:      4,
+			history: []memory.Generation{
+				{Dictionary: dictionary("toki", "pona")},
+			},
+			wantWords:      []string{"ike", "suli"},
+			wantStrategies: []string{"new-words", "new-words"},
+		},
+		{
+			name:       "no new words without history",
+			strategies: []string{"new-words"},
+			count:      4,
+		},
+		{
+			name:           "later strategies fill up without repeating words",
+			strategies:     []string{"pinned", "most-frequent"},
+			count:          3,
+			wantWords:      []string{"suli", "toki", "pona"},
+			wantStrategies: []string{"pinned", "pinned", "most-frequent"},
+		},
+		{
+			name:           "earlier strategies that choose enough",
+			strategies:     []string{"pinned", "most-frequent"},
+			count:          1,
+			wantWords:      []string{"suli"},
+			wantStrategies: []string{"pinned"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := s.selectWords(
+				context.Background(),
+				tt.strategies,
+				tt.count,
+				wordSelection{g: g, history: tt.history},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			words, strategies := selected(sel)
+
+			if !slices.Equal(words, tt.wantWords) {
+				t.Errorf("selected %v, want %v", words, tt.wantWords)
+			}
+
+			if !slices.Equal(strategies, tt.wantStrategies) {
+				t.Errorf("selected by %v, want %v", strategies, tt.wantStrategies)
+			}
+		})
+	}
+}
+
+func TestIterateLogograms_selection(t *testing.T) {
+	gs, err := network.NewChatServer(log.New(io.Discard), make(chan error, 10), network.WithPort("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generations, err := utils.NewDynamicFixedQueue[memory.Generation](4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &ConlangServer{
+		logger:      log.New(io.Discard),
+		gs:          gs,
+		config:      &config{},
+		generations: generations,
+		run:         newRunControl(0, nil),
+	}
+
+	var (
+		g   = &memory.Generation{Logography: make(memory.LogographyGeneration)}
+		job = s.iterateLogograms(nil, 1, []string{"never-iterated"}, 0, g)
+	)
+
+	// The job is built once and run for every generation, each of which
+	// must choose its own words. There are no agents to iterate on them,
+	// so the job fails once it has chosen.
+
+	for _, word := range []string{"toki", "pona"} {
+		g.Dictionary = dictionary(word)
+
+		_ = job(context.Background())
+
+		words, strategies := selected(g.WordSelection)
+
+		if !slices.Equal(words, []string{word}) ||
+			!slices.Equal(strategies, []string{"never-iterated"}) {
+			t.Errorf("selected %v by %v, want %s by never-iterated", words, strategies, word)
+		}
+	}
+}
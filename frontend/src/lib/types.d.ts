@@ -3,6 +3,14 @@ type Message = {
 	timestamp: string;
 	sender: string;
 	command: number;
+	// 2 when a moderator sent the message.
+	role?: number;
+};
+
+// Sent to `POST /chat/moderator` to steer a layer conversation.
+type ModeratorMessage = {
+	layer: string;
+	content: string;
 };
 
 type DictionaryEntry = {
@@ -21,6 +29,57 @@ type Generation = {
 	logography: Map<string, string>;
 	specifications: Map<number, string>;
 	dictionary: Dictionary;
+	changes?: Map<number, SpecificationChange>;
+	fitness?: Fitness;
+};
+
+type CandidateFitness = {
+	score: number;
+	scores: Record<string, number>;
+	reason?: string;
+};
+
+type Fitness = {
+	selection: string;
+	selected: number;
+	candidates: CandidateFitness[];
+};
+
+type DiffLine = {
+	op: '+' | '-';
+	line: number;
+	section: string;
+	text: string;
+};
+
+type SpecificationChange = {
+	layer: string;
+	explanation: string;
+	sections: string[];
+	diff: DiffLine[];
+};
+
+type Redefinition = {
+	word: string;
+	from: string;
+	to: string;
+};
+
+type TranscriptStats = {
+	messages: number;
+	speakers: number;
+	words: number;
+};
+
+type GenerationDiff = {
+	words: {
+		added: DictionaryEntry[];
+		removed: DictionaryEntry[];
+		redefined: Redefinition[];
+	};
+	logograms: string[];
+	specifications: Record<number, SpecificationChange>;
+	transcripts: Record<number, { from: TranscriptStats; to: TranscriptStats }>;
 };
 
 type UsedWords = {
@@ -40,6 +99,9 @@ interface agentLogogramGeneratorResp extends agentLogogramIterResponse {
 }
 
 type LogogramIteration = {
+	word: string;
+	exchange: number;
+	done: boolean;
 	generator: agentLogogramGeneratorResp;
 	adversary: agentLogogramAdversaryResp;
 };
@@ -0,0 +1,53 @@
+package agent
+
+// Capability defines a role an agent declares it is able to fulfill when it
+// registers with the server. Procedures use capabilities to pick which agent
+// to send a request to, rather than relying on an agent's name. The server
+// only takes replies to its requests from agents on the system layer, so
+// every capability requires it.
+type Capability string
+
+const (
+	// CapabilitySpecificationWriter rewrites a layer's specification from
+	// the transcript of that layer's conversation.
+	CapabilitySpecificationWriter Capability = "specification-writer"
+
+	// CapabilityDictionaryUpdater responds to dictionary update requests.
+	CapabilityDictionaryUpdater Capability = "dictionary-updater"
+
+	// CapabilityWordDetector responds to dictionary word detection requests.
+	CapabilityWordDetector Capability = "word-detector"
+
+	// CapabilityLogogramGenerator iterates on logogram SVGs.
+	CapabilityLogogramGenerator Capability = "logogram-generator"
+
+	// CapabilityLogogramAdversary critiques logogram SVGs.
+	CapabilityLogogramAdversary Capability = "logogram-adversary"
+
+	// CapabilityModerator chooses who speaks next in a layer conversation.
+	CapabilityModerator Capability = "moderator"
+
+	// CapabilityJudge rates candidate generations, so that the fittest may
+	// be selected.
+	CapabilityJudge Capability = "judge"
+)
+
+func (c Capability) String() string {
+	return string(c)
+}
+
+// Valid reports whether the capability is one the server knows about.
+func (c Capability) Valid() bool {
+	switch c {
+	case CapabilitySpecificationWriter,
+		CapabilityDictionaryUpdater,
+		CapabilityWordDetector,
+		CapabilityLogogramGenerator,
+		CapabilityLogogramAdversary,
+		CapabilityModerator,
+		CapabilityJudge:
+		return true
+	default:
+		return false
+	}
+}
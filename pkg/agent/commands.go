@@ -1,5 +1,11 @@
 package agent
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // Command defines integer values that represent server commands.
 // Server commands are sent to clients via messages. Clients must
 // adhere to server commands.
@@ -12,6 +18,15 @@ func (c Command) Int32() int32 {
 const (
 	NoCommand Command = 0
 
+	// Register is sent by a client as its first message. The body of the
+	// message contains the client's registration.
+	Register Command = 1
+
+	// Acknowledge is sent by a client after it has carried out a command
+	// that changes its state. The body of the message contains the
+	// client's resulting state.
+	Acknowledge Command = 6
+
 	// AppendInstructions appends additional initial instructions
 	// for an LLM model.
 	AppendInstructions Command = 2
@@ -35,6 +50,21 @@ func (c Command) Int32() int32 {
 
 	RequestDictionaryWordDetection Command = 25
 
+	// RequestNextSpeaker asks a moderator to choose who speaks next in a
+	// layer conversation.
+	RequestNextSpeaker Command = 26
+
+	// RequestConvergence asks a moderator whether a layer conversation has
+	// converged, and may end.
+	RequestConvergence Command = 27
+
+	// RequestSpecificationUpdate asks a specification writer for a revised
+	// specification, and an explanation of what it changed.
+	RequestSpecificationUpdate Command = 28
+
+	// RequestFitness asks a judge to rate a candidate generation.
+	RequestFitness Command = 29
+
 	// Latch requires a client go into `latch` mode.
 	Latch Command = 10
 
@@ -43,12 +73,19 @@ func (c Command) Int32() int32 {
 
 	// ClearMemory requires a client to clear its entire memory.
 	ClearMemory Command = -20
+
+	// Heartbeat is sent by a client to tell the server it is alive.
+	Heartbeat Command = -30
 )
 
 func (c Command) String() string {
 	switch c {
 	case NoCommand:
 		return "NO_COMMAND"
+	case Register:
+		return "REGISTER"
+	case Acknowledge:
+		return "ACKNOWLEDGE"
 	case AppendInstructions:
 		return "APPEND_INSTRUCTIONS"
 	case SetInstructions:
@@ -65,13 +102,87 @@ func (c Command) String() string {
 		return "REQUEST_LOGOGRAM_CRITIQUE"
 	case RequestDictionaryWordDetection:
 		return "REQUEST_DICTIONARY_WORD_DETECTION"
+	case RequestNextSpeaker:
+		return "REQUEST_NEXT_SPEAKER"
+	case RequestConvergence:
+		return "REQUEST_CONVERGENCE"
+	case RequestSpecificationUpdate:
+		return "REQUEST_SPECIFICATION_UPDATE"
+	case RequestFitness:
+		return "REQUEST_FITNESS"
 	case Latch:
 		return "LATCH"
 	case Unlatch:
 		return "UNLATCH"
 	case ClearMemory:
 		return "CLEAR_MEMORY"
+	case Heartbeat:
+		return "HEARTBEAT"
 	default:
 		return "UNKNOWN COMMAND"
 	}
 }
+
+// RequiresAck reports whether a client must acknowledge the command once it
+// has been carried out. Commands that change the state of a client require
+// an acknowledgement. Requests do not, since their response is the reply.
+func (c Command) RequiresAck() bool {
+	switch c {
+	case AppendInstructions,
+		SetInstructions,
+		ResetInstructions,
+		Latch,
+		Unlatch,
+		ClearMemory:
+		return true
+	default:
+		return false
+	}
+}
+
+// commands lists every known command, so that they can be looked up by name.
+var commands = []Command{
+	NoCommand,
+	Register,
+	Acknowledge,
+	AppendInstructions,
+	SetInstructions,
+	ResetInstructions,
+	SendInitialMessage,
+	RequestJsonDictionaryUpdate,
+	RequestLogogramIteration,
+	RequestLogogramCritique,
+	RequestDictionaryWordDetection,
+	RequestNextSpeaker,
+	RequestConvergence,
+	RequestSpecificationUpdate,
+	RequestFitness,
+	Latch,
+	Unlatch,
+	ClearMemory,
+	Heartbeat,
+}
+
+// ParseCommand reads a command from either its name, as returned by
+// `String`, or its integer value. Names are case-insensitive and may use
+// dashes in place of underscores.
+func ParseCommand(s string) (Command, error) {
+	name := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(s), "-", "_"))
+
+	for _, c := range commands {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err == nil {
+		for _, c := range commands {
+			if c == Command(n) {
+				return c, nil
+			}
+		}
+	}
+
+	return NoCommand, fmt.Errorf("unknown command %q", s)
+}
@@ -2,7 +2,7 @@
 
 const (
 	DefaultAgentInstructions             = `You are in conversation with another large language model. This is a natural conversation. Don't talk in bullet points. Don't talk like an LLM. Length of text is up to your discretion. Don't be too agreeable, be reasonable. Your conversational exchange does not need to be back and forth. You can let the other speaker know that you'll listen to what they'll have to say. Your job is to further develop the assigned aspect of the Toki Pona language. You may include proposals or provide critique based on your interlocutor's input. Think outside the box; Toki Pona learners are also other LLMs, models, and may be extrasensory. Furthermore, do not consider about future learners or ease of use. Markdown in your responses does not need to be surrounded by three backticks. Simply write markdown. Consider speaking with your interlocutor in the language too, to get a feel for it perhaps. Let them know if you'd like to switch.`
-	SpecificationUpdateInstructions      = `You are in charge of contributing to the Toki Pona language specification. More specifically you must read the following conversation between some interlocutors and also read the current specification included in this chat. You must then write a new specification based on the old one and the given conversation. Reply with and ONLY with the revised specification. Reply using Markdown, however, it should NOT start and end with three backticks.`
+	SpecificationUpdateInstructions      = `You are in charge of contributing to the Toki Pona language specification. More specifically you must read the following conversation between some interlocutors and also read the current specification included in this chat. You must then write a new specification based on the old one and the given conversation. Reply with a JSON object of this schema: { 'specification': string, 'explanation': string }. The specification is the whole revised specification, written in Markdown, however, it should NOT start and end with three backticks. The explanation says what you changed in the specification and why.`
 	DictionaryUpdateInstructions         = `Given this toki pona dictionary, reply with and only with a JSON array of objects that include only the updates to dictionary entries. In other words, send back an array of JSON objects with entries that are changed or added. If a word should be removed, set the remove attribute to true. Otherwise, set it to false. The user will begin the chat with a chat log between interlocutors that you must read to make decisions related to addition, removal, or updating. Please, do NOT format your JSON in a pretty way. Instead, the response should be a compact, long string of JSON with no new lines, machine readable first and foremost. Also, if you are to quote something in a string, use single quotation marks only since JSON keys use double quotations. Here is the json schema: {'word': string, 'definition': string, 'remove': boolean}`
 	DictionaryWordExtractionInstructions = `Given this toki pona dictionary, please extract the individual words that were used in the user provided text that are also in the dictionary. You will respond with a JSON object of this schema: { 'words': string[] }. The words array contains words that exist in both the dictionary and the submitted text. This array should only include the word's name and nothing related to its definition or anything like that. You do not need to format the JSON, simply make it machine readable.`
 
@@ -0,0 +1,180 @@
+// Package book renders the language of a generation for people to read: as a
+// Markdown or HTML document, and as a lexicon that linguistics tools import.
+package book
+
+import (
+	"encoding/base64"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+)
+
+// LanguageCode is the language tag of the conlang in lexicons. It is in the
+// range ISO 639 reserves for local use.
+const LanguageCode = "qaa"
+
+// Book is the language of a generation of a run.
+type Book struct {
+	Title string
+
+	// Number is the number of the generation in its run.
+	Number     int
+	Generation memory.Generation
+
+	// History are how the specifications changed in the generations of the
+	// run up to the book's, in order.
+	History []Revision
+}
+
+// Revision is how the specifications changed in a generation.
+type Revision struct {
+	Number  int
+	Changes []memory.SpecificationChange
+}
+
+// Entry is a word of the dictionary.
+type Entry struct {
+	Word       string
+	Definition string
+
+	// Logogram is the SVG of the word's logogram. It is empty when the word
+	// has none.
+	Logogram string
+}
+
+// Specification is the specification of a layer.
+type Specification struct {
+	Layer chat.Layer
+	Text  string
+}
+
+// Conversation is what was said on a layer while the generation evolved.
+type Conversation struct {
+	Layer    chat.Layer
+	Messages memory.TranscriptMessages
+}
+
+// New makes the book of the last generation of `gens`, a run whose first
+// generation is generation `first`.
+func New(title string, gens []memory.Generation, first int) Book {
+	b := Book{
+		Title:      title,
+		Number:     first + len(gens) - 1,
+		Generation: gens[len(gens)-1],
+	}
+
+	for i, g := range gens {
+		if len(g.Changes) == 0 {
+			continue
+		}
+
+		r := Revision{Number: first + i}
+
+		for _, l := range slices.Sorted(maps.Keys(g.Changes)) {
+			r.Changes = append(r.Changes, g.Changes[l])
+		}
+
+		b.History = append(b.History, r)
+	}
+
+	return b
+}
+
+// Dictionary returns the words of the generation in alphabetical order.
+func (b Book) Dictionary() []Entry {
+	entries := make([]Entry, 0, len(b.Generation.Dictionary))
+
+	for w, e := range b.Generation.Dictionary {
+		if w == "" {
+			continue
+		}
+
+		// The logography is updated as logograms are iterated on, so it
+		// is preferred over the logogram the entry was made with.
+
+		logogram := b.Generation.Logography[w]
+		if logogram == "" {
+			logogram = e.Logogram
+		}
+
+		entries = append(entries, Entry{
+			Word:       w,
+			Definition: e.Definition,
+			Logogram:   logogram,
+		})
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		if c := strings.Compare(strings.ToLower(a.Word), strings.ToLower(b.Word)); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Word, b.Word)
+	})
+
+	return entries
+}
+
+// Specifications returns the specifications of the generation in layer
+// order. Empty specifications are left out.
+func (b Book) Specifications() []Specification {
+	specs := make([]Specification, 0, len(b.Generation.Specifications))
+
+	for _, l := range slices.Sorted(maps.Keys(b.Generation.Specifications)) {
+		text := b.Generation.Specifications[l].String()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		specs = append(specs, Specification{Layer: l, Text: text})
+	}
+
+	return specs
+}
+
+// Conversations returns the conversations of the generation in layer order.
+// Layers nothing was said on are left out.
+func (b Book) Conversations() []Conversation {
+	var convs []Conversation
+
+	for _, l := range slices.Sorted(maps.Keys(b.Generation.Transcript)) {
+		if len(b.Generation.Transcript[l]) == 0 {
+			continue
+		}
+
+		convs = append(convs, Conversation{
+			Layer:    l,
+			Messages: b.Generation.Transcript[l],
+		})
+	}
+
+	return convs
+}
+
+// Format is a way to write a book.
+type Format struct {
+	// Name is the start of the names of the files in the format, either
+	// "book" or "lexicon".
+	Name      string
+	Extension string
+	Write     func(w io.Writer, b Book) error
+}
+
+// Formats are the formats a book can be written in, by name.
+var Formats = map[string]Format{
+	"markdown": {Name: "book", Extension: ".md", Write: Markdown},
+	"html":     {Name: "book", Extension: ".html", Write: HTML},
+	"csv":      {Name: "lexicon", Extension: ".csv", Write: CSV},
+	"lift":     {Name: "lexicon", Extension: ".lift", Write: LIFT},
+	"tei":      {Name: "lexicon", Extension: ".tei.xml", Write: TEI},
+}
+
+// dataURI embeds an SVG in a document as an image. Logograms are drawn by
+// models, so they are never embedded as markup that could run scripts.
+func dataURI(svg string) string {
+	return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg))
+}
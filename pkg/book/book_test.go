@@ -0,0 +1,127 @@
+package book
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+	"codeberg.org/n30w/jasima/pkg/memory"
+)
+
+func testBook(t *testing.T) Book {
+	t.Helper()
+
+	var dict memory.DictionaryGeneration
+
+	err := json.Unmarshal([]byte(`[
+		{"word": "toki", "definition": "speech, language", "logogram": "<svg>old</svg>"},
+		{"word": "Akesi", "definition": "animal"},
+		{"word": "li", "definition": "marks the predicate"}
+	]`), &dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gens := []memory.Generation{
+		{},
+		{
+			Dictionary: dict,
+			Logography: memory.LogographyGeneration{"toki": "<svg>new</svg>"},
+			Specifications: memory.SpecificationGeneration{
+				chat.GrammarLayer:   "# Verbs\nli marks <the> predicate.\n",
+				chat.PhoneticsLayer: "Nine consonants.",
+			},
+			Changes: memory.SpecificationChanges{
+				chat.GrammarLayer: {Layer: chat.GrammarLayer, Explanation: "Clarified li."},
+			},
+		},
+	}
+
+	return New("Test", gens, 4)
+}
+
+func TestBook_Dictionary(t *testing.T) {
+	b := testBook(t)
+
+	if b.Number != 5 {
+		t.Errorf("New() number = %d, want 5", b.Number)
+	}
+
+	if len(b.History) != 1 || b.History[0].Number != 5 {
+		t.Errorf("New() history = %v, want generation 5", b.History)
+	}
+
+	var words []string
+	for _, e := range b.Dictionary() {
+		words = append(words, e.Word)
+	}
+
+	if got, want := strings.Join(words, ","), "Akesi,li,toki"; got != want {
+		t.Errorf("Dictionary() words = %s, want %s", got, want)
+	}
+
+	if got := b.Dictionary()[2].Logogram; got != "<svg>new</svg>" {
+		t.Errorf("Dictionary() logogram = %s, want the logography's", got)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	b := testBook(t)
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{
+			format: "markdown",
+			want:   []string{"## Phonetics", "### Verbs", "### toki", "#### Grammar\n\nClarified li."},
+		},
+		{
+			format: "html",
+			want:   []string{"<h3>Verbs</h3>", "li marks &lt;the&gt; predicate.", `<img src="data:image/svg`},
+		},
+		{
+			format: "csv",
+			want:   []string{"word,definition\nAkesi,animal\n", `toki,"speech, language"`},
+		},
+		{
+			format: "lift",
+			want:   []string{`<lift version="0.13"`, `<form lang="qaa">`},
+		},
+		{
+			format: "tei",
+			want:   []string{`<TEI xmlns="http://www.tei-c.org/ns/1.0">`, "<orth>li</orth>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			err := Formats[tt.format].Write(&buf, b)
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			for _, w := range tt.want {
+				if !strings.Contains(buf.String(), w) {
+					t.Errorf("Write() = %s, want it to contain %q", buf.String(), w)
+				}
+			}
+
+			if strings.Contains(buf.String(), "<svg>") {
+				t.Errorf("Write() embeds a logogram as markup")
+			}
+
+			if tt.format == "lift" || tt.format == "tei" {
+				err = xml.Unmarshal(buf.Bytes(), new(struct{}))
+				if err != nil {
+					t.Errorf("Write() is not well-formed XML: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package book
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var page = template.Must(template.New("book").Funcs(template.FuncMap{
+	"title":      title,
+	"capitalize": capitalize,
+	"markdown":   markdownHTML,
+	"image": func(svg string) template.URL {
+		return template.URL(dataURI(svg))
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ title . }}</title>
+<style>
+body { font-family: serif; max-width: 48em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+nav ul { columns: 2; }
+dl.lexicon dt { font-weight: bold; margin-top: 1em; }
+dl.lexicon img { width: 4em; height: 4em; vertical-align: middle; margin-right: 0.5em; }
+.message { margin: 0.5em 0; }
+.sender { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{ title . }}</h1>
+<p>Generation {{ .Number }}.</p>
+<nav>
+<ul>
+{{- range .Specifications }}
+<li><a href="#{{ .Layer }}">{{ capitalize .Layer.String }}</a></li>
+{{- end }}
+<li><a href="#lexicon">Lexicon</a></li>
+{{- if .Conversations }}
+<li><a href="#conversations">Conversations</a></li>
+{{- end }}
+{{- if .History }}
+<li><a href="#changes">Changes</a></li>
+{{- end }}
+</ul>
+</nav>
+{{- range .Specifications }}
+<section id="{{ .Layer }}">
+<h2>{{ capitalize .Layer.String }}</h2>
+{{ markdown .Text }}
+</section>
+{{- end }}
+<section id="lexicon">
+<h2>Lexicon</h2>
+<dl class="lexicon">
+{{- range .Dictionary }}
+<dt id="word-{{ .Word }}">{{ if .Logogram }}<img src="{{ image .Logogram }}" alt="">{{ end }}{{ .Word }}</dt>
+<dd>{{ .Definition }}</dd>
+{{- end }}
+</dl>
+</section>
+{{- with .Conversations }}
+<section id="conversations">
+<h2>Appendix: Conversations</h2>
+{{- range . }}
+<h3>{{ capitalize .Layer.String }}</h3>
+{{- range .Messages }}
+<p class="message"><span class="sender">{{ .Sender }}</span>: {{ .Text }}</p>
+{{- end }}
+{{- end }}
+</section>
+{{- end }}
+{{- with .History }}
+<section id="changes">
+<h2>Appendix: Changes</h2>
+{{- range . }}
+<h3>Generation {{ .Number }}</h3>
+{{- range .Changes }}
+<h4>{{ capitalize .Layer.String }}</h4>
+<p>{{ .Explanation }}</p>
+{{- end }}
+{{- end }}
+</section>
+{{- end }}
+</body>
+</html>
+`))
+
+// HTML writes the book as a single HTML document.
+func HTML(w io.Writer, b Book) error {
+	return page.Execute(w, b)
+}
+
+var (
+	listItem    = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+`)
+	orderedItem = regexp.MustCompile(`^\s*\d+[.)]\s+`)
+)
+
+// markdownHTML renders the headings, lists, code blocks and paragraphs of
+// Markdown document `md` as HTML. Everything else is left as text. Headings
+// are moved two levels down, below the heading of the layer.
+func markdownHTML(md string) template.HTML {
+	var (
+		sb   strings.Builder
+		para []string
+		list string
+		code bool
+	)
+
+	flush := func() {
+		if len(para) > 0 {
+			sb.WriteString("<p>" + strings.Join(para, "\n") + "</p>\n")
+			para = nil
+		}
+
+		if list != "" {
+			sb.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+
+	for _, l := range strings.Split(md, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(l), "```") {
+			flush()
+
+			if code {
+				sb.WriteString("</code></pre>\n")
+			} else {
+				sb.WriteString("<pre><code>")
+			}
+
+			code = !code
+
+			continue
+		}
+
+		if code {
+			sb.WriteString(html.EscapeString(l) + "\n")
+			continue
+		}
+
+		level := len(l) - len(strings.TrimLeft(l, "#"))
+
+		switch {
+		case strings.TrimSpace(l) == "":
+			flush()
+		case level > 0 && strings.HasPrefix(l[level:], " "):
+			flush()
+
+			n := min(level+2, 6)
+
+			sb.WriteString(fmt.Sprintf(
+				"<h%d>%s</h%d>\n",
+				n,
+				html.EscapeString(strings.TrimSpace(l[level:])),
+				n,
+			))
+		case listItem.MatchString(l):
+			kind := "ul"
+			if orderedItem.MatchString(l) {
+				kind = "ol"
+			}
+
+			if len(para) > 0 || list != kind {
+				flush()
+				sb.WriteString("<" + kind + ">\n")
+				list = kind
+			}
+
+			sb.WriteString("<li>" + html.EscapeString(listItem.ReplaceAllString(l, "")) + "</li>\n")
+		default:
+			if list != "" {
+				flush()
+			}
+
+			para = append(para, html.EscapeString(strings.TrimSpace(l)))
+		}
+	}
+
+	if code {
+		sb.WriteString("</code></pre>\n")
+	}
+
+	flush()
+
+	return template.HTML(sb.String())
+}
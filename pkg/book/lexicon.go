@@ -0,0 +1,120 @@
+package book
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// CSV writes the dictionary of the book as CSV, with a header row.
+func CSV(w io.Writer, b Book) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"word", "definition"})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range b.Dictionary() {
+		err = cw.Write([]string{e.Word, e.Definition})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+type liftDocument struct {
+	XMLName  xml.Name    `xml:"lift"`
+	Version  string      `xml:"version,attr"`
+	Producer string      `xml:"producer,attr"`
+	Entries  []liftEntry `xml:"entry"`
+}
+
+type liftEntry struct {
+	ID          string    `xml:"id,attr"`
+	LexicalUnit liftForm  `xml:"lexical-unit>form"`
+	Sense       liftSense `xml:"sense"`
+}
+
+type liftSense struct {
+	ID         string   `xml:"id,attr"`
+	Definition liftForm `xml:"definition>form"`
+}
+
+type liftForm struct {
+	Lang string `xml:"lang,attr"`
+	Text string `xml:"text"`
+}
+
+// LIFT writes the dictionary of the book in the Lexicon Interchange Format,
+// version 0.13.
+func LIFT(w io.Writer, b Book) error {
+	doc := liftDocument{Version: "0.13", Producer: "jasima"}
+
+	for _, e := range b.Dictionary() {
+		doc.Entries = append(doc.Entries, liftEntry{
+			ID:          e.Word,
+			LexicalUnit: liftForm{Lang: LanguageCode, Text: e.Word},
+			Sense: liftSense{
+				ID:         e.Word + "_1",
+				Definition: liftForm{Lang: "en", Text: e.Definition},
+			},
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+type teiDocument struct {
+	XMLName     xml.Name   `xml:"http://www.tei-c.org/ns/1.0 TEI"`
+	Title       string     `xml:"teiHeader>fileDesc>titleStmt>title"`
+	Edition     string     `xml:"teiHeader>fileDesc>editionStmt>edition"`
+	Publication string     `xml:"teiHeader>fileDesc>publicationStmt>p"`
+	Source      string     `xml:"teiHeader>fileDesc>sourceDesc>p"`
+	Entries     []teiEntry `xml:"text>body>entry"`
+}
+
+type teiEntry struct {
+	Orth string `xml:"form>orth"`
+	Def  string `xml:"sense>def"`
+}
+
+// TEI writes the dictionary of the book as a TEI P5 dictionary.
+func TEI(w io.Writer, b Book) error {
+	doc := teiDocument{
+		Title:       title(b),
+		Edition:     fmt.Sprintf("Generation %d", b.Number),
+		Publication: "Unpublished.",
+		Source:      "Evolved by jasima.",
+	}
+
+	for _, e := range b.Dictionary() {
+		doc.Entries = append(doc.Entries, teiEntry{Orth: e.Word, Def: e.Definition})
+	}
+
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	err = enc.Encode(doc)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+
+	return err
+}
@@ -0,0 +1,98 @@
+package book
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Markdown writes the book as a single Markdown document.
+func Markdown(w io.Writer, b Book) error {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# %s\n\nGeneration %d.\n", title(b), b.Number))
+
+	for _, s := range b.Specifications() {
+		sb.WriteString(fmt.Sprintf("\n## %s\n\n", capitalize(s.Layer.String())))
+		sb.WriteString(demote(s.Text, 2))
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n## Lexicon\n")
+
+	for _, e := range b.Dictionary() {
+		sb.WriteString(fmt.Sprintf("\n### %s\n\n", e.Word))
+
+		if e.Logogram != "" {
+			sb.WriteString(fmt.Sprintf("![%s](%s)\n\n", e.Word, dataURI(e.Logogram)))
+		}
+
+		sb.WriteString(e.Definition + "\n")
+	}
+
+	if convs := b.Conversations(); len(convs) > 0 {
+		sb.WriteString("\n## Appendix: Conversations\n")
+
+		for _, c := range convs {
+			sb.WriteString(fmt.Sprintf("\n### %s\n\n", capitalize(c.Layer.String())))
+
+			for _, m := range c.Messages {
+				sb.WriteString(fmt.Sprintf("**%s**: %s\n\n", m.Sender, m.Text))
+			}
+		}
+	}
+
+	if len(b.History) > 0 {
+		sb.WriteString("\n## Appendix: Changes\n")
+
+		for _, r := range b.History {
+			sb.WriteString(fmt.Sprintf("\n### Generation %d\n", r.Number))
+
+			for _, c := range r.Changes {
+				sb.WriteString(fmt.Sprintf(
+					"\n#### %s\n\n%s\n",
+					capitalize(c.Layer.String()),
+					c.Explanation,
+				))
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+// demote moves the headings of Markdown document `md` `by` levels down, so
+// that it can be a section of another document. Headings go no lower than
+// level 6.
+func demote(md string, by int) string {
+	lines := strings.Split(strings.TrimRight(md, "\n"), "\n")
+
+	for i, l := range lines {
+		level := len(l) - len(strings.TrimLeft(l, "#"))
+		if level == 0 || !strings.HasPrefix(l[level:], " ") {
+			continue
+		}
+
+		lines[i] = strings.Repeat("#", min(level+by, 6)) + l[level:]
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func title(b Book) string {
+	if b.Title == "" {
+		return "Language Book"
+	}
+
+	return b.Title
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+
+	return strings.ToUpper(s[:1]) + s[1:]
+}
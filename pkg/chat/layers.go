@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MinCustomLayer is the lowest value a custom layer may have. Values below it
+// are reserved for built-in layers.
+const MinCustomLayer Layer = 16
+
+// customLayers are the layers registered with `RegisterLayer`.
+var customLayers = struct {
+	sync.RWMutex
+	names  map[Layer]string
+	layers map[string]Layer
+}{
+	names:  make(map[Layer]string),
+	layers: make(map[string]Layer),
+}
+
+// RegisterLayer defines a custom layer `l` called `name`. Once registered, the
+// layer is known everywhere a built-in layer is, and is written to and read
+// from JSON by its name.
+func RegisterLayer(l Layer, name string) error {
+	if l < MinCustomLayer {
+		return fmt.Errorf(
+			"custom layer %s must be at least %d, got %d",
+			name,
+			MinCustomLayer,
+			l,
+		)
+	}
+
+	if name == "" {
+		return fmt.Errorf("custom layer %d requires a name", l)
+	}
+
+	if _, err := parseBuiltinLayer(name); err == nil {
+		return fmt.Errorf("layer %s is built in", name)
+	}
+
+	customLayers.Lock()
+	defer customLayers.Unlock()
+
+	if v, ok := customLayers.names[l]; ok && v != name {
+		return fmt.Errorf("layer %d is already registered as %s", l, v)
+	}
+
+	if v, ok := customLayers.layers[name]; ok && v != l {
+		return fmt.Errorf("layer %s is already registered as %d", name, v)
+	}
+
+	customLayers.names[l] = name
+	customLayers.layers[name] = l
+
+	return nil
+}
+
+// Known reports whether `l` is a built-in or registered layer.
+func (l Layer) Known() bool {
+	if l >= SystemLayer && l < UnknownLayer {
+		return true
+	}
+
+	_, ok := customLayerName(l)
+
+	return ok
+}
+
+// Custom reports whether `l` is in the range of custom layers.
+func (l Layer) Custom() bool {
+	return l >= MinCustomLayer
+}
+
+func customLayerName(l Layer) (string, bool) {
+	customLayers.RLock()
+	defer customLayers.RUnlock()
+
+	name, ok := customLayers.names[l]
+
+	return name, ok
+}
+
+func parseCustomLayer(name string) (Layer, bool) {
+	customLayers.RLock()
+	defer customLayers.RUnlock()
+
+	l, ok := customLayers.layers[name]
+
+	return l, ok
+}
@@ -0,0 +1,97 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRegisterLayer(t *testing.T) {
+	const morphology = MinCustomLayer + 1
+
+	err := RegisterLayer(morphology, "morphology")
+	if err != nil {
+		t.Fatalf("RegisterLayer() error = %v", err)
+	}
+
+	// Registering the same layer twice is harmless.
+
+	err = RegisterLayer(morphology, "morphology")
+	if err != nil {
+		t.Fatalf("RegisterLayer() twice error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		layer Layer
+		lname string
+	}{
+		{"below custom range", UnknownLayer, "numerals"},
+		{"built-in name", MinCustomLayer + 2, "grammar"},
+		{"empty name", MinCustomLayer + 3, ""},
+		{"taken value", morphology, "pragmatics"},
+		{"taken name", MinCustomLayer + 4, "morphology"},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				err := RegisterLayer(tt.layer, tt.lname)
+				if err == nil {
+					t.Errorf("RegisterLayer(%d, %q) expected error", tt.layer, tt.lname)
+				}
+			},
+		)
+	}
+
+	if !morphology.Known() || (MinCustomLayer + 5).Known() {
+		t.Errorf("Known() only reports registered custom layers")
+	}
+
+	if got := morphology.String(); got != "morphology" {
+		t.Errorf("String() got = %s, want morphology", got)
+	}
+
+	if got := SetLayer(int32(morphology)); got != morphology {
+		t.Errorf("SetLayer() got = %d, want %d", got, morphology)
+	}
+
+	// Custom layers round trip through JSON by name, without changing how
+	// built-in layers are written.
+
+	b, err := json.Marshal([]Layer{GrammarLayer, morphology})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	if string(b) != `["grammar","morphology"]` {
+		t.Errorf("Marshal() got = %s", b)
+	}
+
+	var got []Layer
+
+	err = json.Unmarshal(b, &got)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if got[0] != GrammarLayer || got[1] != morphology {
+		t.Errorf("Unmarshal() got = %v", got)
+	}
+
+	// Processes that have not registered a custom layer still round trip
+	// it, by value.
+
+	unregistered := MinCustomLayer + 6
+
+	b, err = json.Marshal(unregistered)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var l Layer
+
+	err = json.Unmarshal(b, &l)
+	if err != nil || l != unregistered {
+		t.Errorf("Unmarshal(%s) got = %d, %v", b, l, err)
+	}
+}
@@ -0,0 +1,138 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+)
+
+// ProtocolVersion is the version of the agent to server protocol. A server
+// rejects registrations that declare a different version.
+//
+// Version 2 requires agents to acknowledge state changing commands.
+const ProtocolVersion = 2
+
+// Registration is sent by an agent as the body of its first message to the
+// server. It declares who the agent is and what it is able to do.
+type Registration struct {
+	Name  Name  `json:"name"`
+	Layer Layer `json:"layer"`
+
+	// Provider is the LLM service provider of the agent.
+	Provider int32 `json:"provider"`
+
+	// Model is the full name of the model the provider serves.
+	Model string `json:"model"`
+
+	// Temperature and Seed are the defaults the agent requests its model
+	// with.
+	Temperature float64 `json:"temperature"`
+	Seed        int64   `json:"seed"`
+
+	// InstructionHash is a hash of the system instructions the agent
+	// started with.
+	InstructionHash string `json:"instructionHash"`
+
+	// Commands are the server commands the agent responds to.
+	Commands []agent.Command `json:"commands"`
+
+	// Schemas are the names of the typed responses the agent is able to
+	// reply with.
+	Schemas []string `json:"schemas"`
+
+	// Capabilities are the roles the agent is able to fulfill.
+	Capabilities []agent.Capability `json:"capabilities"`
+
+	// Lineage is the lineage of the evolution the agent takes part in. The
+	// main lineage is taken part in when it is empty.
+	Lineage string `json:"lineage,omitempty"`
+
+	// Peers are the agents the agent addresses its messages to.
+	Peers []Name `json:"peers,omitempty"`
+
+	ProtocolVersion int `json:"protocolVersion"`
+}
+
+// Validate checks that a registration is well-formed and does not conflict
+// with itself.
+func (r Registration) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("registration requires a name")
+	}
+
+	if r.Name == ModeratorName {
+		return fmt.Errorf("name %s is reserved for moderators", r.Name)
+	}
+
+	if r.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf(
+			"protocol version %d is not supported, server uses %d",
+			r.ProtocolVersion,
+			ProtocolVersion,
+		)
+	}
+
+	if !r.Layer.Known() {
+		return fmt.Errorf("layer %d is unknown", r.Layer)
+	}
+
+	for _, c := range r.Capabilities {
+		if !c.Valid() {
+			return fmt.Errorf("capability %q is unknown", c)
+		}
+
+		if r.Layer != SystemLayer {
+			return fmt.Errorf(
+				"capability %q requires the %s layer, got %s",
+				c,
+				SystemLayer,
+				r.Layer,
+			)
+		}
+	}
+
+	return nil
+}
+
+// HasCapability reports whether the registration declares capability `c`.
+func (r Registration) HasCapability(c agent.Capability) bool {
+	for _, v := range r.Capabilities {
+		if v == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewRegistrationMessage wraps a registration in a protobuf Message addressed
+// to `receiver`.
+func NewRegistrationMessage(r Registration, receiver Name) (*Message, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPbMessage(r.Name, receiver, Content(b), r.Layer, agent.Register), nil
+}
+
+// ParseRegistration reads a registration from the body of a message.
+func ParseRegistration(msg *Message) (Registration, error) {
+	var r Registration
+
+	if agent.Command(msg.Command) != agent.Register {
+		return r, fmt.Errorf(
+			"expected %s, got %s",
+			agent.Register,
+			agent.Command(msg.Command),
+		)
+	}
+
+	err := json.Unmarshal([]byte(msg.Content), &r)
+	if err != nil {
+		return r, fmt.Errorf("malformed registration: %w", err)
+	}
+
+	return r, nil
+}
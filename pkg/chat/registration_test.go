@@ -0,0 +1,133 @@
+package chat
+
+import (
+	"testing"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+)
+
+func TestRegistration_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       Registration
+		wantErr bool
+	}{
+		{
+			name: "valid speaker",
+			r: Registration{
+				Name:            "toki",
+				Layer:           PhoneticsLayer,
+				ProtocolVersion: ProtocolVersion,
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid system agent",
+			r: Registration{
+				Name:  "SYSTEM_AGENT_A",
+				Layer: SystemLayer,
+				Capabilities: []agent.Capability{
+					agent.CapabilitySpecificationWriter,
+				},
+				ProtocolVersion: ProtocolVersion,
+			},
+			wantErr: false,
+		},
+		{
+			name:    "missing name",
+			r:       Registration{ProtocolVersion: ProtocolVersion},
+			wantErr: true,
+		},
+		{
+			name: "moderator name",
+			r: Registration{
+				Name:            ModeratorName,
+				Layer:           PhoneticsLayer,
+				ProtocolVersion: ProtocolVersion,
+			},
+			wantErr: true,
+		},
+		{
+			name: "protocol mismatch",
+			r: Registration{
+				Name:            "toki",
+				ProtocolVersion: ProtocolVersion + 1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown layer",
+			r: Registration{
+				Name:            "toki",
+				Layer:           UnknownLayer,
+				ProtocolVersion: ProtocolVersion,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown capability",
+			r: Registration{
+				Name:            "SYSTEM_AGENT_A",
+				Capabilities:    []agent.Capability{"juggler"},
+				ProtocolVersion: ProtocolVersion,
+			},
+			wantErr: true,
+		},
+		{
+			name: "system capability off the system layer",
+			r: Registration{
+				Name:  "toki",
+				Layer: GrammarLayer,
+				Capabilities: []agent.Capability{
+					agent.CapabilityDictionaryUpdater,
+				},
+				ProtocolVersion: ProtocolVersion,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				err := tt.r.Validate()
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestParseRegistration(t *testing.T) {
+	want := Registration{
+		Name:            "SYSTEM_AGENT_B",
+		Layer:           SystemLayer,
+		Commands:        []agent.Command{agent.Latch, agent.Unlatch},
+		Schemas:         []string{"ResponseDictionaryEntries"},
+		Capabilities:    []agent.Capability{agent.CapabilityDictionaryUpdater},
+		ProtocolVersion: ProtocolVersion,
+	}
+
+	msg, err := NewRegistrationMessage(want, "SERVER")
+	if err != nil {
+		t.Fatalf("NewRegistrationMessage() error = %v", err)
+	}
+
+	got, err := ParseRegistration(msg)
+	if err != nil {
+		t.Fatalf("ParseRegistration() error = %v", err)
+	}
+
+	if got.Name != want.Name || got.Layer != want.Layer ||
+		!got.HasCapability(agent.CapabilityDictionaryUpdater) {
+		t.Errorf("ParseRegistration() got = %+v, want %+v", got, want)
+	}
+
+	msg.Command = agent.NoCommand.Int32()
+
+	_, err = ParseRegistration(msg)
+	if err == nil {
+		t.Errorf("ParseRegistration() expected error for non-registration message")
+	}
+}
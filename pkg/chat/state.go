@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+)
+
+// AgentState is the state of an agent after it carried out a command. It is
+// sent back to the server as the body of an acknowledgement.
+type AgentState struct {
+	// Command is the command that was carried out.
+	Command agent.Command `json:"command"`
+
+	// Latched is whether the agent is latched.
+	Latched bool `json:"latched"`
+
+	// InstructionHash is a hash of the agent's current system instructions.
+	InstructionHash string `json:"instructionHash"`
+
+	// MemorySize is the number of messages in the agent's short-term memory.
+	MemorySize int `json:"memorySize"`
+}
+
+// NewAckMessage wraps an agent's state in an acknowledgement addressed to
+// `receiver`.
+func NewAckMessage(
+	sender, receiver Name,
+	layer Layer,
+	state AgentState,
+) (*Message, error) {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPbMessage(sender, receiver, Content(b), layer, agent.Acknowledge), nil
+}
+
+// ParseAgentState reads an agent's state from the body of an
+// acknowledgement.
+func ParseAgentState(msg *Message) (AgentState, error) {
+	var st AgentState
+
+	if agent.Command(msg.Command) != agent.Acknowledge {
+		return st, fmt.Errorf(
+			"expected %s, got %s",
+			agent.Acknowledge,
+			agent.Command(msg.Command),
+		)
+	}
+
+	err := json.Unmarshal([]byte(msg.Content), &st)
+	if err != nil {
+		return st, fmt.Errorf("malformed acknowledgement: %w", err)
+	}
+
+	return st, nil
+}
@@ -2,12 +2,17 @@
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"codeberg.org/n30w/jasima/pkg/agent"
 )
 
 type Name string
 
+// ModeratorName is the sender of the messages that people moderating a layer
+// conversation inject into it. No agent may register with it.
+const ModeratorName Name = "MODERATOR"
+
 func (n Name) String() string {
 	return string(n)
 }
@@ -49,11 +54,23 @@ func (l Layer) String() string {
 	case ChattingLayer:
 		return "chatting"
 	default:
+		if name, ok := customLayerName(l); ok {
+			return name
+		}
+
 		return "Unknown Layer"
 	}
 }
 
 func (l *Layer) UnmarshalJSON(b []byte) error {
+	// Custom layers unknown to the writer are written by value.
+
+	var v int32
+	if json.Unmarshal(b, &v) == nil {
+		*l = SetLayer(v)
+		return nil
+	}
+
 	var s string
 
 	err := json.Unmarshal(b, &s)
@@ -61,37 +78,49 @@ func (l *Layer) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
-	// switch s {
-	// case 0:
-	// 	*l = SystemLayer
-	// case 1:
-	// 	*l = PhoneticsLayer
-	// case 2:
-	// 	*l = GrammarLayer
-	// case 3:
-	// 	*l = DictionaryLayer
-	// case 4:
-	// 	*l = LogographyLayer
-	// }
+	parsed, err := ParseLayer(s)
+	if err != nil {
+		*l = 100
+		return nil
+	}
+
+	*l = parsed
+
+	return nil
+}
+
+// ParseLayer reads a layer from its name, as returned by `String`. Custom
+// layers must be registered first.
+func ParseLayer(s string) (Layer, error) {
+	l, err := parseBuiltinLayer(s)
+	if err == nil {
+		return l, nil
+	}
+
+	if l, ok := parseCustomLayer(s); ok {
+		return l, nil
+	}
 
+	return UnknownLayer, err
+}
+
+func parseBuiltinLayer(s string) (Layer, error) {
 	switch s {
-	default:
-		*l = 100
 	case "system":
-		*l = SystemLayer
+		return SystemLayer, nil
 	case "phonetics":
-		*l = PhoneticsLayer
+		return PhoneticsLayer, nil
 	case "grammar":
-		*l = GrammarLayer
+		return GrammarLayer, nil
 	case "dictionary":
-		*l = DictionaryLayer
+		return DictionaryLayer, nil
 	case "logography":
-		*l = LogographyLayer
+		return LogographyLayer, nil
 	case "chatting":
-		*l = ChattingLayer
+		return ChattingLayer, nil
+	default:
+		return UnknownLayer, fmt.Errorf("unknown layer %q", s)
 	}
-
-	return nil
 }
 
 func (l Layer) MarshalJSON() ([]byte, error) {
@@ -112,6 +141,12 @@ func (l Layer) MarshalJSON() ([]byte, error) {
 		s = "chatting"
 	default:
 		s = "unknown"
+
+		if name, ok := customLayerName(l); ok {
+			s = name
+		} else if l.Custom() {
+			return json.Marshal(l.Int32())
+		}
 	}
 
 	return json.Marshal(s)
@@ -132,6 +167,13 @@ func SetLayer(l int32) Layer {
 	case 5:
 		return ChattingLayer
 	default:
+		// Custom layers are defined by the server, so agents may not know
+		// their names.
+
+		if Layer(l).Custom() {
+			return Layer(l)
+		}
+
 		return UnknownLayer
 	}
 }
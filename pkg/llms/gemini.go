@@ -200,7 +200,7 @@ func (c GoogleGemini) prepare(messages []memory.Message) []*genai.Content {
 		for _, v := range messages {
 
 			content := genai.NewContentFromText(
-				v.Text.String(),
+				messageText(v),
 				genai.RoleUser,
 			)
 
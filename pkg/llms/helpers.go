@@ -3,6 +3,8 @@
 import (
 	"regexp"
 	"strings"
+
+	"codeberg.org/n30w/jasima/pkg/memory"
 )
 
 func buildString(strs ...string) string {
@@ -16,6 +18,16 @@ func buildString(strs ...string) string {
 	return sb.String()
 }
 
+// messageText is the text of `m` as a model is given it. Messages of a
+// moderator say so, since models only tell users apart from themselves.
+func messageText(m memory.Message) string {
+	if m.Role == memory.ModeratorRole {
+		return "A moderator of the conversation says: " + m.Text.String()
+	}
+
+	return m.Text.String()
+}
+
 var thinkTagPattern = regexp.MustCompile(`(?s)<think>.*?</think>\n?`)
 
 func removeThinkingTags(response string) string {
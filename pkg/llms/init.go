@@ -154,4 +154,100 @@ func init() {
 			},
 		},
 	)
+
+	schemas.register(
+		reflect.TypeOf(memory.ResponseNextSpeaker{}), &schema{
+			gemini: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"speaker": {
+						Type:        genai.TypeString,
+						Description: "Name of the participant who speaks next",
+					},
+					"reason": {
+						Type:        genai.TypeString,
+						Description: "Why this participant should speak next",
+					},
+				},
+				Required: []string{"speaker", "reason"},
+			},
+			openai: &openai.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   "next_speaker",
+				Strict: openai.Bool(true),
+				Schema: utils.GenerateSchema[memory.ResponseNextSpeaker](),
+			},
+		},
+	)
+
+	schemas.register(
+		reflect.TypeOf(memory.ResponseConvergence{}), &schema{
+			gemini: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"converged": {
+						Type:        genai.TypeBoolean,
+						Description: "Indicates if the conversation has converged and may end",
+					},
+					"reason": {
+						Type:        genai.TypeString,
+						Description: "Why the conversation has or has not converged",
+					},
+				},
+				Required: []string{"converged", "reason"},
+			},
+			openai: &openai.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   "convergence",
+				Strict: openai.Bool(true),
+				Schema: utils.GenerateSchema[memory.ResponseConvergence](),
+			},
+		},
+	)
+
+	schemas.register(
+		reflect.TypeOf(memory.ResponseFitness{}), &schema{
+			gemini: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"score": {
+						Type:        genai.TypeInteger,
+						Description: "Rating of the language from 1, worst, to 10, best",
+					},
+					"reason": {
+						Type:        genai.TypeString,
+						Description: "Why the language deserves the rating",
+					},
+				},
+				Required: []string{"score", "reason"},
+			},
+			openai: &openai.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   "fitness",
+				Strict: openai.Bool(true),
+				Schema: utils.GenerateSchema[memory.ResponseFitness](),
+			},
+		},
+	)
+
+	schemas.register(
+		reflect.TypeOf(memory.SpecificationUpdate{}), &schema{
+			gemini: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"specification": {
+						Type:        genai.TypeString,
+						Description: "The whole revised specification, in Markdown",
+					},
+					"explanation": {
+						Type:        genai.TypeString,
+						Description: "What changed in the specification and why",
+					},
+				},
+				Required: []string{"specification", "explanation"},
+			},
+			openai: &openai.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   "specification_update",
+				Strict: openai.Bool(true),
+				Schema: utils.GenerateSchema[memory.SpecificationUpdate](),
+			},
+		},
+	)
 }
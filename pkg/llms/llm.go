@@ -80,6 +80,11 @@ func (l *llm[T]) AppendInstructions(s string) {
 	l.instructions = buildString(l.instructions, s)
 }
 
+// Instructions returns the current system instructions for the model.
+func (l *llm[T]) Instructions() string {
+	return l.instructions
+}
+
 func (l *llm[T]) String() string {
 	return l.model.String()
 }
@@ -177,6 +182,30 @@ func (l LLMProvider) String() string {
 	return s
 }
 
+// SupportsTypedRequests reports whether the provider can be sent requests
+// that enforce a JSON schema on the response.
+func (l LLMProvider) SupportsTypedRequests() bool {
+	switch l {
+	case ProviderGoogleGemini_2_0_Flash,
+		ProviderGoogleGemini_2_5_Flash,
+		ProviderChatGPT,
+		ProviderOllama:
+		return true
+	default:
+		return false
+	}
+}
+
+// Schemas returns the names of the typed responses the provider is able to
+// reply with.
+func (l LLMProvider) Schemas() []string {
+	if !l.SupportsTypedRequests() {
+		return []string{}
+	}
+
+	return schemas.names()
+}
+
 type ModelConfigs struct {
 	OllamaModelConfig
 }
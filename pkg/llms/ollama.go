@@ -279,7 +279,7 @@ func (c Ollama) prepare(messages []memory.Message) []ol.Message {
 		}
 		content := ol.Message{
 			Role:    r,
-			Content: v.Text.String(),
+			Content: messageText(v),
 		}
 
 		contents = append(contents, content)
@@ -184,7 +184,7 @@ func (c openAIClient) prepare(
 	if len(messages) != 0 {
 		for _, v := range messages {
 
-			text := v.Text.String()
+			text := messageText(v)
 
 			var content openai.ChatCompletionMessageParamUnion
 
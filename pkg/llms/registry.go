@@ -2,6 +2,7 @@
 
 import (
 	"reflect"
+	"slices"
 	"sync"
 
 	"github.com/openai/openai-go"
@@ -43,6 +44,21 @@ func (g *schemaRegistry) lookup(v reflect.Type) (*schema, error) {
 	return s, nil
 }
 
+// names returns the sorted type names of all registered schemas.
+func (g *schemaRegistry) names() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	n := make([]string, 0, len(g.registry))
+	for t := range g.registry {
+		n = append(n, t.Name())
+	}
+
+	slices.Sort(n)
+
+	return n
+}
+
 func lookupType[T any]() (*schema, error) {
 	var v T
 	t := reflect.TypeOf(v)
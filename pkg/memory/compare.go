@@ -0,0 +1,212 @@
+package memory
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+)
+
+// Redefinition is a word whose definition changed between two generations.
+type Redefinition struct {
+	Word string `json:"word"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// WordChanges are how the dictionary changed between two generations. Each
+// list is in word order.
+type WordChanges struct {
+	Added     []DictionaryEntry `json:"added"`
+	Removed   []DictionaryEntry `json:"removed"`
+	Redefined []Redefinition    `json:"redefined"`
+}
+
+// TranscriptStats summarise the transcript of a layer in a generation.
+type TranscriptStats struct {
+	Messages int `json:"messages"`
+	Speakers int `json:"speakers"`
+
+	// Words is the number of whitespace separated words across every
+	// message.
+	Words int `json:"words"`
+}
+
+// TranscriptDelta is the transcript of a layer in the two generations that
+// were compared.
+type TranscriptDelta struct {
+	From TranscriptStats `json:"from"`
+	To   TranscriptStats `json:"to"`
+}
+
+// GenerationDiff is what changed from one generation to another.
+type GenerationDiff struct {
+	Words WordChanges `json:"words"`
+
+	// Logograms are the words whose logograms were added, removed or
+	// redrawn, in word order.
+	Logograms []string `json:"logograms"`
+
+	// Specifications are the changes of the layers whose specification
+	// changed.
+	Specifications map[chat.Layer]SpecificationChange `json:"specifications"`
+
+	Transcripts map[chat.Layer]TranscriptDelta `json:"transcripts"`
+}
+
+// DiffGenerations compares generation `from` to generation `to`. The
+// generations do not have to be consecutive.
+func DiffGenerations(from, to Generation) GenerationDiff {
+	d := GenerationDiff{
+		Words: WordChanges{
+			Added:     make([]DictionaryEntry, 0),
+			Removed:   make([]DictionaryEntry, 0),
+			Redefined: make([]Redefinition, 0),
+		},
+		Logograms:      make([]string, 0),
+		Specifications: make(map[chat.Layer]SpecificationChange),
+		Transcripts:    make(map[chat.Layer]TranscriptDelta),
+	}
+
+	for _, w := range sortedKeys(from.Dictionary, to.Dictionary) {
+		a, inFrom := from.Dictionary[w]
+		b, inTo := to.Dictionary[w]
+
+		switch {
+		case !inFrom:
+			d.Words.Added = append(d.Words.Added, b)
+		case !inTo:
+			d.Words.Removed = append(d.Words.Removed, a)
+		case a.Definition != b.Definition:
+			d.Words.Redefined = append(d.Words.Redefined, Redefinition{
+				Word: w,
+				From: a.Definition,
+				To:   b.Definition,
+			})
+		}
+	}
+
+	for _, w := range sortedKeys(from.Logography, to.Logography) {
+		a, inFrom := from.Logography[w]
+		b, inTo := to.Logography[w]
+
+		if inFrom != inTo || a != b {
+			d.Logograms = append(d.Logograms, w)
+		}
+	}
+
+	for _, l := range sortedKeys(from.Specifications, to.Specifications) {
+		a, b := from.Specifications[l], to.Specifications[l]
+		if a == b {
+			continue
+		}
+
+		// The explanation is of the last change only, when the generations
+		// are not consecutive.
+
+		d.Specifications[l] = DiffSpecifications(
+			l,
+			a.String(),
+			b.String(),
+			to.Changes[l].Explanation,
+		)
+	}
+
+	for _, l := range sortedKeys(from.Transcript, to.Transcript) {
+		d.Transcripts[l] = TranscriptDelta{
+			From: transcriptStats(from.Transcript[l]),
+			To:   transcriptStats(to.Transcript[l]),
+		}
+	}
+
+	return d
+}
+
+// String renders the diff for reading in a terminal.
+func (d GenerationDiff) String() string {
+	var sb strings.Builder
+
+	sb.WriteString("## Dictionary\n")
+
+	for _, e := range d.Words.Added {
+		sb.WriteString(fmt.Sprintf("%s%s: %s\n", DiffAdded, e.Word, e.Definition))
+	}
+
+	for _, e := range d.Words.Removed {
+		sb.WriteString(fmt.Sprintf("%s%s: %s\n", DiffRemoved, e.Word, e.Definition))
+	}
+
+	for _, r := range d.Words.Redefined {
+		sb.WriteString(fmt.Sprintf("~%s: %s -> %s\n", r.Word, r.From, r.To))
+	}
+
+	sb.WriteString("\n## Logograms\n")
+
+	for _, w := range d.Logograms {
+		sb.WriteString(w + "\n")
+	}
+
+	for _, l := range slices.Sorted(maps.Keys(d.Specifications)) {
+		c := d.Specifications[l]
+
+		sb.WriteString(fmt.Sprintf("\n## Specification of %s\n", l))
+
+		if c.Explanation != "" {
+			sb.WriteString(c.Explanation + "\n")
+		}
+
+		sb.WriteString(c.String())
+	}
+
+	sb.WriteString("\n## Transcripts\n")
+
+	for _, l := range slices.Sorted(maps.Keys(d.Transcripts)) {
+		t := d.Transcripts[l]
+
+		sb.WriteString(fmt.Sprintf(
+			"%s: %d -> %d messages, %d -> %d speakers, %d -> %d words\n",
+			l,
+			t.From.Messages,
+			t.To.Messages,
+			t.From.Speakers,
+			t.To.Speakers,
+			t.From.Words,
+			t.To.Words,
+		))
+	}
+
+	return sb.String()
+}
+
+func transcriptStats(t TranscriptMessages) TranscriptStats {
+	var (
+		s        = TranscriptStats{Messages: len(t)}
+		speakers = make(map[chat.Name]struct{})
+	)
+
+	for _, m := range t {
+		speakers[m.Sender] = struct{}{}
+		s.Words += len(strings.Fields(m.Text.String()))
+	}
+
+	s.Speakers = len(speakers)
+
+	return s
+}
+
+// sortedKeys returns the keys of `a` and `b`, once each, in order.
+func sortedKeys[M ~map[K]V, K interface{ ~int32 | ~string }, V any](a, b M) []K {
+	keys := slices.Collect(maps.Keys(a))
+
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
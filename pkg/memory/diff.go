@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+)
+
+const (
+	DiffAdded   = "+"
+	DiffRemoved = "-"
+)
+
+// DiffLine is a line that was added to or removed from a specification.
+type DiffLine struct {
+	// Op is either `DiffAdded` or `DiffRemoved`.
+	Op string `json:"op"`
+
+	// Line is the line's number, counting from 1, in the new specification
+	// when it was added and in the old one when it was removed.
+	Line int `json:"line"`
+
+	// Section is the Markdown heading of the section the line is in. It is
+	// empty before the first heading.
+	Section string `json:"section"`
+
+	Text string `json:"text"`
+}
+
+// SpecificationChange is how, and why, the specification of a layer changed
+// in a generation.
+type SpecificationChange struct {
+	Layer       chat.Layer `json:"layer"`
+	Explanation string     `json:"explanation"`
+
+	// Sections are the headings of the sections that changed, in the order
+	// they first changed.
+	Sections []string `json:"sections"`
+
+	Diff []DiffLine `json:"diff"`
+}
+
+// String renders the change as a unified diff, grouped by section.
+func (c SpecificationChange) String() string {
+	var (
+		sb      strings.Builder
+		section = "\x00"
+	)
+
+	for _, l := range c.Diff {
+		if l.Section != section {
+			section = l.Section
+			sb.WriteString(fmt.Sprintf("@@ %s\n", section))
+		}
+
+		sb.WriteString(l.Op + l.Text + "\n")
+	}
+
+	return sb.String()
+}
+
+// DiffSpecifications compares two versions of a Markdown specification line
+// by line.
+func DiffSpecifications(
+	layer chat.Layer,
+	prev, next, explanation string,
+) SpecificationChange {
+	var (
+		a = splitLines(prev)
+		b = splitLines(next)
+
+		// lcs[i][j] is the length of the longest common subsequence of
+		// a[i:] and b[j:].
+		lcs = make([][]int, len(a)+1)
+	)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var (
+		c       = SpecificationChange{Layer: layer, Explanation: explanation}
+		section string
+		i, j    int
+	)
+
+	add := func(op string, line int, text string) {
+		c.Diff = append(c.Diff, DiffLine{Op: op, Line: line, Section: section, Text: text})
+
+		if !slices.Contains(c.Sections, section) {
+			c.Sections = append(c.Sections, section)
+		}
+	}
+
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			section = heading(b[j], section)
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			section = heading(b[j], section)
+			add(DiffAdded, j+1, b[j])
+			j++
+		default:
+			add(DiffRemoved, i+1, a[i])
+			i++
+		}
+	}
+
+	return c
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, "\n")
+}
+
+// heading returns `line` when it is a Markdown heading, or `section` when it
+// is not.
+func heading(line, section string) string {
+	if strings.HasPrefix(line, "#") {
+		return strings.TrimSpace(strings.TrimLeft(line, "#"))
+	}
+
+	return section
+}
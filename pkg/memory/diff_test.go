@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+)
+
+func TestDiffSpecifications(t *testing.T) {
+	tests := []struct {
+		name         string
+		prev         string
+		next         string
+		wantDiff     []DiffLine
+		wantSections []string
+	}{
+		{
+			name: "unchanged",
+			prev: "# Grammar\nWords.\n",
+			next: "# Grammar\nWords.\n",
+		},
+		{
+			name: "line changed in a section",
+			prev: "# Grammar\nWords.\n## Verbs\nli marks the verb.\n",
+			next: "# Grammar\nWords.\n## Verbs\nli marks the predicate.\n",
+			wantDiff: []DiffLine{
+				{Op: DiffAdded, Line: 4, Section: "Verbs", Text: "li marks the predicate."},
+				{Op: DiffRemoved, Line: 4, Section: "Verbs", Text: "li marks the verb."},
+			},
+			wantSections: []string{"Verbs"},
+		},
+		{
+			name: "section added",
+			prev: "# Grammar\nWords.\n",
+			next: "# Grammar\nWords.\n## Particles\nla marks context.\n",
+			wantDiff: []DiffLine{
+				{Op: DiffAdded, Line: 3, Section: "Particles", Text: "## Particles"},
+				{Op: DiffAdded, Line: 4, Section: "Particles", Text: "la marks context."},
+			},
+			wantSections: []string{"Particles"},
+		},
+		{
+			name: "from nothing",
+			prev: "",
+			next: "Words.",
+			wantDiff: []DiffLine{
+				{Op: DiffAdded, Line: 1, Text: "Words."},
+			},
+			wantSections: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffSpecifications(chat.GrammarLayer, tt.prev, tt.next, "")
+
+			if !reflect.DeepEqual(got.Diff, tt.wantDiff) {
+				t.Errorf("DiffSpecifications() diff = %v, want %v", got.Diff, tt.wantDiff)
+			}
+
+			if !reflect.DeepEqual(got.Sections, tt.wantSections) {
+				t.Errorf("DiffSpecifications() sections = %v, want %v", got.Sections, tt.wantSections)
+			}
+		})
+	}
+}
+
+func TestDiffGenerations(t *testing.T) {
+	entry := func(word, definition string) DictionaryEntry {
+		return DictionaryEntry{dictionaryEntry: dictionaryEntry{Word: word, Definition: definition}}
+	}
+
+	from := Generation{
+		Dictionary: DictionaryGeneration{
+			"li":   entry("li", "marks the verb"),
+			"toki": entry("toki", "speech"),
+		},
+		Logography: LogographyGeneration{"li": "<svg/>", "toki": "<svg/>"},
+		Specifications: SpecificationGeneration{
+			chat.GrammarLayer: "# Grammar\nWords.\n",
+		},
+		Transcript: TranscriptGeneration{
+			chat.GrammarLayer: {{Sender: "a", Text: "one two"}},
+		},
+	}
+
+	to := Generation{
+		Dictionary: DictionaryGeneration{
+			"la": entry("la", "marks context"),
+			"li": entry("li", "marks the predicate"),
+		},
+		Logography: LogographyGeneration{"li": "<svg></svg>", "la": "<svg/>"},
+		Specifications: SpecificationGeneration{
+			chat.GrammarLayer: "# Grammar\nWords.\n",
+		},
+		Transcript: TranscriptGeneration{
+			chat.GrammarLayer: {
+				{Sender: "a", Text: "one"},
+				{Sender: "b", Text: "two three"},
+			},
+		},
+	}
+
+	got := DiffGenerations(from, to)
+
+	want := WordChanges{
+		Added:     []DictionaryEntry{entry("la", "marks context")},
+		Removed:   []DictionaryEntry{entry("toki", "speech")},
+		Redefined: []Redefinition{{Word: "li", From: "marks the verb", To: "marks the predicate"}},
+	}
+
+	if !reflect.DeepEqual(got.Words, want) {
+		t.Errorf("DiffGenerations() words = %v, want %v", got.Words, want)
+	}
+
+	if want := []string{"la", "li", "toki"}; !reflect.DeepEqual(got.Logograms, want) {
+		t.Errorf("DiffGenerations() logograms = %v, want %v", got.Logograms, want)
+	}
+
+	if len(got.Specifications) != 0 {
+		t.Errorf("DiffGenerations() specifications = %v, want none", got.Specifications)
+	}
+
+	wantTranscript := TranscriptDelta{
+		From: TranscriptStats{Messages: 1, Speakers: 1, Words: 2},
+		To:   TranscriptStats{Messages: 2, Speakers: 2, Words: 3},
+	}
+
+	if got := got.Transcripts[chat.GrammarLayer]; got != wantTranscript {
+		t.Errorf("DiffGenerations() transcript = %v, want %v", got, wantTranscript)
+	}
+}
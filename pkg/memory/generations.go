@@ -52,8 +52,18 @@ func (s SpecificationGeneration) Copy() SpecificationGeneration {
 }
 
 type SpecificationUpdate struct {
-	Specification string `json:"specification" jsonschema_description:"Update"`
-	Explanation   string `json:"explanation" jsonschema_description:"Explanation of update"`
+	Specification string `json:"specification" jsonschema_description:"The whole revised specification, in Markdown"`
+	Explanation   string `json:"explanation" jsonschema_description:"What changed in the specification and why"`
+}
+
+// SpecificationChanges are the changes made to the specifications of a
+// generation, by layer.
+type SpecificationChanges map[chat.Layer]SpecificationChange
+
+func (s SpecificationChanges) Copy() SpecificationChanges {
+	newMap := make(SpecificationChanges)
+	maps.Copy(newMap, s)
+	return newMap
 }
 
 type DictionaryGeneration map[string]DictionaryEntry
@@ -85,6 +95,25 @@ func (d DictionaryGeneration) MarshalJSON() ([]byte, error) {
 	return s, nil
 }
 
+// UnmarshalJSON reads a dictionary from the array of entries that
+// `MarshalJSON` writes.
+func (d *DictionaryGeneration) UnmarshalJSON(b []byte) error {
+	var entries []DictionaryEntry
+
+	err := json.Unmarshal(b, &entries)
+	if err != nil {
+		return err
+	}
+
+	*d = make(DictionaryGeneration, len(entries))
+
+	for _, entry := range entries {
+		(*d)[entry.Word] = entry
+	}
+
+	return nil
+}
+
 type dictionaryEntry struct {
 	Word       string `json:"word" jsonschema_description:"Dictionary entry word"`
 	Definition string `json:"definition" jsonschema_description:"Dictionary entry definition"`
@@ -104,4 +133,55 @@ type Generation struct {
 	Logography     LogographyGeneration    `json:"logography"`
 	Specifications SpecificationGeneration `json:"specifications"`
 	Dictionary     DictionaryGeneration    `json:"dictionary"`
+
+	// Changes are how and why the specifications changed from the previous
+	// generation.
+	Changes SpecificationChanges `json:"changes,omitempty"`
+
+	// WordSelection records how the words whose logograms were iterated on
+	// were chosen. It is nil when no logograms were iterated on.
+	WordSelection *WordSelection `json:"wordSelection,omitempty"`
+
+	// Fitness is how the generation was selected from the candidates evolved
+	// from the same parent. It is nil when only one candidate was evolved
+	// and nothing scored it.
+	Fitness *Fitness `json:"fitness,omitempty"`
+}
+
+// Fitness is how the candidates of a generation scored, and which of them was
+// selected to become the generation.
+type Fitness struct {
+	// Selection is the strategy that selected the candidate.
+	Selection string `json:"selection"`
+
+	// Selected is the index of the selected candidate in `Candidates`.
+	Selected   int                `json:"selected"`
+	Candidates []CandidateFitness `json:"candidates"`
+}
+
+// CandidateFitness is the score of a candidate generation. Scores are between
+// 0 and 1.
+type CandidateFitness struct {
+	// Score is the weighted mean of `Scores`.
+	Score float64 `json:"score"`
+
+	// Scores are the scores of each fitness function, by name.
+	Scores map[string]float64 `json:"scores"`
+
+	// Reason is why the judge scored the candidate as it did, if it was
+	// judged.
+	Reason string `json:"reason,omitempty"`
+}
+
+// WordSelection is how the words of a generation's logograms were chosen.
+type WordSelection struct {
+	// Strategies are the strategies that were asked for words, in order.
+	Strategies []string       `json:"strategies"`
+	Words      []SelectedWord `json:"words"`
+}
+
+// SelectedWord is a word and the strategy that chose it.
+type SelectedWord struct {
+	Word     string `json:"word"`
+	Strategy string `json:"strategy"`
 }
@@ -0,0 +1,161 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+)
+
+// JournalKind is the kind of an event of a run's journal.
+type JournalKind string
+
+const (
+	// JournalMessage and JournalCommand events are a Message that was
+	// saved, the latter when it carries a command.
+	JournalMessage JournalKind = "message"
+	JournalCommand JournalKind = "command"
+
+	// JournalDictionary events are the ResponseDictionaryEntries applied to
+	// the generation being evolved.
+	JournalDictionary JournalKind = "dictionary"
+
+	// JournalSpecification events are a SpecificationChange.
+	JournalSpecification JournalKind = "specification"
+
+	// JournalLogogram events are a LogogramIteration.
+	JournalLogogram JournalKind = "logogram"
+
+	// JournalGeneration events are a Generation a lineage keeps, either
+	// when it starts or once it is evolved.
+	JournalGeneration JournalKind = "generation"
+)
+
+// JournalEvent is a line of a run's journal, appended as the run goes.
+type JournalEvent struct {
+	Time time.Time   `json:"time"`
+	Kind JournalKind `json:"kind"`
+
+	// Lineage is the lineage the event happened in. It is empty for
+	// messages, which every lineage shares.
+	Lineage string `json:"lineage,omitempty"`
+
+	// Generation is the number of the generation being evolved, or of the
+	// generation itself for JournalGeneration events.
+	Generation int `json:"generation,omitempty"`
+
+	Data json.RawMessage `json:"data"`
+}
+
+// ErrJournalTorn reports that the last line of a journal is cut short, as it
+// is when a run is killed while the line is being written.
+var ErrJournalTorn = errors.New("journal ends in a torn line")
+
+// ScanJournal calls `f` with each event of the journal read from `r` and the
+// line it is on. A torn last line is skipped, and reported with
+// ErrJournalTorn once every other event has been scanned.
+func ScanJournal(r io.Reader, f func(line int, ev JournalEvent) error) error {
+	var (
+		torn error
+		sc   = bufio.NewScanner(r)
+	)
+
+	// Generations are far longer than a scanner's default line.
+
+	sc.Buffer(nil, 64*1024*1024)
+
+	for i := 1; sc.Scan(); i++ {
+		// Only the last line can be torn. A bad line with more after it is
+		// a broken journal.
+
+		if torn != nil {
+			return torn
+		}
+
+		var ev JournalEvent
+
+		err := json.Unmarshal(sc.Bytes(), &ev)
+		if err != nil {
+			torn = fmt.Errorf("line %d: %w", i, err)
+			continue
+		}
+
+		err = f(i, ev)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i, err)
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	if torn != nil {
+		return fmt.Errorf("%w: %w", ErrJournalTorn, torn)
+	}
+
+	return nil
+}
+
+// FoldJournal reads a journal back into the messages and generations that a
+// run exports. Only the generations of `lineage` are read. They are returned
+// in order with the number of the first, and a generation that is journaled
+// more than once is read as it was last journaled. A journal with a torn last
+// line is folded without it, and ErrJournalTorn is returned with the rest.
+func FoldJournal(r io.Reader, lineage string) ([]Message, []Generation, int, error) {
+	var (
+		msgs []Message
+		gens = make(map[int]Generation)
+	)
+
+	torn := ScanJournal(r, func(_ int, ev JournalEvent) error {
+		switch {
+		case ev.Kind == JournalMessage || ev.Kind == JournalCommand:
+			var m Message
+
+			err := json.Unmarshal(ev.Data, &m)
+			if err != nil {
+				return err
+			}
+
+			msgs = append(msgs, m)
+		case ev.Kind == JournalGeneration && ev.Lineage == lineage:
+			var g Generation
+
+			err := json.Unmarshal(ev.Data, &g)
+			if err != nil {
+				return err
+			}
+
+			gens[ev.Generation] = g
+		}
+
+		return nil
+	})
+	if torn != nil && !errors.Is(torn, ErrJournalTorn) {
+		return nil, nil, 0, torn
+	}
+
+	if len(gens) == 0 {
+		return msgs, nil, 0, torn
+	}
+
+	numbers := slices.Sorted(maps.Keys(gens))
+	first := numbers[0]
+
+	folded := make([]Generation, 0, len(numbers))
+
+	for i, n := range numbers {
+		if n != first+i {
+			return nil, nil, 0, fmt.Errorf("generation %d is missing", first+i)
+		}
+
+		folded = append(folded, gens[n])
+	}
+
+	return msgs, folded, first, torn
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+)
+
+func TestFoldJournal(t *testing.T) {
+	line := func(kind JournalKind, lineage string, n int, data any) string {
+		d, err := json.Marshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(JournalEvent{
+			Kind:       kind,
+			Lineage:    lineage,
+			Generation: n,
+			Data:       d,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(b)
+	}
+
+	gen := func(word string) Generation {
+		return Generation{Logography: LogographyGeneration{word: "<svg/>"}}
+	}
+
+	journal := strings.Join([]string{
+		line(JournalGeneration, "main", 0, gen("toki")),
+		line(JournalMessage, "", 0, Message{Text: "toki!"}),
+		line(JournalDictionary, "main", 1, ResponseDictionaryEntries{}),
+		line(JournalCommand, "", 0, Message{Text: "stop", Command: 1}),
+		line(JournalGeneration, "fork", 1, gen("ike")),
+		line(JournalGeneration, "main", 1, gen("pona")),
+		line(JournalGeneration, "main", 1, gen("suli")),
+	}, "\n")
+
+	msgs, gens, first, err := FoldJournal(strings.NewReader(journal), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msgs) != 2 ||
+		msgs[0].Text != chat.Content("toki!") ||
+		msgs[1].Text != chat.Content("stop") {
+		t.Errorf("messages = %+v, want toki! then stop", msgs)
+	}
+
+	if first != 0 || len(gens) != 2 {
+		t.Fatalf("folded generations %d to %d, want 0 to 1", first, first+len(gens)-1)
+	}
+
+	if _, ok := gens[1].Logography["suli"]; !ok {
+		t.Errorf("generation 1 = %+v, want the last journaled", gens[1])
+	}
+
+	_, _, _, err = FoldJournal(strings.NewReader(strings.Join([]string{
+		line(JournalGeneration, "main", 2, gen("toki")),
+		line(JournalGeneration, "main", 4, gen("pona")),
+	}, "\n")), "main")
+	if err == nil {
+		t.Error("folded a journal missing generation 3")
+	}
+
+	// A run killed while it journals leaves the last line torn.
+
+	torn := line(JournalGeneration, "main", 1, gen("pona"))
+
+	msgs, gens, _, err = FoldJournal(strings.NewReader(strings.Join([]string{
+		line(JournalMessage, "", 0, Message{Text: "toki!"}),
+		line(JournalGeneration, "main", 0, gen("toki")),
+		torn[:len(torn)/2],
+	}, "\n")), "main")
+	if !errors.Is(err, ErrJournalTorn) {
+		t.Errorf("folded a torn journal with error %v, want %v", err, ErrJournalTorn)
+	}
+
+	if len(msgs) != 1 || len(gens) != 1 {
+		t.Errorf("folded %d messages and %d generations of a torn journal, want 1 and 1", len(msgs), len(gens))
+	}
+
+	_, _, _, err = FoldJournal(strings.NewReader(strings.Join([]string{
+		line(JournalGeneration, "main", 0, gen("toki")),
+		torn[:len(torn)/2],
+		line(JournalMessage, "", 0, Message{Text: "toki!"}),
+	}, "\n")), "main")
+	if err == nil || errors.Is(err, ErrJournalTorn) {
+		t.Errorf("folded a journal torn mid-way with error %v, want it broken", err)
+	}
+}
@@ -13,6 +13,11 @@
 const (
 	UserRole ChatRole = iota
 	ModelRole
+
+	// ModeratorRole is the role of messages that a moderator injected into
+	// a conversation. Models are given them as coming from a moderator
+	// rather than a peer.
+	ModeratorRole
 )
 
 func (c ChatRole) String() string {
@@ -23,6 +28,8 @@ func (c ChatRole) String() string {
 		s = "user"
 	case 1:
 		s = "model"
+	case 2:
+		s = "moderator"
 	}
 
 	return s
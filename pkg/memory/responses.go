@@ -25,7 +25,28 @@ type ResponseDictionaryWordsDetection struct {
 	Words []string `json:"words" jsonschema_description:"Words in the dictionary from the text"`
 }
 
+type ResponseNextSpeaker struct {
+	Speaker string `json:"speaker" jsonschema_description:"Name of the participant who speaks next"`
+	Reason  string `json:"reason" jsonschema_description:"Why this participant should speak next"`
+}
+
+type ResponseFitness struct {
+	Score  int    `json:"score" jsonschema_description:"Rating of the language from 1, worst, to 10, best"`
+	Reason string `json:"reason" jsonschema_description:"Why the language deserves the rating"`
+}
+
+type ResponseConvergence struct {
+	Converged bool   `json:"converged" jsonschema_description:"Indicates if the conversation has converged and may end"`
+	Reason    string `json:"reason" jsonschema_description:"Why the conversation has or has not converged"`
+}
+
+// LogogramIteration is the progress on the logogram of `Word`. Words are
+// iterated on at once, so progress on one word is told apart from another by
+// `Word`.
 type LogogramIteration struct {
+	Word      string                    `json:"word"`
+	Exchange  int                       `json:"exchange"`
+	Done      bool                      `json:"done"`
 	Generator ResponseLogogramIteration `json:"generator"`
 	Adversary ResponseLogogramCritique  `json:"adversary"`
 }
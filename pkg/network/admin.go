@@ -0,0 +1,216 @@
+package network
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+)
+
+// ClientInfo describes a connected ChatClient to an operator.
+type ClientInfo struct {
+	Name         chat.Name          `json:"name"`
+	Layer        chat.Layer         `json:"layer"`
+	Provider     int32              `json:"provider"`
+	Model        string             `json:"model"`
+	Capabilities []agent.Capability `json:"capabilities"`
+	State        chat.AgentState    `json:"state"`
+	Lineage      string             `json:"lineage,omitempty"`
+
+	// Pending is the number of commands the client has yet to acknowledge.
+	Pending int `json:"pending"`
+
+	// LastSeen is when the client last sent anything, heartbeats included.
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Info returns what the client declared about itself and its current state.
+func (c *ChatClient) Info() ClientInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return ClientInfo{
+		Name:         c.Name,
+		Layer:        c.layer,
+		Provider:     c.registration.Provider,
+		Model:        c.registration.Model,
+		Capabilities: c.registration.Capabilities,
+		State:        c.state,
+		Lineage:      c.registration.Lineage,
+		Pending:      c.pending,
+		LastSeen:     c.lastSeen,
+	}
+}
+
+// AdminStatus is a snapshot of a running server.
+type AdminStatus struct {
+	// Job is the name of the job being processed. It is empty when no job
+	// is running.
+	Job string `json:"job"`
+
+	// JobStarted is when the current job started.
+	JobStarted time.Time `json:"jobStarted"`
+
+	// Generation is the number of generations evolved so far.
+	Generation int `json:"generation"`
+
+	// MaxGenerations is the number of generations the server will evolve,
+	// or 0 when it evolves forever.
+	MaxGenerations int `json:"maxGenerations"`
+
+	Clients int `json:"clients"`
+
+	Run RunState `json:"run"`
+}
+
+// RunState is the run-state of the job queue, shown on displays so that
+// viewers can tell when the system is paused.
+type RunState struct {
+	Paused bool `json:"paused"`
+
+	// Unit is what the job queue pauses and steps at, either "job" or
+	// "exchange".
+	Unit string `json:"unit"`
+
+	// Steps is the number of steps granted that have not been taken yet.
+	Steps int `json:"steps"`
+
+	Job        string `json:"job"`
+	Generation int    `json:"generation"`
+
+	// Layer describes the layer or logogram being iterated on. It is empty
+	// between layers.
+	Layer string `json:"layer"`
+}
+
+// WatchdogEvent is a timeout noticed by the server's watchdog, and what it
+// did about it.
+type WatchdogEvent struct {
+	Time time.Time `json:"time"`
+
+	// Kind is one of "timeout", "nudge", "fallback" or "gave-up".
+	Kind   string           `json:"kind"`
+	Client chat.Name        `json:"client"`
+	Layer  chat.Layer       `json:"layer"`
+	Role   agent.Capability `json:"role,omitempty"`
+	Detail string           `json:"detail"`
+}
+
+// LineageInfo describes a lineage of the evolution. Lineages other than the
+// main one are forked from a generation of another lineage.
+type LineageInfo struct {
+	ID string `json:"id"`
+
+	// Parent is the lineage this one was forked from. It is empty for the
+	// main lineage.
+	Parent string `json:"parent,omitempty"`
+
+	// ForkedAt is the generation of `Parent` this lineage was forked from.
+	ForkedAt int `json:"forkedAt"`
+
+	Generation     int    `json:"generation"`
+	MaxGenerations int    `json:"maxGenerations"`
+	Job            string `json:"job"`
+
+	// Clients is the number of connected agents that take part in the
+	// lineage.
+	Clients int `json:"clients"`
+}
+
+// AdminForkRequest forks a new lineage from generation `Generation` of
+// lineage `From`, the main lineage when empty. The new lineage evolves
+// `Generations` more generations, as many as `From` when zero. `Pipeline`
+// and `Layers` are paths to the files the new lineage evolves by, those of
+// `From` when empty.
+type AdminForkRequest struct {
+	ID          string `json:"id"`
+	From        string `json:"from"`
+	Generation  int    `json:"generation"`
+	Generations int    `json:"generations"`
+	Pipeline    string `json:"pipeline"`
+	Layers      string `json:"layers"`
+}
+
+// AdminInjectRequest injects a message into a layer, as if it had been sent
+// by `Sender`, which is either the server or `chat.ModeratorName`. The
+// server's name is used when `Sender` is empty. Only the layer that is being
+// discussed takes messages.
+type AdminInjectRequest struct {
+	Layer   chat.Layer `json:"layer"`
+	Sender  chat.Name  `json:"sender"`
+	Content string     `json:"content"`
+}
+
+// AdminCommandRequest sends a command to a single client. `Command` is either
+// the name or the integer value of an `agent.Command`.
+type AdminCommandRequest struct {
+	Receiver chat.Name `json:"receiver"`
+	Command  string    `json:"command"`
+	Content  string    `json:"content"`
+}
+
+// AdminPinnedWords are the words an operator pinned for the "pinned" word
+// selection strategy.
+type AdminPinnedWords struct {
+	Words []string `json:"words"`
+}
+
+// AdminExportResponse lists the files written by an export.
+type AdminExportResponse struct {
+	Files []string `json:"files"`
+}
+
+// ReplayState is the state of a server replaying a recorded run.
+type ReplayState struct {
+	// Run names the recording, after the file it was read from.
+	Run    string  `json:"run"`
+	Paused bool    `json:"paused"`
+	Loop   bool    `json:"loop"`
+	Speed  float64 `json:"speed"`
+
+	// Position is how far into the recording the replay is, out of
+	// `Length`.
+	Position time.Duration `json:"position"`
+	Length   time.Duration `json:"length"`
+
+	// Generation is the number of generations evolved at `Position`, out
+	// of `Generations`.
+	Generation  int `json:"generation"`
+	Generations int `json:"generations"`
+}
+
+// AdminError is the body of every failed admin request.
+type AdminError struct {
+	Error string `json:"error"`
+}
+
+// RequireToken rejects requests that do not carry `token` as a bearer token.
+// An empty `token` lets every request through.
+func RequireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get(authorizationHeader), "Bearer ")
+
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			WriteJson(w, http.StatusUnauthorized, AdminError{Error: "invalid token"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteJson writes `v` as the JSON body of a response with status `code`.
+func WriteJson(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -2,7 +2,7 @@
 
 import (
 	"context"
-	"sync"
+	"fmt"
 
 	"codeberg.org/n30w/jasima/pkg/agent"
 	"codeberg.org/n30w/jasima/pkg/chat"
@@ -12,7 +12,7 @@
 type (
 	CommandForAgent func(agent.Command, ...string) MessageFor
 	MessageFor      func(client *ChatClient) *chat.Message
-	CommandsSender  func([]*ChatClient, ...MessageFor)
+	CommandsSender  func([]*ChatClient, ...MessageFor) error
 )
 
 func BuildCommand(sender string) CommandForAgent {
@@ -38,33 +38,36 @@ func BuildCommand(sender string) CommandForAgent {
 	}
 }
 
+// SendCommandBuilder returns a function that sends every command of
+// `commands` to each client of `clients`. A client is told to expect each
+// command before it is sent, and to forget it again if it could not be sent,
+// so that a failed send never leaves a barrier waiting on it.
 func SendCommandBuilder(
 	ctx context.Context,
 	pool chan<- *chat.Message,
-) func(
-	[]*ChatClient,
-	...MessageFor,
-) {
-	return func(clients []*ChatClient, commands ...MessageFor) {
+) CommandsSender {
+	return func(clients []*ChatClient, commands ...MessageFor) error {
 		for _, c := range clients {
-			var wg sync.WaitGroup
-			wg.Add(1)
-			go func(c *ChatClient) {
-				defer wg.Done()
-				var wg2 sync.WaitGroup
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					for _, cmd := range commands {
-						wg2.Add(1)
-						_ = utils.SendWithContext(ctx, pool, cmd(c))
-						wg2.Done()
-					}
+			for _, cmd := range commands {
+				msg := cmd(c)
+				command := agent.Command(msg.Command)
+
+				c.Expect(command)
+
+				err := utils.SendWithContext(ctx, pool, msg)
+				if err != nil {
+					c.Forget(command)
+
+					return fmt.Errorf(
+						"failed to send %s to %s: %w",
+						command,
+						c.Name,
+						err,
+					)
 				}
-				wg2.Wait()
-			}(c)
-			wg.Wait()
+			}
 		}
+
+		return nil
 	}
 }
@@ -1,12 +1,18 @@
 package network
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
+	"slices"
 	"sync"
+	"time"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 
 	"codeberg.org/n30w/jasima/pkg/agent"
 	"codeberg.org/n30w/jasima/pkg/chat"
@@ -44,6 +50,11 @@ type ChatServer struct {
 	grpcServer *grpc.Server
 	*ServerBase
 
+	// stateChanged is closed and replaced every time a ChatClient
+	// acknowledges a command. See `Barrier`.
+	stateChanged chan struct{}
+	stateMu      sync.Mutex
+
 	// listening determines whether the server will operate on messages,
 	// whether it be through routing, saving, etc.
 	Listening bool
@@ -71,13 +82,30 @@ func NewChatServer(
 		return nil, errors.Wrap(err, "failed to initialize grpc server")
 	}
 
+	serverOpts := make([]grpc.ServerOption, 0)
+
+	if cfg.tls != nil {
+		serverOpts = append(
+			serverOpts,
+			grpc.Creds(credentials.NewTLS(cfg.tls)),
+		)
+	}
+
+	if len(cfg.tokens) > 0 {
+		serverOpts = append(
+			serverOpts,
+			grpc.StreamInterceptor(tokenAuthInterceptor(cfg.tokens)),
+		)
+	}
+
 	cs := &ChatServer{
-		Listening:  true,
-		Channel:    chs,
-		clients:    clients,
-		logger:     logger,
-		ServerBase: b,
-		grpcServer: grpc.NewServer(),
+		Listening:    true,
+		Channel:      chs,
+		clients:      clients,
+		logger:       logger,
+		ServerBase:   b,
+		grpcServer:   grpc.NewServer(serverOpts...),
+		stateChanged: make(chan struct{}),
 	}
 
 	chat.RegisterChatServiceServer(cs.grpcServer, cs)
@@ -129,13 +157,29 @@ func (s *ChatServer) Chat(stream chat.ChatService_ChatServer) error {
 
 	c, err := s.initClient(stream, firstMsg)
 	if err != nil {
+		s.logger.Warn("Client registration rejected", "err", err)
 		return err
 	}
 
 	// Enter an infinite listening session when the ChatClient is connected.
-	// Each ChatClient receives their own context. `listen` is a blocking call.
+	// Each ChatClient receives their own context. `listen` is a blocking call,
+	// so it runs on its own to let the server drop the client in the
+	// meantime. Returning from `Chat` ends the stream, which in turn ends
+	// `listen`.
+
+	listening := make(chan error, 1)
+
+	go func() {
+		listening <- s.listen(c)
+	}()
 
-	err = s.listen(c)
+	select {
+	case err = <-listening:
+	case <-c.kicked:
+		s.removeClient(c)
+		s.logger.Info("Client disconnected by server", "ChatClient", c.Name)
+		return status.Error(codes.Aborted, "disconnected by server")
+	}
 
 	s.removeClient(c)
 
@@ -170,6 +214,19 @@ func (s *ChatServer) listen(c *ChatClient) error {
 				return err
 			}
 
+			c.seen()
+
+			// Acknowledgements and heartbeats only concern the server, so
+			// they are not routed any further.
+
+			switch agent.Command(msg.Command) {
+			case agent.Acknowledge:
+				s.acknowledge(c, msg)
+				continue
+			case agent.Heartbeat:
+				continue
+			}
+
 			s.Channel.ToClients <- msg
 		}
 	}
@@ -223,6 +280,12 @@ func (s *ChatServer) forward(msg *memory.Message) error {
 
 	err = c.Send(msg, msg.Command)
 	if err != nil {
+		// The server was told to expect the command when it was queued,
+		// but the client will never acknowledge what it never received.
+
+		c.Forget(agent.Command(msg.Command))
+		s.notifyStateChange()
+
 		return err
 	}
 
@@ -233,18 +296,63 @@ func (s *ChatServer) TotalClients() int {
 	return s.clients.total
 }
 
-// initClient initializes a ChatClient connection and adds the ChatClient to the
-// list of clients currently maintaining a connection.
+// initClient initializes a ChatClient connection from its registration and
+// adds the ChatClient to the list of clients currently maintaining a
+// connection. Registrations that are malformed or that conflict with an
+// already connected client are rejected.
 func (s *ChatServer) initClient(
 	stream chat.ChatService_ChatServer,
 	msg *chat.Message,
 ) (*ChatClient, error) {
-	c, err := newChatClient(stream, msg.Sender, msg.Layer)
+	r, err := chat.ParseRegistration(msg)
 	if err != nil {
-		return nil, err
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	s.addClient(c)
+	err = r.Validate()
+	if err != nil {
+		return nil, status.Errorf(
+			codes.InvalidArgument,
+			"invalid registration: %v",
+			err,
+		)
+	}
+
+	// When authentication is enabled, an agent may only register under the
+	// name its token was issued for.
+
+	if len(s.config.tokens) > 0 {
+		name, ok := authorizedName(stream.Context())
+		if !ok || name != r.Name {
+			return nil, status.Errorf(
+				codes.PermissionDenied,
+				"token does not permit registering as %s",
+				r.Name,
+			)
+		}
+	}
+
+	if s.config.admit != nil {
+		err = s.config.admit(r)
+		if err != nil {
+			return nil, status.Errorf(
+				codes.PermissionDenied,
+				"%s is not admitted: %v",
+				r.Name,
+				err,
+			)
+		}
+	}
+
+	c, err := newChatClient(stream, r)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = s.addClient(c)
+	if err != nil {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
 
 	s.logger.Info(
 		"Client connected",
@@ -252,19 +360,52 @@ func (s *ChatServer) initClient(
 		c.String(),
 		"layer",
 		c.layer,
+		"model",
+		r.Model,
+		"capabilities",
+		r.Capabilities,
 	)
 
 	return c, nil
 }
 
-func (s *ChatServer) AddClient(c *ChatClient) {
-	s.addClient(c)
+func (s *ChatServer) AddClient(c *ChatClient) error {
+	return s.addClient(c)
 }
 
 func (s *ChatServer) RemoveClient(c *ChatClient) {
 	s.removeClient(c)
 }
 
+// Clients retrieves every connected client, ordered by layer then by name.
+func (s *ChatServer) Clients() []*ChatClient {
+	s.mu.Lock()
+	clients := make([]*ChatClient, 0, len(s.clients.byNameMap))
+	for _, v := range s.clients.byNameMap {
+		clients = append(clients, v)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(clients, func(a, b *ChatClient) int {
+		return cmp.Or(cmp.Compare(a.layer, b.layer), cmp.Compare(a.Name, b.Name))
+	})
+
+	return clients
+}
+
+// Disconnect ends the stream of the client named `name` and removes it from
+// the server.
+func (s *ChatServer) Disconnect(name chat.Name) error {
+	c, err := s.getClientByName(name)
+	if err != nil {
+		return err
+	}
+
+	c.kick()
+
+	return nil
+}
+
 func (s *ChatServer) GetClientsByLayer(layer chat.Layer) []*ChatClient {
 	return s.getClientsByLayer(layer)
 }
@@ -273,18 +414,60 @@ func (s *ChatServer) GetClientByName(name chat.Name) (*ChatClient, error) {
 	return s.getClientByName(name)
 }
 
+// GetClientsByCapability retrieves all clients that declared capability `c`
+// at registration, ordered by name.
+func (s *ChatServer) GetClientsByCapability(c agent.Capability) []*ChatClient {
+	clients := make([]*ChatClient, 0)
+
+	s.mu.Lock()
+	for _, v := range s.clients.byNameMap {
+		if v.registration.HasCapability(c) {
+			clients = append(clients, v)
+		}
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(clients, func(a, b *ChatClient) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return clients
+}
+
+// GetClientByCapability retrieves the first client, ordered by name, that
+// declared capability `c` at registration.
+func (s *ChatServer) GetClientByCapability(c agent.Capability) (
+	*ChatClient,
+	error,
+) {
+	clients := s.GetClientsByCapability(c)
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("no ChatClient with capability '%s' found", c)
+	}
+
+	return clients[0], nil
+}
+
 // addClient adds a ChatClient to the list of clients that maintain an active
-// connection to the server.
-func (s *ChatServer) addClient(client *ChatClient) {
+// connection to the server. A ChatClient with the same name as one that is
+// already connected is rejected.
+func (s *ChatServer) addClient(client *ChatClient) error {
 	// Add the ChatClient to the list of current clients. Multiple connections may
 	// happen all at once, so we need to lock and unlock the mutex to avoid
 	// race conditions.
 
 	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients.byName(client.Name); ok {
+		return fmt.Errorf("ChatClient with name: '%s' already connected", client.Name)
+	}
+
 	s.clients.addByName(client)
 	s.clients.addByLayer(client)
 	s.clients.total++
-	s.mu.Unlock()
+
+	return nil
 }
 
 // removeClient removes a ChatClient from the list of clients that maintain an
@@ -297,8 +480,8 @@ func (s *ChatServer) removeClient(client *ChatClient) {
 	s.mu.Unlock()
 }
 
-// getClientsByLayer retrieves all the clients of a Layer and returns them
-// in an array of pointers to those clients.
+// getClientsByLayer retrieves all the clients of a Layer, ordered by name,
+// and returns them in an array of pointers to those clients.
 func (s *ChatServer) getClientsByLayer(layer chat.Layer) []*ChatClient {
 	var c []*ChatClient
 
@@ -306,6 +489,10 @@ func (s *ChatServer) getClientsByLayer(layer chat.Layer) []*ChatClient {
 	c = s.clients.byLayer(layer)
 	s.mu.Unlock()
 
+	slices.SortFunc(c, func(a, b *ChatClient) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
 	return c
 }
 
@@ -313,7 +500,9 @@ func (s *ChatServer) getClientByName(name chat.Name) (*ChatClient, error) {
 	var c *ChatClient
 	var ok bool
 
+	s.mu.Lock()
 	c, ok = s.clients.byName(name)
+	s.mu.Unlock()
 
 	if !ok {
 		return nil, fmt.Errorf("ChatClient with name: '%s' not found", name)
@@ -329,28 +518,73 @@ type ChatClient struct {
 	layer    chat.Layer
 	channels map[chan *chat.Message]struct{}
 	mu       sync.Mutex
+
+	// sendMu serializes sends on the stream, which gRPC does not allow
+	// from several goroutines at once.
+	sendMu sync.Mutex
+
+	// registration is what the client declared about itself when it
+	// connected.
+	registration chat.Registration
+
+	// state is the state the client reported in its last acknowledgement.
+	state chat.AgentState
+
+	// pending is the number of commands sent to the client that have not
+	// been acknowledged yet.
+	pending int
+
+	// lastSeen is when the client last sent anything, heartbeats included.
+	lastSeen time.Time
+
+	// kicked is closed when the server drops the client.
+	kicked   chan struct{}
+	kickOnce sync.Once
 }
 
 func newChatClient(
 	stream chat.ChatService_ChatServer,
-	name string,
-	l int32,
+	r chat.Registration,
 ) (*ChatClient, error) {
-	if name == "" {
+	if r.Name == "" {
 		return nil, fmt.Errorf("name is required")
 	}
 
 	c := &ChatClient{
-		stream:   stream,
-		Name:     chat.Name(name),
-		layer:    chat.Layer(l),
-		mu:       sync.Mutex{},
-		channels: make(map[chan *chat.Message]struct{}),
+		stream:       stream,
+		Name:         r.Name,
+		layer:        r.Layer,
+		mu:           sync.Mutex{},
+		channels:     make(map[chan *chat.Message]struct{}),
+		registration: r,
+		// Clients start out latched.
+		state:    chat.AgentState{Latched: true},
+		lastSeen: time.Now(),
+		kicked:   make(chan struct{}),
 	}
 
 	return c, nil
 }
 
+// Registration returns what the client declared about itself when it
+// connected.
+func (c *ChatClient) Registration() chat.Registration {
+	return c.registration
+}
+
+// Layer returns the layer the client registered on.
+func (c *ChatClient) Layer() chat.Layer {
+	return c.layer
+}
+
+// kick signals the client's stream to end. It is safe to call more than
+// once.
+func (c *ChatClient) kick() {
+	c.kickOnce.Do(func() {
+		close(c.kicked)
+	})
+}
+
 func (c *ChatClient) SendWithChannel(
 	msg *memory.Message,
 	command ...agent.Command,
@@ -380,7 +614,9 @@ func (c *ChatClient) Send(msg *memory.Message, command ...agent.Command) error {
 }
 
 func (c *ChatClient) send(msg *chat.Message) error {
+	c.sendMu.Lock()
 	err := c.stream.Send(msg)
+	c.sendMu.Unlock()
 	if err != nil {
 		return fmt.Errorf(
 			"failed to send message to: %s: %v",
@@ -462,11 +698,28 @@ func NewChatClientService(
 	ctx context.Context,
 	url string,
 	inbound chan *chat.Message,
+	opts ...func(*clientConfig),
 ) (*ChatClientService, error) {
-	grpcClient, err := grpc.NewClient(
-		url,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	cfg := &clientConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	creds := insecure.NewCredentials()
+	if cfg.tls != nil {
+		creds = credentials.NewTLS(cfg.tls)
+	}
+
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+
+	if cfg.token != "" {
+		dialOpts = append(
+			dialOpts,
+			grpc.WithPerRPCCredentials(tokenCredentials{token: cfg.token}),
+		)
+	}
+
+	grpcClient, err := grpc.NewClient(url, dialOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,134 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+)
+
+func TestChatServer_Disconnect(t *testing.T) {
+	s, err := NewChatServer(log.New(io.Discard), make(chan error, 10), WithPort("0"))
+	if err != nil {
+		t.Fatalf("NewChatServer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go s.ListenAndServe(ctx)
+
+	c, err := NewChatClientService(ctx, s.listener.Addr().String(), make(chan *chat.Message))
+	if err != nil {
+		t.Fatalf("NewChatClientService() error = %v", err)
+	}
+
+	defer func() { _ = c.grpcClient.Close() }()
+
+	msg, err := chat.NewRegistrationMessage(
+		chat.Registration{
+			Name:            "toki",
+			Layer:           chat.PhoneticsLayer,
+			ProtocolVersion: chat.ProtocolVersion,
+		},
+		"SERVER",
+	)
+	if err != nil {
+		t.Fatalf("NewRegistrationMessage() error = %v", err)
+	}
+
+	err = c.Send(msg)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	for len(s.Clients()) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("client never registered")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	err = s.Disconnect("toki")
+	if err != nil {
+		t.Fatalf("Disconnect() error = %v", err)
+	}
+
+	_, err = c.conn.Recv()
+	if got := status.Code(err); got != codes.Aborted {
+		t.Errorf("Recv() code = %s, want %s, err = %v", got, codes.Aborted, err)
+	}
+
+	if got := s.TotalClients(); got != 0 {
+		t.Errorf("TotalClients() = %d, want 0", got)
+	}
+
+	err = s.Disconnect("toki")
+	if err == nil {
+		t.Errorf("Disconnect() error = nil, want error for unknown client")
+	}
+}
+
+func TestChatServer_Admission(t *testing.T) {
+	s, err := NewChatServer(
+		log.New(io.Discard),
+		make(chan error, 10),
+		WithPort("0"),
+		WithAdmission(func(r chat.Registration) error {
+			if r.Name != "toki" {
+				return errors.New("not on the roster")
+			}
+
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewChatServer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go s.ListenAndServe(ctx)
+
+	c, err := NewChatClientService(ctx, s.listener.Addr().String(), make(chan *chat.Message))
+	if err != nil {
+		t.Fatalf("NewChatClientService() error = %v", err)
+	}
+
+	defer func() { _ = c.grpcClient.Close() }()
+
+	msg, err := chat.NewRegistrationMessage(
+		chat.Registration{
+			Name:            "pona",
+			Layer:           chat.PhoneticsLayer,
+			ProtocolVersion: chat.ProtocolVersion,
+		},
+		"SERVER",
+	)
+	if err != nil {
+		t.Fatalf("NewRegistrationMessage() error = %v", err)
+	}
+
+	err = c.Send(msg)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	_, err = c.conn.Recv()
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("Recv() code = %s, want %s, err = %v", got, codes.PermissionDenied, err)
+	}
+
+	if got := s.TotalClients(); got != 0 {
+		t.Errorf("TotalClients() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,82 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter counts requests by the address they come from, over a sliding
+// window.
+type rateLimiter struct {
+	mu     sync.Mutex
+	n      int
+	per    time.Duration
+	recent map[string][]time.Time
+}
+
+// allow reports whether `key` may make another request at `now`. When it may
+// not, it returns how long until it may.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var (
+		since  = now.Add(-l.per)
+		recent = l.recent[key]
+	)
+
+	for len(recent) > 0 && !recent[0].After(since) {
+		recent = recent[1:]
+	}
+
+	if len(recent) >= l.n {
+		l.recent[key] = recent
+		return false, recent[0].Sub(since)
+	}
+
+	l.recent[key] = append(recent, now)
+
+	// Forget addresses that have gone quiet, so that the map does not
+	// grow without bound.
+
+	for k, v := range l.recent {
+		if len(v) == 0 || !v[len(v)-1].After(since) {
+			delete(l.recent, k)
+		}
+	}
+
+	return true, 0
+}
+
+// RateLimit lets each address make `n` requests every `per`, and rejects the
+// rest with `429 Too Many Requests`. A non-positive `n` lets every request
+// through.
+func RateLimit(n int, per time.Duration, next http.Handler) http.Handler {
+	if n <= 0 {
+		return next
+	}
+
+	l := &rateLimiter{n: n, per: per, recent: make(map[string][]time.Time)}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			addr = r.RemoteAddr
+		}
+
+		ok, wait := l.allow(addr, time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			WriteJson(w, http.StatusTooManyRequests, AdminError{
+				Error: fmt.Sprintf("at most %d requests every %s", n, per),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,66 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	h := RateLimit(2, time.Minute, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	send := func(addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/chat/moderator", nil)
+		r.RemoteAddr = addr
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	for i, want := range []int{http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests} {
+		if got := send("192.0.2.1:4000").Code; got != want {
+			t.Errorf("request %d: got %d, want %d", i, got, want)
+		}
+	}
+
+	// Each address has requests of its own, whatever port it uses.
+
+	if got := send("192.0.2.2:4000").Code; got != http.StatusAccepted {
+		t.Errorf("other address: got %d, want %d", got, http.StatusAccepted)
+	}
+
+	if got := send("192.0.2.1:5000"); got.Code != http.StatusTooManyRequests {
+		t.Errorf("same address: got %d, want %d", got.Code, http.StatusTooManyRequests)
+	} else if got.Header().Get("Retry-After") == "" {
+		t.Error("rejected request has no Retry-After")
+	}
+}
+
+func TestRateLimiter_Window(t *testing.T) {
+	var (
+		l   = &rateLimiter{n: 1, per: time.Minute, recent: make(map[string][]time.Time)}
+		now = time.Now()
+	)
+
+	if ok, _ := l.allow("a", now); !ok {
+		t.Fatal("first request was rejected")
+	}
+
+	ok, wait := l.allow("a", now.Add(20*time.Second))
+	if ok {
+		t.Fatal("second request within the window was allowed")
+	}
+
+	if wait != 40*time.Second {
+		t.Errorf("wait = %s, want 40s", wait)
+	}
+
+	if ok, _ := l.allow("a", now.Add(time.Minute+time.Second)); !ok {
+		t.Error("request after the window was rejected")
+	}
+}
@@ -0,0 +1,252 @@
+package network
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+)
+
+const authorizationHeader = "authorization"
+
+// NewServerTLSConfig loads a certificate and key for a server. When
+// `clientCAFile` is not empty, clients must present a certificate signed by
+// that CA, which enables mutual TLS.
+func NewServerTLSConfig(certFile, keyFile, clientCAFile string) (
+	*tls.Config,
+	error,
+) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load server key pair")
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// NewClientTLSConfig builds the TLS configuration for a client. `caFile`
+// verifies the server's certificate; when empty, the system roots are used.
+// When `certFile` and `keyFile` are not empty, the client presents them to
+// the server for mutual TLS.
+func NewClientTLSConfig(caFile, certFile, keyFile, serverName string) (
+	*tls.Config,
+	error,
+) {
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load client key pair")
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read CA file %s", caFile)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	return pool, nil
+}
+
+// WithTLS serves gRPC over TLS using `cfg`.
+func WithTLS(cfg *tls.Config) func(*config) {
+	return func(c *config) {
+		c.tls = cfg
+	}
+}
+
+// LoadAuthTokens reads a TOML file of agent names to the tokens they
+// authenticate with. A token identifies a single agent, so tokens may be
+// neither empty nor shared.
+func LoadAuthTokens(p string) (map[string]string, error) {
+	tokens := make(map[string]string)
+
+	_, err := toml.DecodeFile(p, &tokens)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load auth tokens file %s", p)
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.Errorf("no auth tokens found in %s", p)
+	}
+
+	owners := make(map[string]string, len(tokens))
+
+	for _, name := range slices.Sorted(maps.Keys(tokens)) {
+		t := tokens[name]
+
+		if t == "" {
+			return nil, errors.Errorf("auth token of %s in %s is empty", name, p)
+		}
+
+		if owner, ok := owners[t]; ok {
+			return nil, errors.Errorf(
+				"auth token of %s in %s is also the token of %s",
+				name,
+				p,
+				owner,
+			)
+		}
+
+		owners[t] = name
+	}
+
+	return tokens, nil
+}
+
+// WithAuthTokens requires every agent to authenticate with a shared secret.
+// `tokens` maps an agent name to its token. An agent may only register under
+// the name its token belongs to.
+func WithAuthTokens(tokens map[string]string) func(*config) {
+	return func(c *config) {
+		c.tokens = make(map[chat.Name]string)
+		for k, v := range tokens {
+			c.tokens[chat.Name(k)] = v
+		}
+	}
+}
+
+type authNameKey struct{}
+
+// authorizedName returns the agent name an authenticated stream is allowed to
+// register as.
+func authorizedName(ctx context.Context) (chat.Name, bool) {
+	n, ok := ctx.Value(authNameKey{}).(chat.Name)
+	return n, ok
+}
+
+// authStream overrides the context of a stream with one that carries the
+// authenticated agent's name.
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *authStream) Context() context.Context {
+	return a.ctx
+}
+
+// tokenAuthInterceptor rejects streams that do not carry a known token.
+func tokenAuthInterceptor(tokens map[chat.Name]string) grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		_ *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		md, ok := metadata.FromIncomingContext(ss.Context())
+		if !ok {
+			return status.Error(codes.Unauthenticated, "missing metadata")
+		}
+
+		values := md.Get(authorizationHeader)
+		if len(values) == 0 {
+			return status.Error(codes.Unauthenticated, "missing token")
+		}
+
+		token := strings.TrimPrefix(values[0], "Bearer ")
+
+		for name, t := range tokens {
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				ctx := context.WithValue(ss.Context(), authNameKey{}, name)
+				return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+			}
+		}
+
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+}
+
+// tokenCredentials attaches an agent's token to every RPC.
+type tokenCredentials struct {
+	token string
+}
+
+func (t tokenCredentials) GetRequestMetadata(
+	_ context.Context,
+	_ ...string,
+) (map[string]string, error) {
+	return map[string]string{authorizationHeader: "Bearer " + t.token}, nil
+}
+
+// RequireTransportSecurity is false so that tokens can be used on a local
+// network without TLS. Tokens sent without TLS are readable by anyone on the
+// network.
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// ClientOption configures a ChatClientService.
+type ClientOption = func(*clientConfig)
+
+type clientConfig struct {
+	tls   *tls.Config
+	token string
+}
+
+// WithClientTLS connects to the server over TLS using `cfg`.
+func WithClientTLS(cfg *tls.Config) func(*clientConfig) {
+	return func(c *clientConfig) {
+		c.tls = cfg
+	}
+}
+
+// WithToken authenticates the client with `token`.
+func WithToken(token string) func(*clientConfig) {
+	return func(c *clientConfig) {
+		c.token = token
+	}
+}
@@ -0,0 +1,289 @@
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
+)
+
+// testPKI holds the paths of a CA and the server and client key pairs it
+// signed.
+type testPKI struct {
+	ca         string
+	serverCert string
+	serverKey  string
+	clientCert string
+	clientKey  string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "jasima test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+
+	p := testPKI{ca: filepath.Join(dir, "ca.pem")}
+	writePEM(t, p.ca, "CERTIFICATE", caDER)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("failed to generate %s key: %v", name, err)
+		}
+
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("failed to create %s certificate: %v", name, err)
+		}
+
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("failed to marshal %s key: %v", name, err)
+		}
+
+		certPath := filepath.Join(dir, name+".pem")
+		keyPath := filepath.Join(dir, name+"-key.pem")
+
+		writePEM(t, certPath, "CERTIFICATE", der)
+		writePEM(t, keyPath, "EC PRIVATE KEY", keyDER)
+
+		return certPath, keyPath
+	}
+
+	p.serverCert, p.serverKey = issue(2, "server", x509.ExtKeyUsageServerAuth)
+	p.clientCert, p.clientKey = issue(3, "client", x509.ExtKeyUsageClientAuth)
+
+	return p
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	b := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+
+	err := os.WriteFile(path, b, 0o600)
+	if err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestChatServer_MutualTLSWithTokens(t *testing.T) {
+	pki := newTestPKI(t)
+
+	serverTLS, err := NewServerTLSConfig(pki.serverCert, pki.serverKey, pki.ca)
+	if err != nil {
+		t.Fatalf("NewServerTLSConfig() error = %v", err)
+	}
+
+	clientTLS, err := NewClientTLSConfig(pki.ca, pki.clientCert, pki.clientKey, "localhost")
+	if err != nil {
+		t.Fatalf("NewClientTLSConfig() error = %v", err)
+	}
+
+	errs := make(chan error, 10)
+
+	s, err := NewChatServer(
+		log.New(io.Discard),
+		errs,
+		WithPort("0"),
+		WithTLS(serverTLS),
+		WithAuthTokens(map[string]string{"toki": "secret-toki", "pona": "secret-pona"}),
+	)
+	if err != nil {
+		t.Fatalf("NewChatServer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go s.ListenAndServe(ctx)
+
+	url := s.listener.Addr().String()
+
+	register := func(t *testing.T, name chat.Name, opts ...ClientOption) error {
+		t.Helper()
+
+		c, err := NewChatClientService(ctx, url, make(chan *chat.Message), opts...)
+		if err != nil {
+			t.Fatalf("NewChatClientService() error = %v", err)
+		}
+
+		t.Cleanup(func() { _ = c.grpcClient.Close() })
+
+		msg, err := chat.NewRegistrationMessage(
+			chat.Registration{
+				Name:            name,
+				Layer:           chat.PhoneticsLayer,
+				ProtocolVersion: chat.ProtocolVersion,
+			},
+			"SERVER",
+		)
+		if err != nil {
+			t.Fatalf("NewRegistrationMessage() error = %v", err)
+		}
+
+		err = c.Send(msg)
+		if err != nil {
+			return err
+		}
+
+		// A rejected registration ends the stream. An accepted one stays
+		// open, so wait for the server to add the client instead.
+
+		recvErr := make(chan error, 1)
+		go func() {
+			_, err := c.conn.Recv()
+			recvErr <- err
+		}()
+
+		for {
+			select {
+			case err := <-recvErr:
+				return err
+			case <-time.After(10 * time.Millisecond):
+				_, err := s.GetClientByName(name)
+				if err == nil {
+					return nil
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		register chat.Name
+		opts     []ClientOption
+		wantCode codes.Code
+	}{
+		{
+			name:     "wrong token",
+			register: "toki",
+			opts:     []ClientOption{WithClientTLS(clientTLS), WithToken("nope")},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "token for another agent",
+			register: "toki",
+			opts:     []ClientOption{WithClientTLS(clientTLS), WithToken("secret-pona")},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "valid token",
+			register: "toki",
+			opts:     []ClientOption{WithClientTLS(clientTLS), WithToken("secret-toki")},
+			wantCode: codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				err := register(t, tt.register, tt.opts...)
+				if got := status.Code(err); got != tt.wantCode {
+					t.Errorf("register() code = %s, want %s, err = %v", got, tt.wantCode, err)
+				}
+			},
+		)
+	}
+
+	if got := s.TotalClients(); got != 1 {
+		t.Errorf("TotalClients() = %d, want 1", got)
+	}
+}
+
+func TestLoadAuthTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{
+			name: "tokens",
+			file: "toki = \"secret-toki\"\npona = \"secret-pona\"\n",
+		},
+		{
+			name:    "no tokens",
+			file:    "",
+			wantErr: true,
+		},
+		{
+			name:    "empty token",
+			file:    "toki = \"secret-toki\"\npona = \"\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "shared token",
+			file:    "toki = \"secret\"\npona = \"secret\"\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "tokens.toml")
+			err := os.WriteFile(p, []byte(tt.file), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = LoadAuthTokens(p)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadAuthTokens() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
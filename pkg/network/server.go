@@ -1,7 +1,10 @@
 package network
 
 import (
+	"crypto/tls"
 	"net"
+
+	"codeberg.org/n30w/jasima/pkg/chat"
 )
 
 type ServerBase struct {
@@ -47,30 +50,57 @@ func newServerBase(cfg *config, errs chan<- error) (*ServerBase, error) {
 	}
 )
 
+// ServerOption configures a server.
+type ServerOption = func(*config)
+
 type config struct {
 	addr     string
 	host     string
 	port     string
 	protocol string
+
+	// tls is used to serve over TLS when not nil.
+	tls *tls.Config
+
+	// tokens maps agent names to the tokens they must authenticate with.
+	// Authentication is disabled when empty.
+	tokens map[chat.Name]string
+
+	// admit decides whether an agent may register. Every well-formed
+	// registration is admitted when nil.
+	admit func(chat.Registration) error
 }
 
+// newConfigWithOpts applies options to a copy of `cfg`, so that defaults are
+// left untouched.
 func newConfigWithOpts(cfg *config, opts ...func(*config)) *config {
+	newConf := *cfg
+
 	for _, opt := range opts {
-		opt(cfg)
+		opt(&newConf)
 	}
 
-	if cfg.addr == "" {
-		cfg.addr = net.JoinHostPort(cfg.host, cfg.port)
+	if newConf.addr == "" {
+		newConf.addr = net.JoinHostPort(newConf.host, newConf.port)
 	}
 
-	newConf := &config{
-		addr:     cfg.addr,
-		host:     cfg.host,
-		port:     cfg.port,
-		protocol: cfg.protocol,
+	return &newConf
+}
+
+// WithAdmission rejects the registrations that `admit` returns an error for,
+// such as agents the server does not expect.
+func WithAdmission(admit func(chat.Registration) error) func(*config) {
+	return func(cfg *config) {
+		cfg.admit = admit
 	}
+}
 
-	return newConf
+// WithAddress sets the host and port the server listens on, such as
+// "localhost:50051".
+func WithAddress(addr string) func(*config) {
+	return func(cfg *config) {
+		cfg.addr = addr
+	}
 }
 
 func WithPort(port string) func(*config) {
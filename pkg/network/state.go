@@ -0,0 +1,177 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+)
+
+// StateCondition reports whether an agent's state is the one that is being
+// waited for.
+type StateCondition func(chat.AgentState) bool
+
+var (
+	// Latched matches agents that are latched.
+	Latched StateCondition = func(st chat.AgentState) bool {
+		return st.Latched
+	}
+
+	// Unlatched matches agents that are unlatched.
+	Unlatched StateCondition = func(st chat.AgentState) bool {
+		return !st.Latched
+	}
+
+	// Settled matches agents in any state. Waiting for it waits for agents
+	// to acknowledge every command they were sent.
+	Settled StateCondition = func(chat.AgentState) bool {
+		return true
+	}
+
+	// Reset matches agents that are latched with an empty memory.
+	Reset StateCondition = func(st chat.AgentState) bool {
+		return st.Latched && st.MemorySize == 0
+	}
+)
+
+// Expect records that a command was dispatched to the client. If the command
+// requires an acknowledgement, the client is not considered settled until it
+// acknowledges the command.
+func (c *ChatClient) Expect(cmd agent.Command) {
+	if !cmd.RequiresAck() {
+		return
+	}
+
+	c.mu.Lock()
+	c.pending++
+	c.mu.Unlock()
+}
+
+// Forget undoes Expect for a command that could not be sent to the client,
+// which will never acknowledge it.
+func (c *ChatClient) Forget(cmd agent.Command) {
+	if !cmd.RequiresAck() {
+		return
+	}
+
+	c.mu.Lock()
+	if c.pending > 0 {
+		c.pending--
+	}
+	c.mu.Unlock()
+}
+
+// State returns the state the client reported in its last acknowledgement.
+func (c *ChatClient) State() chat.AgentState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state
+}
+
+// LastSeen returns when the client last sent anything to the server.
+func (c *ChatClient) LastSeen() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastSeen
+}
+
+func (c *ChatClient) seen() {
+	c.mu.Lock()
+	c.lastSeen = time.Now()
+	c.mu.Unlock()
+}
+
+// settled reports whether the client acknowledged every command it was sent
+// and is in a state matching `cond`.
+func (c *ChatClient) settled(cond StateCondition) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.pending == 0 && cond(c.state)
+}
+
+// acknowledge records the state reported by a client's acknowledgement and
+// wakes up any barrier waiting on a state change.
+func (s *ChatServer) acknowledge(c *ChatClient, msg *chat.Message) {
+	st, err := chat.ParseAgentState(msg)
+	if err != nil {
+		s.logger.Errorf("failed to read acknowledgement from %s: %v", c.Name, err)
+		return
+	}
+
+	c.mu.Lock()
+	c.state = st
+	if c.pending > 0 {
+		c.pending--
+	}
+	c.mu.Unlock()
+
+	s.logger.Debug(
+		"Acknowledged",
+		"client",
+		c.Name,
+		"command",
+		st.Command,
+		"latched",
+		st.Latched,
+		"memory",
+		st.MemorySize,
+	)
+
+	s.notifyStateChange()
+}
+
+// notifyStateChange wakes up any barrier waiting on a client's state or on
+// its pending commands.
+func (s *ChatServer) notifyStateChange() {
+	s.stateMu.Lock()
+	close(s.stateChanged)
+	s.stateChanged = make(chan struct{})
+	s.stateMu.Unlock()
+}
+
+// Barrier blocks until every client in `clients` has acknowledged all
+// commands dispatched to it and is in a state matching `cond`. Barrier
+// returns early with an error if the context is done.
+func (s *ChatServer) Barrier(
+	ctx context.Context,
+	clients []*ChatClient,
+	cond StateCondition,
+) error {
+	for {
+		s.stateMu.Lock()
+		changed := s.stateChanged
+		s.stateMu.Unlock()
+
+		done := true
+		for _, c := range clients {
+			if !c.settled(cond) {
+				done = false
+				break
+			}
+		}
+
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// LayerBarrier blocks until all clients on a layer have acknowledged all
+// commands dispatched to them and are in a state matching `cond`.
+func (s *ChatServer) LayerBarrier(
+	ctx context.Context,
+	layer chat.Layer,
+	cond StateCondition,
+) error {
+	return s.Barrier(ctx, s.getClientsByLayer(layer), cond)
+}
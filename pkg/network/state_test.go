@@ -0,0 +1,135 @@
+package network
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"codeberg.org/n30w/jasima/pkg/agent"
+	"codeberg.org/n30w/jasima/pkg/chat"
+)
+
+func newTestChatServer() *ChatServer {
+	return &ChatServer{
+		logger:       log.New(io.Discard),
+		stateChanged: make(chan struct{}),
+	}
+}
+
+func newTestChatClient(t *testing.T, name chat.Name) *ChatClient {
+	t.Helper()
+
+	c, err := newChatClient(
+		nil,
+		chat.Registration{Name: name, Layer: chat.PhoneticsLayer},
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	return c
+}
+
+func ack(t *testing.T, s *ChatServer, c *ChatClient, st chat.AgentState) {
+	t.Helper()
+
+	msg, err := chat.NewAckMessage(c.Name, "SERVER", c.layer, st)
+	if err != nil {
+		t.Fatalf("failed to create acknowledgement: %v", err)
+	}
+
+	s.acknowledge(c, msg)
+}
+
+func TestChatServer_Barrier(t *testing.T) {
+	s := newTestChatServer()
+	toki := newTestChatClient(t, "toki")
+	pona := newTestChatClient(t, "pona")
+	clients := []*ChatClient{toki, pona}
+
+	for _, c := range clients {
+		c.Expect(agent.AppendInstructions)
+		c.Expect(agent.Unlatch)
+	}
+
+	// Requests do not need to be acknowledged.
+
+	toki.Expect(agent.RequestLogogramCritique)
+
+	done := make(chan error)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		done <- s.Barrier(ctx, clients, Unlatched)
+	}()
+
+	for _, c := range clients {
+		ack(t, s, c, chat.AgentState{Command: agent.AppendInstructions, Latched: true})
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("Barrier() returned before clients unlatched, err = %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for _, c := range clients {
+		ack(t, s, c, chat.AgentState{Command: agent.Unlatch, Latched: false})
+	}
+
+	err := <-done
+	if err != nil {
+		t.Errorf("Barrier() error = %v, want nil", err)
+	}
+}
+
+func TestChatServer_Barrier_Timeout(t *testing.T) {
+	s := newTestChatServer()
+	toki := newTestChatClient(t, "toki")
+
+	toki.Expect(agent.Unlatch)
+
+	// The state already matches, but the command is unacknowledged.
+
+	ack(t, s, toki, chat.AgentState{Command: agent.Latch, Latched: false})
+	toki.Expect(agent.Unlatch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := s.Barrier(ctx, []*ChatClient{toki}, Unlatched)
+	if err == nil {
+		t.Errorf("Barrier() error = nil, want deadline exceeded")
+	}
+}
+
+func TestSendCommandBuilder_Failed(t *testing.T) {
+	s := newTestChatServer()
+	toki := newTestChatClient(t, "toki")
+
+	// Nothing reads the pool, so the send fails once the context is done.
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	send := SendCommandBuilder(ctx, make(chan *chat.Message))
+
+	err := send([]*ChatClient{toki}, BuildCommand("SERVER")(agent.Unlatch))
+	if err == nil {
+		t.Fatal("send error = nil, want context canceled")
+	}
+
+	// The command was never sent, so it is not waited for.
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = s.Barrier(ctx, []*ChatClient{toki}, Settled)
+	if err != nil {
+		t.Errorf("Barrier() error = %v, want nil", err)
+	}
+}
@@ -11,6 +11,7 @@
 	"sync"
 	"time"
 
+	"codeberg.org/n30w/jasima/pkg/chat"
 	"codeberg.org/n30w/jasima/pkg/memory"
 	"codeberg.org/n30w/jasima/pkg/utils"
 
@@ -47,6 +48,22 @@ func NewWebServer(l *log.Logger, errs chan<- error, opts ...func(*config)) (*Web
 	}, nil
 }
 
+// NewWebFeeds returns a web server that does not listen on its own. Its
+// broadcasters and initial data are served by the routes of another web
+// server.
+func NewWebFeeds(l *log.Logger) (*WebServer, error) {
+	i, err := NewInitialData()
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebServer{
+		InitialData:  i,
+		Broadcasters: NewBroadcasters(l),
+		logger:       l,
+	}, nil
+}
+
 // ListenAndServe accepts any arbitrary number of `route` functions that
 // register an API route with the HTTP serve mux.
 func (s WebServer) ListenAndServe(ctx context.Context, routes ...func(*http.ServeMux)) {
@@ -210,10 +227,13 @@ type Broadcasters struct {
 	MessageWordDictExtraction *Broadcaster[memory.ResponseDictionaryWordsDetection]
 	Generation                *Broadcaster[memory.Generation]
 	Specification             *Broadcaster[memory.SpecificationGeneration]
+	SpecificationChange       *Broadcaster[memory.SpecificationChange]
 	LogogramDisplay           *Broadcaster[memory.LogogramIteration]
 	CurrentTime               *Broadcaster[string]
 	TestMessageFeed           *Broadcaster[memory.Message]
 	TestGenerationsFeed       *Broadcaster[memory.Generation]
+	RunState                  *Broadcaster[RunState]
+	Watchdog                  *Broadcaster[WatchdogEvent]
 }
 
 func NewBroadcasters(l *log.Logger) *Broadcasters {
@@ -222,10 +242,13 @@ func NewBroadcasters(l *log.Logger) *Broadcasters {
 		MessageWordDictExtraction: NewBroadcaster[memory.ResponseDictionaryWordsDetection](l),
 		Generation:                NewBroadcaster[memory.Generation](l),
 		Specification:             NewBroadcaster[memory.SpecificationGeneration](l),
+		SpecificationChange:       NewBroadcaster[memory.SpecificationChange](l),
 		LogogramDisplay:           NewBroadcaster[memory.LogogramIteration](l),
 		CurrentTime:               NewBroadcaster[string](l),
 		TestMessageFeed:           NewBroadcaster[memory.Message](l),
 		TestGenerationsFeed:       NewBroadcaster[memory.Generation](l),
+		RunState:                  NewBroadcaster[RunState](l),
+		Watchdog:                  NewBroadcaster[WatchdogEvent](l),
 	}
 }
 
@@ -246,6 +269,22 @@ func addEventHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 }
 
+// AllowCrossOrigin answers the preflight request of a browser that is about to
+// send a request from another origin, such as JSON to an endpoint.
+func AllowCrossOrigin(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ModeratorMessage is a message that a person moderating a layer conversation
+// injects into it.
+type ModeratorMessage struct {
+	Layer   chat.Layer `json:"layer"`
+	Content string     `json:"content"`
+}
+
 // InitialData contains frontend initializing data so that, when connected,
 // data is shown rather than having nothing.
 type InitialData struct {
@@ -253,7 +292,10 @@ type InitialData struct {
 	RecentGenerations    utils.Queue[memory.Generation]
 	RecentLogogram       utils.Queue[memory.LogogramIteration]
 	RecentSpecifications utils.Queue[memory.SpecificationGeneration]
+	RecentChanges        utils.Queue[memory.SpecificationChange]
 	RecentUsedWords      utils.Queue[memory.ResponseDictionaryWordsDetection]
+	RecentRunState       utils.Queue[RunState]
+	RecentWatchdog       utils.Queue[WatchdogEvent]
 }
 
 func NewInitialData() (*InitialData, error) {
@@ -278,22 +320,48 @@ func NewInitialData() (*InitialData, error) {
 		)
 	}
 
+	// Keep a change for each layer of a generation.
+
+	changes, err := utils.NewDynamicFixedQueue[memory.SpecificationChange](10)
+	if err != nil {
+		return nil, errors.Wrap(
+			err,
+			"failed to make recent specification changes queue",
+		)
+	}
+
 	usedWords, err := utils.NewDynamicFixedQueue[memory.ResponseDictionaryWordsDetection](2)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to make recent used words queue")
 	}
 
-	rl, err := utils.NewDynamicFixedQueue[memory.LogogramIteration](2)
+	// Logograms are iterated on several words at once, so keep enough to
+	// show each of them.
+
+	rl, err := utils.NewDynamicFixedQueue[memory.LogogramIteration](16)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to make recent logogram queue")
 	}
 
+	rs, err := utils.NewDynamicFixedQueue[RunState](1)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make recent run state queue")
+	}
+
+	wd, err := utils.NewDynamicFixedQueue[WatchdogEvent](20)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make recent watchdog queue")
+	}
+
 	initData := &InitialData{
 		RecentMessages:       recentMessagesQueue,
 		RecentGenerations:    rg,
 		RecentSpecifications: specs,
+		RecentChanges:        changes,
 		RecentUsedWords:      usedWords,
 		RecentLogogram:       rl,
+		RecentRunState:       rs,
+		RecentWatchdog:       wd,
 	}
 	return initData, nil
 }